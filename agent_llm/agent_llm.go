@@ -2,14 +2,19 @@
 package agent_llm
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"math/rand"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
@@ -21,6 +26,8 @@ import (
 	"github.com/pancsta/secai/agent_llm/db/sqlc"
 	sa "github.com/pancsta/secai/agent_llm/schema"
 	"github.com/pancsta/secai/agent_llm/states"
+	"github.com/pancsta/secai/i18n"
+	"github.com/pancsta/secai/match"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -53,9 +60,12 @@ type AgentLLM struct {
 
 	// data
 
-	Character     atomic.Pointer[sa.ResultGenCharacter]
+	Character atomic.Pointer[sa.ResultGenCharacter]
+	// Resources are the resources of the session's locale.
 	Resources     atomic.Pointer[sa.ResultGenResources]
-	MoveOrienting atomic.Pointer[sa.ResultOrienting]
+	MoveOrienting atomic.Pointer[sa.OrientingMove]
+	// resources are the restored and generated resources, per locale
+	resources atomic.Pointer[map[string]*sa.ResultGenResources]
 
 	// prompts
 
@@ -64,11 +74,31 @@ type AgentLLM struct {
 	PGenCharacter     *sa.PromptGenCharacter
 	POrienting        *sa.PromptOrienting
 	PConfigTest       *sa.PromptConfigTest
+	PExtractingFacts  *sa.PromptExtractingFacts
 
 	dbQueries    *sqlc.Queries
 	DocCharacter *secai.Document
+	// DocFacts recalls the known facts about the user into prompts.
+	DocFacts *secai.Document
+	// Matcher resolves obvious prompts locally, before Orienting and CheckingMenuRefs call the LLM.
+	Matcher *match.Matcher
+	// movesConfirm are mid-confidence moves awaiting the user's confirmation
+	movesConfirm atomic.Pointer[movesConfirm]
+	// cacheSchema is the last memory schema hash seen by the decision cache
+	cacheSchema atomic.Value
+	facts       userFacts
 }
 
+type movesConfirm struct {
+	Prompt string
+	Moves  []sa.OrientingMove
+	// Decision caches the confirmed move for the original prompt.
+	Decision *decision
+}
+
+// orientingActionPrefix prefixes IDs of [AgentLLM.OrientingActions].
+const orientingActionPrefix = "orienting-"
+
 func New(ctx context.Context, states am.S, schema am.Schema) *AgentLLM {
 	// init the agent along with the base
 	return &AgentLLM{
@@ -91,22 +121,60 @@ func (a *AgentLLM) Init(
 	a.PGenCharacter = sa.NewPromptGenCharacter(a)
 	a.PGenResources = sa.NewPromptGenResources(a)
 	a.POrienting = sa.NewPromptOrienting(a)
+	a.PExtractingFacts = sa.NewPromptExtractingFacts(a)
+	a.Matcher = match.New(cfg.Agent.Orienting.Local)
+	a.DBMigrations = append(a.DBMigrations, Migrations)
 
 	return nil
 }
 
-// Phrase returns a random phrase from resources under [key], or an empty string.
+// Phrase returns a random phrase from resources under [key], or an empty string. Phrases are resolved by the
+// session's locale, with fallbacks to the base language and the configured locale.
 // TODO move to base agent
 func (a *AgentLLM) Phrase(key string, args ...any) string {
-	r := a.Resources.Load()
-	if r == nil || len(r.Phrases[key]) == 0 {
+	var phrases []string
+	if r := a.Resources.Load(); r != nil {
+		phrases = r.Phrases[key]
+	}
+	if all := a.resources.Load(); len(phrases) == 0 && all != nil {
+		for _, locale := range i18n.Fallbacks(a.Locale(), a.ConfigBase().Agent.Locale) {
+			if r := (*all)[locale]; r != nil && len(r.Phrases[key]) > 0 {
+				phrases = r.Phrases[key]
+				break
+			}
+		}
+	}
+	if len(phrases) == 0 {
 		return ""
 	}
-	txt := r.Phrases[key][rand.Intn(len(r.Phrases[key]))]
+	txt := phrases[rand.Intn(len(phrases))]
 
 	return fmt.Sprintf(txt, args...)
 }
 
+// resourcesFor returns resources of [locale] or its base language, or nil.
+func (a *AgentLLM) resourcesFor(locale string) *sa.ResultGenResources {
+	all := a.resources.Load()
+	if all == nil {
+		return nil
+	}
+	if r := (*all)[i18n.Normalize(locale)]; r != nil {
+		return r
+	}
+
+	return (*all)[i18n.Base(locale)]
+}
+
+// resourcesSet stores resources of [locale], next to the other locales.
+func (a *AgentLLM) resourcesSet(locale string, res *sa.ResultGenResources) {
+	all := map[string]*sa.ResultGenResources{}
+	if prev := a.resources.Load(); prev != nil {
+		maps.Copy(all, *prev)
+	}
+	all[locale] = res
+	a.resources.Store(&all)
+}
+
 // OutputPhrase is sugar for Phrase followed by Output FromAssistant.
 func (a *AgentLLM) OutputPhrase(key string, args ...any) error {
 	txt := a.Phrase(key, args...)
@@ -121,7 +189,7 @@ func (a *AgentLLM) OutputPhrase(key string, args ...any) error {
 
 func (a *AgentLLM) Queries() *sqlc.Queries {
 	if a.dbQueries == nil {
-		a.dbQueries = sqlc.New(a.DbConn)
+		a.dbQueries = sqlc.New(a.DBTX(a.DbConn))
 	}
 
 	return a.dbQueries
@@ -129,10 +197,62 @@ func (a *AgentLLM) Queries() *sqlc.Queries {
 
 func (a *AgentLLM) MemoryWipe(ctx context.Context, e *am.Event) {
 	mach := a.Mach()
+	// queued inserts would outlive the wipe
+	if err := a.DBFlush(ctx); err != nil {
+		mach.EvAddErrState(e, ss.ErrDB, err, nil)
+		return
+	}
 	err := a.Queries().DeleteAllCharacter(ctx)
 	mach.EvAddErrState(e, ss.ErrDB, err, nil)
 	err = a.Queries().DeleteAllResources(ctx)
 	mach.EvAddErrState(e, ss.ErrDB, err, nil)
+	err = a.Queries().DeleteAllFacts(ctx)
+	mach.EvAddErrState(e, ss.ErrDB, err, nil)
+	a.factsSet(nil)
+	err = a.DeleteSnapshots(ctx)
+	mach.EvAddErrState(e, ss.ErrDB, err, nil)
+}
+
+// OrientingActions returns buttons for the moves awaiting the user's confirmation. Meant to be appended to
+// [shared.AgentAPI.Actions] and handled with [AgentLLM.OrientingAction].
+func (a *AgentLLM) OrientingActions() []shared.ActionInfo {
+	pending := a.movesConfirm.Load()
+	if pending == nil {
+		return nil
+	}
+
+	ret := make([]shared.ActionInfo, len(pending.Moves))
+	for i, m := range pending.Moves {
+		ret[i] = shared.ActionInfo{
+			ID:           orientingActionPrefix + strconv.Itoa(i),
+			Label:        a.moveLabel(m.Move),
+			Desc:         fmt.Sprintf("%s (%.0f%%)", m.Move, m.Certainty*100),
+			Action:       true,
+			VisibleAgent: true,
+			VisibleMem:   true,
+		}
+	}
+
+	return ret
+}
+
+// OrientingAction performs a move confirmed via [AgentLLM.OrientingActions]. Returns false for unknown IDs.
+func (a *AgentLLM) OrientingAction(e *am.Event, id string) bool {
+	idx, ok := strings.CutPrefix(id, orientingActionPrefix)
+	if !ok {
+		return false
+	}
+	i, err := strconv.Atoi(idx)
+	if err != nil {
+		return false
+	}
+	move := a.orientingConfirmed(e, i)
+	if move == nil {
+		return false
+	}
+	a.Mach().EvAdd1(e, ss.OrientingMove, Pass(&A{Move: move}))
+
+	return true
 }
 
 // private
@@ -141,6 +261,111 @@ func (a *AgentLLM) child() ChildAPI {
 	return a.AgentImpl().(ChildAPI)
 }
 
+// orientingBands accepts, confirms or rejects ranked [moves], according to the confidence bands of
+// [shared.ConfigOrienting]. Decisions get cached under [d], if any.
+func (a *AgentLLM) orientingBands(e *am.Event, prompt string, moves []sa.OrientingMove, d *decision) {
+	cfg := a.ConfigBase().Agent.Orienting
+	a.movesConfirm.Store(nil)
+	switch {
+	case len(moves) == 0 || moves[0].Certainty < cfg.Confirm:
+		a.Log("orienting rejected", "moves", moves)
+		a.decisionSet(e, d, "null")
+	case moves[0].Certainty >= cfg.Accept:
+		a.MoveOrienting.Store(&moves[0])
+		if result, err := json.Marshal(moves[0]); err == nil {
+			a.decisionSet(e, d, string(result))
+		}
+	default:
+		a.orientingConfirm(prompt, moves, d)
+	}
+}
+
+// orientingConfirm offers mid-confidence moves to the user, as a question and buttons.
+func (a *AgentLLM) orientingConfirm(prompt string, moves []sa.OrientingMove, d *decision) {
+	cfg := a.ConfigBase().Agent.Orienting
+	var candidates []sa.OrientingMove
+	for _, m := range moves {
+		if m.Certainty < cfg.Confirm || len(candidates) >= cfg.Candidates {
+			break
+		}
+		candidates = append(candidates, m)
+	}
+	a.movesConfirm.Store(&movesConfirm{Prompt: prompt, Moves: candidates, Decision: d})
+	a.Log("orienting confirm", "moves", candidates)
+
+	msg := a.T(i18n.KeyDidYouMean) + "\n"
+	for i, m := range candidates {
+		msg += fmt.Sprintf("%d. %s\n", i+1, a.moveLabel(m.Move))
+	}
+	a.Output(msg, shared.FromAssistant)
+}
+
+// orientingConfirmed returns a pending move confirmed by the user, and logs it as a training example.
+func (a *AgentLLM) orientingConfirmed(e *am.Event, idx int) *sa.OrientingMove {
+	pending := a.movesConfirm.Load()
+	if pending == nil || idx < 0 || idx >= len(pending.Moves) {
+		return nil
+	}
+	if !a.movesConfirm.CompareAndSwap(pending, nil) {
+		return nil
+	}
+	move := pending.Moves[idx]
+	a.Log("orienting confirmed", "move", move)
+
+	// persist as a training example
+	candidates, _ := json.Marshal(pending.Moves)
+	a.Mach().EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := sqlc.New(a.DBTX(tx)).AddOrientingExample(ctx, sqlc.AddOrientingExampleParams{
+				SessionID:  a.SessionID(),
+				Prompt:     pending.Prompt,
+				Move:       move.Move,
+				Certainty:  move.Certainty,
+				Candidates: string(candidates),
+				CreatedAt:  time.Now(),
+			})
+			return err
+		},
+	}}))
+	if result, err := json.Marshal(move); err == nil {
+		a.decisionSet(e, pending.Decision, string(result))
+	}
+
+	return &move
+}
+
+// matchLocal resolves [prompt] via [AgentLLM.Matcher] and logs hits and misses. Returns nil when disabled. The
+// threshold comes from the current config.
+func (a *AgentLLM) matchLocal(kind, prompt string, candidates []match.Candidate) *match.Result {
+	threshold := a.ConfigBase().Agent.Orienting.Local
+	if a.Matcher == nil || threshold <= 0 {
+		return nil
+	}
+
+	res := a.Matcher.MatchMin(prompt, candidates, threshold)
+	hits, misses := a.Matcher.Stats()
+	if res == nil {
+		a.Log("local match miss", "kind", kind, "hits", hits, "misses", misses)
+	} else {
+		a.Log("local match hit", "kind", kind, "id", res.ID, "score", res.Score, "method", res.Method,
+			"hits", hits, "misses", misses)
+	}
+
+	return res
+}
+
+// moveLabel returns a human-readable label of an orienting move.
+func (a *AgentLLM) moveLabel(move string) string {
+	if s := a.AgentImpl().Story(move); s != nil && s.Title != "" {
+		return s.Title
+	}
+	if desc := a.AgentImpl().OrientingMoves()[move]; desc != "" {
+		return desc
+	}
+
+	return move
+}
+
 // ///// ///// /////
 
 // ///// HANDLERS
@@ -155,8 +380,22 @@ func (a *AgentLLM) ConfigValidatingState(e *am.Event) {
 func (a *AgentLLM) ConfigUpdateState(e *am.Event) {
 	// call super
 	a.AgentBase.ConfigUpdateState(e)
+	args := ParseArgs(e.Args)
+
+	// switch resources to the new locale, or generate them
+	if args.Locale != "" {
+		if res := a.resourcesFor(a.Locale()); res != nil {
+			a.Resources.Store(res)
+		} else if a.Mach().Any1(ss.ResourcesReady, ss.RestoreResources) {
+			a.Resources.Store(nil)
+			a.Mach().EvAdd1(e, ss.GenResources, nil)
+		}
+	}
+
 	// first AI state
-	a.Mach().EvRemove(e, am.S{ss.GenCharacter}, nil)
+	if args.ConfigAI != nil {
+		a.Mach().EvRemove(e, am.S{ss.GenCharacter}, nil)
+	}
 }
 
 func (a *AgentLLM) CheckingMenuRefsState(e *am.Event) {
@@ -195,11 +434,33 @@ func (a *AgentLLM) CheckingMenuRefsState(e *am.Event) {
 			ret = foundFn(i - 1)
 			return
 		}
+		candidates := make([]match.Candidate, len(choices))
+		for i, c := range choices {
+			candidates[i] = match.Candidate{ID: strconv.Itoa(i), Text: c}
+		}
+		if res := a.matchLocal(ss.CheckingMenuRefs, prompt, candidates); res != nil {
+			ret = foundFn(res.Index)
+			return
+		}
 
 		if !args.CheckLLM {
 			return
 		}
 
+		// cached decision
+		refs := map[string]string{}
+		for i, c := range choices {
+			refs[strconv.Itoa(i)] = shared.RemoveStyling(c)
+		}
+		d := a.decisionNew(ss.CheckingMenuRefs, prompt, refs)
+		if cached, ok := a.decisionGet(a.Mach().Context(), d); ok {
+			var idx int
+			if err := json.Unmarshal([]byte(cached), &idx); err == nil && idx >= 0 && idx < len(choices) {
+				ret = foundFn(idx)
+			}
+			return
+		}
+
 		// infer via LLM
 		params := sa.ParamsCheckingMenuRefs{
 			Choices: shared.Map(choices, func(o string) string {
@@ -212,6 +473,7 @@ func (a *AgentLLM) CheckingMenuRefsState(e *am.Event) {
 			a.Mach().AddErr(err, nil)
 			return
 		}
+		a.decisionSet(e, d, strconv.Itoa(res.RefIndex))
 		if res.RefIndex >= 0 && res.RefIndex < len(choices) {
 			ret = foundFn(res.RefIndex)
 			return
@@ -234,6 +496,7 @@ func (a *AgentLLM) GenResourcesState(e *am.Event) {
 	llm := a.PGenResources
 
 	params := a.AgentImpl().(ChildAPI).LLMResources()
+	locale := a.Locale()
 
 	// unblock
 	go func() {
@@ -251,20 +514,26 @@ func (a *AgentLLM) GenResourcesState(e *am.Event) {
 			return
 		}
 
-		// persist
-		for key, phrases := range res.Phrases {
-			for _, p := range phrases {
-				// TODO base queries
-				_, err := a.Queries().AddResource(ctx, sqlc.AddResourceParams{
-					Key:   key,
-					Value: p,
-				})
-				if err != nil {
-					mach.EvAddErrState(e, ss.ErrDB, err, nil)
-					break
+		// persist in a single transaction
+		mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+			DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+				q := sqlc.New(a.DBTX(tx))
+				for key, phrases := range res.Phrases {
+					for _, p := range phrases {
+						_, err := q.AddResource(ctx, sqlc.AddResourceParams{
+							Key:    key,
+							Value:  p,
+							Locale: locale,
+						})
+						if err != nil {
+							return err
+						}
+					}
 				}
-			}
-		}
+				return nil
+			},
+		}}))
+		a.resourcesSet(locale, res)
 		a.Resources.Store(res)
 
 		// next
@@ -308,11 +577,25 @@ func (a *AgentLLM) OrientingState(e *am.Event) {
 	}
 
 	// build params
+	// local candidates
+	var candidates []match.Candidate
+	for _, moves := range []map[string]string{a.AgentImpl().OrientingMoves(), movesStories} {
+		for _, name := range slices.Sorted(maps.Keys(moves)) {
+			c := match.Candidate{ID: name, Text: moves[name]}
+			if s := a.AgentImpl().Story(name); s != nil && s.Title != "" {
+				c.Keywords = []string{s.Title}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	cfg := a.ConfigBase().Agent.Orienting
 	params := sa.ParamsOrienting{
 		Prompt:     prompt,
 		MovesAgent: a.AgentImpl().OrientingMoves(),
 		// TODO desc
 		MovesStories: movesStories,
+		MaxMoves:     max(1, cfg.Candidates),
 	}
 
 	// unblock
@@ -328,6 +611,37 @@ func (a *AgentLLM) OrientingState(e *am.Event) {
 			mach.EvRemove1(e, ss.Orienting, nil)
 		}()
 
+		// answer to a pending confirmation (1-based)
+		if i := shared.NumRef(prompt); i > 0 {
+			if move := a.orientingConfirmed(e, i-1); move != nil {
+				a.MoveOrienting.Store(move)
+				return
+			}
+		}
+
+		// resolve locally, weak matches fall back to the LLM
+		if res := a.matchLocal(ss.Orienting, prompt, candidates); res != nil && res.Score >= cfg.Confirm {
+			a.orientingBands(e, prompt, []sa.OrientingMove{{
+				Move:      res.ID,
+				Reasoning: "local match: " + string(res.Method),
+				Certainty: res.Score,
+			}}, nil)
+			return
+		}
+
+		// cached decision
+		d := a.decisionNew(ss.Orienting, prompt, params.MovesAgent, params.MovesStories)
+		if cached, ok := a.decisionGet(ctx, d); ok {
+			a.movesConfirm.Store(nil)
+			var move *sa.OrientingMove
+			if err := json.Unmarshal([]byte(cached), &move); err != nil || move == nil {
+				a.Log("orienting rejected", "cached", true)
+				return
+			}
+			a.MoveOrienting.Store(move)
+			return
+		}
+
 		// run the prompt (checks ctx)
 		resp, err := llm.Exec(e, params)
 		if ctx.Err() != nil {
@@ -337,16 +651,11 @@ func (a *AgentLLM) OrientingState(e *am.Event) {
 			mach.EvAddErrState(e, ss.ErrAI, err, nil)
 			return
 		}
-
-		if resp.Certainty < 0.8 {
-			return
-		}
 		if tick != mach.Tick(ss.Orienting) {
 			return
 		}
 
-		// store
-		a.MoveOrienting.Store(resp)
+		a.orientingBands(e, prompt, resp.Ranked(), d)
 	}()
 }
 
@@ -398,6 +707,18 @@ func (a *AgentLLM) OrientingMoveState(e *am.Event) {
 	}
 }
 
+// RewoundState drops the prompts' history since the rewind point. Agents with own prompts should call this super
+// handler.
+func (a *AgentLLM) RewoundState(e *am.Event) {
+	point := shared.ParseArgs(e.Args).Rewind
+	if point == nil {
+		return
+	}
+	for _, p := range []secai.PromptApi{a.PCheckingMenuRefs, a.POrienting} {
+		p.HistRewind(point.HTime)
+	}
+}
+
 func (a *AgentLLM) RestoreCharacterState(e *am.Event) {
 	mach := a.Mach()
 	ctx := mach.NewStateCtx(ss.RestoreCharacter)
@@ -509,16 +830,24 @@ func (a *AgentLLM) RestoreResourcesState(e *am.Event) {
 			mach.EvAddErrState(e, ss.ErrDB, err, nil)
 			return
 		}
-		if len(dbRes) == 0 {
-			mach.EvAdd1(e, ss.GenResources, nil)
-		} else {
 
-			res := &sa.ResultGenResources{
-				Phrases: make(map[string][]string),
-			}
-			for _, r := range dbRes {
-				res.Phrases[r.Key] = append(res.Phrases[r.Key], r.Value)
+		// group by locale
+		all := map[string]*sa.ResultGenResources{}
+		for _, r := range dbRes {
+			locale := cmp.Or(r.Locale, i18n.Default)
+			if all[locale] == nil {
+				all[locale] = &sa.ResultGenResources{
+					Phrases: make(map[string][]string),
+				}
 			}
+			all[locale].Phrases[r.Key] = append(all[locale].Phrases[r.Key], r.Value)
+		}
+		a.resources.Store(&all)
+
+		res := a.resourcesFor(a.Locale())
+		if res == nil {
+			mach.EvAdd1(e, ss.GenResources, nil)
+		} else {
 			a.Resources.Store(res)
 
 			// next
@@ -556,7 +885,7 @@ type A struct {
 	*shared.A
 
 	// agent's args
-	Move *sa.ResultOrienting `log:"move"`
+	Move *sa.OrientingMove `log:"move"`
 
 	// agent's non-RPC args
 
@@ -577,7 +906,7 @@ type ARPC struct {
 	*shared.A
 
 	// agent's args
-	Move *sa.ResultOrienting `log:"move"`
+	Move *sa.OrientingMove `log:"move"`
 }
 
 // ParseArgs extracts A from [am.Event.Args][APrefix] (decoder).
@@ -0,0 +1,137 @@
+package agent_llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/agent_llm/db/sqlc"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// DECISION CACHE
+
+// ///// ///// /////
+
+// decision is a cache entry of an LLM decision for a normalized prompt, within the context of available moves and
+// the memory schema.
+type decision struct {
+	Kind       string
+	Prompt     string
+	Key        string
+	MovesHash  string
+	SchemaHash string
+}
+
+// decisionNew returns a cache entry for [prompt], or nil if the cache is disabled.
+func (a *AgentLLM) decisionNew(kind, prompt string, moves ...map[string]string) *decision {
+	if a.ConfigBase().Agent.Orienting.CacheTTL <= 0 || a.Matcher == nil {
+		return nil
+	}
+	norm := a.Matcher.Normalize(prompt)
+	if norm == "" {
+		return nil
+	}
+
+	// moves
+	h := sha256.New()
+	for _, m := range moves {
+		for _, name := range slices.Sorted(maps.Keys(m)) {
+			_, _ = fmt.Fprintf(h, "%s=%s\n", name, m[name])
+		}
+	}
+	d := &decision{
+		Kind:       kind,
+		Prompt:     norm,
+		MovesHash:  hex.EncodeToString(h.Sum(nil)),
+		SchemaHash: schemaHash(a.AgentImpl().MachMem()),
+	}
+
+	// key
+	h.Reset()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%s\n%s", d.Kind, d.Prompt, d.MovesHash, d.SchemaHash)
+	d.Key = hex.EncodeToString(h.Sum(nil))
+
+	return d
+}
+
+// decisionGet returns a cached JSON result of [d].
+func (a *AgentLLM) decisionGet(ctx context.Context, d *decision) (string, bool) {
+	mach := a.Mach()
+	if d == nil || mach.Not1(ss.BaseDBReady) {
+		return "", false
+	}
+	q := a.Queries()
+	ttl := a.ConfigBase().Agent.Orienting.CacheTTL
+
+	// invalidate on schema changes
+	if last, _ := a.cacheSchema.Swap(d.SchemaHash).(string); last != d.SchemaHash {
+		err := q.DeleteStaleDecisions(ctx, sqlc.DeleteStaleDecisionsParams{
+			SchemaHash: d.SchemaHash,
+			CreatedAt:  time.Now().Add(-ttl),
+		})
+		if err != nil {
+			mach.AddErrState(ss.ErrDB, err, nil)
+		}
+	}
+
+	row, err := q.GetDecision(ctx, sqlc.GetDecisionParams{
+		Key:       d.Key,
+		CreatedAt: time.Now().Add(-ttl),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false
+	} else if err != nil {
+		mach.AddErrState(ss.ErrDB, err, nil)
+		return "", false
+	}
+	mach.Log("decision cache hit: %s %q -> %s", d.Kind, d.Prompt, row.Result)
+
+	return row.Result, true
+}
+
+// decisionSet caches a JSON [result] of [d].
+func (a *AgentLLM) decisionSet(e *am.Event, d *decision, result string) {
+	if d == nil {
+		return
+	}
+
+	a.Mach().EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			return sqlc.New(a.DBTX(tx)).AddDecision(ctx, sqlc.AddDecisionParams{
+				Key:        d.Key,
+				Kind:       d.Kind,
+				Prompt:     d.Prompt,
+				MovesHash:  d.MovesHash,
+				SchemaHash: d.SchemaHash,
+				Result:     result,
+				CreatedAt:  time.Now(),
+			})
+		},
+	}}))
+}
+
+// schemaHash returns a hash of the schema of [mach], or an empty string.
+func schemaHash(mach *am.Machine) string {
+	if mach == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	schema := mach.Schema()
+	for _, name := range slices.Sorted(maps.Keys(schema)) {
+		_, _ = fmt.Fprintf(h, "%s:%v\n", name, schema[name])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,12 @@
+-- generated character and resources (phrases)
+CREATE TABLE IF NOT EXISTS characters
+(
+    id     integer PRIMARY KEY AUTOINCREMENT,
+    result text NOT NULL
+);
+CREATE TABLE IF NOT EXISTS resources
+(
+    id    integer PRIMARY KEY AUTOINCREMENT,
+    key   text NOT NULL,
+    value text NOT NULL
+);
@@ -0,0 +1,12 @@
+-- moves confirmed by the user, usable as training examples for orienting
+-- candidates is a JSON list of all the offered moves
+CREATE TABLE IF NOT EXISTS orienting_examples
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL,
+    prompt     text     NOT NULL,
+    move       text     NOT NULL,
+    certainty  real     NOT NULL,
+    candidates text     NOT NULL,
+    created_at datetime NOT NULL
+);
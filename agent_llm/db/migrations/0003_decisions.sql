@@ -0,0 +1,14 @@
+-- cached LLM decisions, keyed by a hash of the kind, normalized prompt, moves_hash and schema_hash
+-- result is JSON
+CREATE TABLE IF NOT EXISTS decisions
+(
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    key         text     NOT NULL,
+    kind        text     NOT NULL,
+    prompt      text     NOT NULL,
+    moves_hash  text     NOT NULL,
+    schema_hash text     NOT NULL,
+    result      text     NOT NULL,
+    created_at  datetime NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS decision_key ON decisions (key);
@@ -0,0 +1,3 @@
+-- locale of resources, eg "en" or "pl-PL"
+ALTER TABLE resources ADD COLUMN locale text NOT NULL DEFAULT ('en');
+CREATE INDEX IF NOT EXISTS idx_resources_locale ON resources (locale);
@@ -0,0 +1,15 @@
+-- durable facts about the user (eg allergies, equipment, preferences), extracted from conversations
+-- key is a hash of the normalized fact, source is the user's message the fact was extracted from
+CREATE TABLE IF NOT EXISTS facts
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    key        text     NOT NULL,
+    category   text     NOT NULL,
+    fact       text     NOT NULL,
+    source     text     NOT NULL,
+    session_id text     NOT NULL,
+    confidence real     NOT NULL,
+    expires_at datetime,
+    created_at datetime NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS fact_key ON facts (key);
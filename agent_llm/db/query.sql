@@ -18,10 +18,72 @@ SELECT *
 FROM resources;
 
 -- name: AddResource :one
-INSERT INTO resources (key, value)
-VALUES (?, ?)
+INSERT INTO resources (key, value, locale)
+VALUES (?, ?, ?)
 RETURNING id;
 
 -- name: DeleteAllResources :exec
 DELETE
-FROM resources;
\ No newline at end of file
+FROM resources;
+
+-- name: AddOrientingExample :one
+INSERT INTO orienting_examples (session_id, prompt, move, certainty, candidates, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ListOrientingExamples :many
+SELECT *
+FROM orienting_examples
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: GetDecision :one
+SELECT *
+FROM decisions
+WHERE key = ?
+  AND created_at > ?
+LIMIT 1;
+
+-- name: AddDecision :exec
+INSERT INTO decisions (key, kind, prompt, moves_hash, schema_hash, result, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET result     = excluded.result,
+                                created_at = excluded.created_at;
+
+-- name: DeleteStaleDecisions :exec
+DELETE
+FROM decisions
+WHERE schema_hash != ?
+   OR created_at < ?;
+
+-- name: AddFact :exec
+INSERT INTO facts (key, category, fact, source, session_id, confidence, expires_at, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET category   = excluded.category,
+                                source     = excluded.source,
+                                session_id = excluded.session_id,
+                                confidence = max(confidence, excluded.confidence),
+                                expires_at = excluded.expires_at,
+                                created_at = excluded.created_at;
+
+-- name: ListFacts :many
+SELECT *
+FROM facts
+WHERE expires_at IS NULL
+   OR expires_at > ?
+ORDER BY confidence DESC, id DESC
+LIMIT ?;
+
+-- name: DeleteFact :exec
+DELETE
+FROM facts
+WHERE key = ?;
+
+-- name: DeleteExpiredFacts :exec
+DELETE
+FROM facts
+WHERE expires_at <= ?;
+
+-- name: DeleteAllFacts :exec
+DELETE
+FROM facts;
@@ -7,6 +7,8 @@ package sqlc
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const addCharacter = `-- name: AddCharacter :one
@@ -22,19 +24,115 @@ func (q *Queries) AddCharacter(ctx context.Context, result string) (int64, error
 	return id, err
 }
 
+const addDecision = `-- name: AddDecision :exec
+INSERT INTO decisions (key, kind, prompt, moves_hash, schema_hash, result, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET result     = excluded.result,
+                                created_at = excluded.created_at
+`
+
+type AddDecisionParams struct {
+	Key        string    `json:"key"`
+	Kind       string    `json:"kind"`
+	Prompt     string    `json:"prompt"`
+	MovesHash  string    `json:"moves_hash"`
+	SchemaHash string    `json:"schema_hash"`
+	Result     string    `json:"result"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (q *Queries) AddDecision(ctx context.Context, arg AddDecisionParams) error {
+	_, err := q.db.ExecContext(ctx, addDecision,
+		arg.Key,
+		arg.Kind,
+		arg.Prompt,
+		arg.MovesHash,
+		arg.SchemaHash,
+		arg.Result,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const addFact = `-- name: AddFact :exec
+INSERT INTO facts (key, category, fact, source, session_id, confidence, expires_at, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET category   = excluded.category,
+                                source     = excluded.source,
+                                session_id = excluded.session_id,
+                                confidence = max(confidence, excluded.confidence),
+                                expires_at = excluded.expires_at,
+                                created_at = excluded.created_at
+`
+
+type AddFactParams struct {
+	Key        string       `json:"key"`
+	Category   string       `json:"category"`
+	Fact       string       `json:"fact"`
+	Source     string       `json:"source"`
+	SessionID  string       `json:"session_id"`
+	Confidence float64      `json:"confidence"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (q *Queries) AddFact(ctx context.Context, arg AddFactParams) error {
+	_, err := q.db.ExecContext(ctx, addFact,
+		arg.Key,
+		arg.Category,
+		arg.Fact,
+		arg.Source,
+		arg.SessionID,
+		arg.Confidence,
+		arg.ExpiresAt,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const addOrientingExample = `-- name: AddOrientingExample :one
+INSERT INTO orienting_examples (session_id, prompt, move, certainty, candidates, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type AddOrientingExampleParams struct {
+	SessionID  string    `json:"session_id"`
+	Prompt     string    `json:"prompt"`
+	Move       string    `json:"move"`
+	Certainty  float64   `json:"certainty"`
+	Candidates string    `json:"candidates"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (q *Queries) AddOrientingExample(ctx context.Context, arg AddOrientingExampleParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, addOrientingExample,
+		arg.SessionID,
+		arg.Prompt,
+		arg.Move,
+		arg.Certainty,
+		arg.Candidates,
+		arg.CreatedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const addResource = `-- name: AddResource :one
-INSERT INTO resources (key, value)
-VALUES (?, ?)
+INSERT INTO resources (key, value, locale)
+VALUES (?, ?, ?)
 RETURNING id
 `
 
 type AddResourceParams struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Locale string `json:"locale"`
 }
 
 func (q *Queries) AddResource(ctx context.Context, arg AddResourceParams) (int64, error) {
-	row := q.db.QueryRowContext(ctx, addResource, arg.Key, arg.Value)
+	row := q.db.QueryRowContext(ctx, addResource, arg.Key, arg.Value, arg.Locale)
 	var id int64
 	err := row.Scan(&id)
 	return id, err
@@ -50,6 +148,16 @@ func (q *Queries) DeleteAllCharacter(ctx context.Context) error {
 	return err
 }
 
+const deleteAllFacts = `-- name: DeleteAllFacts :exec
+DELETE
+FROM facts
+`
+
+func (q *Queries) DeleteAllFacts(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllFacts)
+	return err
+}
+
 const deleteAllResources = `-- name: DeleteAllResources :exec
 DELETE
 FROM resources
@@ -60,6 +168,45 @@ func (q *Queries) DeleteAllResources(ctx context.Context) error {
 	return err
 }
 
+const deleteExpiredFacts = `-- name: DeleteExpiredFacts :exec
+DELETE
+FROM facts
+WHERE expires_at <= ?
+`
+
+func (q *Queries) DeleteExpiredFacts(ctx context.Context, expiresAt sql.NullTime) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredFacts, expiresAt)
+	return err
+}
+
+const deleteFact = `-- name: DeleteFact :exec
+DELETE
+FROM facts
+WHERE key = ?
+`
+
+func (q *Queries) DeleteFact(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteFact, key)
+	return err
+}
+
+const deleteStaleDecisions = `-- name: DeleteStaleDecisions :exec
+DELETE
+FROM decisions
+WHERE schema_hash != ?
+   OR created_at < ?
+`
+
+type DeleteStaleDecisionsParams struct {
+	SchemaHash string    `json:"schema_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (q *Queries) DeleteStaleDecisions(ctx context.Context, arg DeleteStaleDecisionsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStaleDecisions, arg.SchemaHash, arg.CreatedAt)
+	return err
+}
+
 const getCharacter = `-- name: GetCharacter :one
 SELECT id, result
 FROM characters
@@ -74,8 +221,37 @@ func (q *Queries) GetCharacter(ctx context.Context) (Character, error) {
 	return i, err
 }
 
+const getDecision = `-- name: GetDecision :one
+SELECT id, "key", kind, prompt, moves_hash, schema_hash, result, created_at
+FROM decisions
+WHERE key = ?
+  AND created_at > ?
+LIMIT 1
+`
+
+type GetDecisionParams struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) GetDecision(ctx context.Context, arg GetDecisionParams) (Decision, error) {
+	row := q.db.QueryRowContext(ctx, getDecision, arg.Key, arg.CreatedAt)
+	var i Decision
+	err := row.Scan(
+		&i.ID,
+		&i.Key,
+		&i.Kind,
+		&i.Prompt,
+		&i.MovesHash,
+		&i.SchemaHash,
+		&i.Result,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getResources = `-- name: GetResources :many
-SELECT id, "key", value
+SELECT id, "key", value, locale
 FROM resources
 `
 
@@ -88,7 +264,97 @@ func (q *Queries) GetResources(ctx context.Context) ([]Resource, error) {
 	var items []Resource
 	for rows.Next() {
 		var i Resource
-		if err := rows.Scan(&i.ID, &i.Key, &i.Value); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Key,
+			&i.Value,
+			&i.Locale,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFacts = `-- name: ListFacts :many
+SELECT id, "key", category, fact, source, session_id, confidence, expires_at, created_at
+FROM facts
+WHERE expires_at IS NULL
+   OR expires_at > ?
+ORDER BY confidence DESC, id DESC
+LIMIT ?
+`
+
+type ListFactsParams struct {
+	ExpiresAt sql.NullTime `json:"expires_at"`
+	Limit     int64        `json:"limit"`
+}
+
+func (q *Queries) ListFacts(ctx context.Context, arg ListFactsParams) ([]Fact, error) {
+	rows, err := q.db.QueryContext(ctx, listFacts, arg.ExpiresAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Fact
+	for rows.Next() {
+		var i Fact
+		if err := rows.Scan(
+			&i.ID,
+			&i.Key,
+			&i.Category,
+			&i.Fact,
+			&i.Source,
+			&i.SessionID,
+			&i.Confidence,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrientingExamples = `-- name: ListOrientingExamples :many
+SELECT id, session_id, prompt, move, certainty, candidates, created_at
+FROM orienting_examples
+ORDER BY id DESC
+LIMIT ?
+`
+
+func (q *Queries) ListOrientingExamples(ctx context.Context, limit int64) ([]OrientingExample, error) {
+	rows, err := q.db.QueryContext(ctx, listOrientingExamples, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OrientingExample
+	for rows.Next() {
+		var i OrientingExample
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Prompt,
+			&i.Move,
+			&i.Certainty,
+			&i.Candidates,
+			&i.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
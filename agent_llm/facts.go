@@ -0,0 +1,328 @@
+package agent_llm
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai"
+	"github.com/pancsta/secai/agent_llm/db/sqlc"
+	sa "github.com/pancsta/secai/agent_llm/schema"
+	"github.com/pancsta/secai/i18n"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// FACTS
+
+// ///// ///// /////
+
+const (
+	// factActionPrefix prefixes IDs of [AgentLLM.FactActions].
+	factActionPrefix = "fact-"
+	// factActionList toggles the list of facts in [AgentLLM.FactActions].
+	factActionList = factActionPrefix + "list"
+)
+
+// userFacts are the known facts about the user, ordered by certainty.
+type userFacts struct {
+	mx    sync.Mutex
+	list  []sqlc.Fact
+	shown bool
+}
+
+// Facts returns the known facts about the user.
+func (a *AgentLLM) Facts() []sqlc.Fact {
+	a.facts.mx.Lock()
+	defer a.facts.mx.Unlock()
+
+	return slices.Clone(a.facts.list)
+}
+
+// FactActions returns a button toggling the list of known facts, followed by a button per fact, which forgets it.
+// Meant to be appended to [shared.AgentAPI.Actions] and handled with [AgentLLM.FactAction].
+func (a *AgentLLM) FactActions() []shared.ActionInfo {
+	a.facts.mx.Lock()
+	defer a.facts.mx.Unlock()
+	if a.Mach().Not1(ss.FactsReady) || len(a.facts.list) == 0 {
+		return nil
+	}
+
+	ret := []shared.ActionInfo{{
+		ID:           factActionList,
+		Label:        a.T(i18n.KeyFacts, len(a.facts.list)),
+		Action:       true,
+		VisibleAgent: true,
+		VisibleMem:   true,
+	}}
+	if !a.facts.shown {
+		return ret
+	}
+	for _, f := range a.facts.list {
+		ret = append(ret, shared.ActionInfo{
+			ID:           factActionPrefix + f.Key,
+			Label:        f.Fact,
+			Desc:         fmt.Sprintf("%s (%.0f%%)", f.Category, f.Confidence*100),
+			Action:       true,
+			VisibleAgent: true,
+			VisibleMem:   true,
+		})
+	}
+
+	return ret
+}
+
+// FactAction toggles the list of facts, or forgets a fact listed via [AgentLLM.FactActions]. Returns false for
+// unknown IDs.
+func (a *AgentLLM) FactAction(e *am.Event, id string) bool {
+	key, ok := strings.CutPrefix(id, factActionPrefix)
+	if !ok {
+		return false
+	}
+	if id == factActionList {
+		a.facts.mx.Lock()
+		a.facts.shown = !a.facts.shown
+		a.facts.mx.Unlock()
+		return true
+	}
+
+	return a.Mach().EvAdd1(e, ss.FactForget, Pass(&A{A: &shared.A{ID: key}})) != am.Canceled
+}
+
+// private
+
+// factKey returns a key of a normalized fact, used for deduplication.
+func (a *AgentLLM) factKey(text string) string {
+	norm := strings.ToLower(strings.TrimSpace(text))
+	if a.Matcher != nil {
+		norm = a.Matcher.Normalize(text)
+	}
+	h := sha256.Sum256([]byte(norm))
+
+	return hex.EncodeToString(h[:8])
+}
+
+// factsSet replaces the known facts and recalls the most certain ones into [AgentLLM.DocFacts].
+func (a *AgentLLM) factsSet(list []sqlc.Fact) {
+	slices.SortStableFunc(list, func(f1, f2 sqlc.Fact) int {
+		return cmp.Compare(f2.Confidence, f1.Confidence)
+	})
+	a.facts.mx.Lock()
+	a.facts.list = list
+	if len(list) == 0 {
+		a.facts.shown = false
+	}
+	a.facts.mx.Unlock()
+
+	// recall
+	if a.DocFacts == nil {
+		return
+	}
+	a.DocFacts.Clear()
+	for i, f := range list {
+		if i >= a.ConfigBase().Agent.Facts.Recall {
+			break
+		}
+		a.DocFacts.AddPart("- " + f.Fact)
+	}
+}
+
+// ///// ///// /////
+
+// ///// HANDLERS
+
+// ///// ///// /////
+
+// PromptState extracts facts from the user's prompt. Agents overriding the Prompt state should call this super
+// handler.
+func (a *AgentLLM) PromptState(e *am.Event) {
+	// call super
+	a.AgentBase.PromptState(e)
+
+	prompt := ParseArgs(e.Args).Prompt
+	if !a.ConfigBase().Agent.Facts.Extract || prompt == "" || shared.NumRef(prompt) > 0 {
+		return
+	}
+	a.Mach().EvAdd1(e, ss.ExtractingFacts, Pass(&A{A: &shared.A{Prompt: prompt}}))
+}
+
+func (a *AgentLLM) RestoreFactsState(e *am.Event) {
+	mach := a.Mach()
+	ctx := mach.NewStateCtx(ss.RestoreFacts)
+	now := time.Now()
+
+	go func() {
+		if ctx.Err() != nil {
+			return // expired
+		}
+
+		// restore
+		list, err := a.Queries().ListFacts(ctx, sqlc.ListFactsParams{
+			ExpiresAt: sql.NullTime{Time: now, Valid: true},
+			Limit:     -1,
+		})
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			mach.EvAddErrState(e, ss.ErrDB, err, nil)
+			return
+		}
+		a.factsSet(list)
+
+		// clean up
+		mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+			DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+				return sqlc.New(a.DBTX(tx)).DeleteExpiredFacts(ctx, sql.NullTime{Time: now, Valid: true})
+			},
+		}}))
+
+		// next
+		mach.EvAdd1(e, ss.FactsReady, nil)
+	}()
+}
+
+func (a *AgentLLM) FactsReadyState(e *am.Event) {
+	// attach to prompts which depend on the user
+	a.DocFacts = secai.NewDocument("Facts about the user")
+	a.DocFacts.AddToPrompts(a.POrienting)
+	a.factsSet(a.Facts())
+}
+
+func (a *AgentLLM) FactsReadyEnd(e *am.Event) {
+	a.factsSet(nil)
+}
+
+func (a *AgentLLM) ExtractingFactsEnter(e *am.Event) bool {
+	return ParseArgs(e.Args).Prompt != ""
+}
+
+// ExtractingFactsState runs in the background of the user's prompt, so errors are only logged.
+func (a *AgentLLM) ExtractingFactsState(e *am.Event) {
+	mach := a.Mach()
+	// use multi-state context here on purpose
+	ctx := mach.NewStateCtx(ss.ExtractingFacts)
+	llm := a.PExtractingFacts
+	cfg := a.ConfigBase().Agent.Facts
+	prompt := ParseArgs(e.Args).Prompt
+	sessID := a.SessionID()
+
+	params := sa.ParamsExtractingFacts{Prompt: prompt}
+	for _, f := range a.Facts() {
+		params.Known = append(params.Known, f.Fact)
+	}
+
+	// unblock
+	go func() {
+		defer mach.EvRemove1(e, ss.ExtractingFacts, nil)
+		if ctx.Err() != nil {
+			return // expired
+		}
+
+		// run the prompt (checks ctx)
+		resp, err := llm.Exec(e, params)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			a.Log("extracting facts failed", "err", err)
+			return
+		}
+
+		// merge
+		list := a.Facts()
+		var noted []string
+		for _, f := range resp.Facts {
+			f.Text = strings.TrimSpace(f.Text)
+			if f.Text == "" || f.Certainty < cfg.MinCertainty {
+				continue
+			}
+			now := time.Now()
+			fact := sqlc.Fact{
+				Key:        a.factKey(f.Text),
+				Category:   f.Category,
+				Fact:       f.Text,
+				Source:     prompt,
+				SessionID:  sessID,
+				Confidence: f.Certainty,
+				CreatedAt:  now,
+			}
+			if f.TTLDays > 0 {
+				fact.ExpiresAt = sql.NullTime{Time: now.AddDate(0, 0, f.TTLDays), Valid: true}
+			}
+			i := slices.IndexFunc(list, func(f sqlc.Fact) bool {
+				return f.Key == fact.Key
+			})
+			if i >= 0 {
+				fact.Confidence = max(fact.Confidence, list[i].Confidence)
+				list[i] = fact
+			} else {
+				list = append(list, fact)
+				noted = append(noted, fact.Fact)
+			}
+
+			mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+				DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+					return sqlc.New(a.DBTX(tx)).AddFact(ctx, sqlc.AddFactParams{
+						Key:        fact.Key,
+						Category:   fact.Category,
+						Fact:       fact.Fact,
+						Source:     fact.Source,
+						SessionID:  fact.SessionID,
+						Confidence: fact.Confidence,
+						ExpiresAt:  fact.ExpiresAt,
+						CreatedAt:  fact.CreatedAt,
+					})
+				},
+			}}))
+		}
+		if len(resp.Facts) == 0 || mach.Not1(ss.FactsReady) {
+			return
+		}
+		a.factsSet(list)
+
+		if len(noted) > 0 {
+			a.Output(a.T(i18n.KeyFactNoted, strings.Join(noted, "; ")), shared.FromSystem)
+		}
+	}()
+}
+
+func (a *AgentLLM) FactForgetEnter(e *am.Event) bool {
+	key := ParseArgs(e.Args).ID
+	return slices.ContainsFunc(a.Facts(), func(f sqlc.Fact) bool {
+		return f.Key == key
+	})
+}
+
+func (a *AgentLLM) FactForgetState(e *am.Event) {
+	mach := a.Mach()
+	defer mach.EvRemove1(e, ss.FactForget, nil)
+	key := ParseArgs(e.Args).ID
+
+	list := a.Facts()
+	i := slices.IndexFunc(list, func(f sqlc.Fact) bool {
+		return f.Key == key
+	})
+	if i < 0 {
+		return
+	}
+	fact := list[i]
+	a.factsSet(slices.Delete(list, i, i+1))
+
+	mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{A: &shared.A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			return sqlc.New(a.DBTX(tx)).DeleteFact(ctx, key)
+		},
+	}}))
+	a.Output(a.T(i18n.KeyFactForgotten, fact.Fact), shared.FromSystem)
+}
@@ -0,0 +1,13 @@
+package agent_llm
+
+import (
+	"embed"
+
+	"github.com/pancsta/secai/db"
+)
+
+//go:embed db/migrations/*.sql
+var migrationsFS embed.FS
+
+// Migrations are the migrations of the AgentLLM's tables, applied to the base DB.
+var Migrations = db.MustLoadMigrations("agent_llm", migrationsFS, "db/migrations")
@@ -4,7 +4,9 @@
 package schema
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 
 	"github.com/pancsta/secai"
 	"github.com/pancsta/secai/agent_llm/states"
@@ -127,8 +129,9 @@ func NewPromptOrienting(agent shared.AgentBaseAPI) *PromptOrienting {
 		agent, ss.Orienting, `
 			- You're a text matcher in a board game.
 		`, `
-			1. Try to extract a choice from the user, based on provided lists of MovesCooking and MovesStory. 
+			1. Try to extract a choice from the user, based on provided lists of MovesAgent and MovesStories. 
 			2. Distinguish past and present tense in the prompt, when choosing the right cooking step.
+			3. Rank up to MaxMoves possible moves, most likely first, each with its own certainty.
 			
 			Examples:
 			- "rice cooked" is "StepRiceCooked"
@@ -149,18 +152,88 @@ type ParamsOrienting struct {
 	MovesAgent map[string]string
 	// List of possible stories to switch to and their descriptions.
 	MovesStories map[string]string
+	// Maximum number of ranked moves to return.
+	MaxMoves int
 }
 
 // TODO add Removing
 type ResultOrienting struct {
+	// Moves are the ranked choices of the user, most likely first.
+	Moves []OrientingMove
+}
+
+// Ranked returns valid moves sorted by certainty (highest first).
+func (r ResultOrienting) Ranked() []OrientingMove {
+	ret := slices.DeleteFunc(slices.Clone(r.Moves), func(m OrientingMove) bool {
+		return m.Move == ""
+	})
+	slices.SortStableFunc(ret, func(a, b OrientingMove) int {
+		return cmp.Compare(b.Certainty, a.Certainty)
+	})
+
+	return ret
+}
+
+func (r ResultOrienting) String() string {
+	return fmt.Sprintf("%v", r.Ranked())
+}
+
+type OrientingMove struct {
 	// Users choice
 	Move string
 	// TODO debug
 	Reasoning string
-	// Certainty is the probability that the next move is correct.
+	// Certainty is the probability that this move is correct.
 	Certainty float64
 }
 
-func (r ResultOrienting) String() string {
-	return fmt.Sprintf("%s@%.2f", r.Move, r.Certainty)
+func (m OrientingMove) String() string {
+	return fmt.Sprintf("%s@%.2f", m.Move, m.Certainty)
+}
+
+// FACTS
+
+type PromptExtractingFacts = secai.Prompt[ParamsExtractingFacts, ResultExtractingFacts]
+
+func NewPromptExtractingFacts(agent shared.AgentBaseAPI) *PromptExtractingFacts {
+	p := secai.NewPrompt[ParamsExtractingFacts, ResultExtractingFacts](
+		agent, ss.ExtractingFacts, `
+			- You're a memory of a personal assistant, which remembers facts about the user.
+		`, `
+			1. Extract durable facts about the user from the prompt, eg allergies, diets, kitchen equipment, likes and dislikes.
+			2. Ignore one-time requests, questions and facts about anything else than the user.
+			3. Skip facts already present in Known, unless the prompt changes them.
+			4. Write each fact as a short sentence in the 3rd person, eg "The user is allergic to peanuts".
+		`, `
+			Return an empty list if there are no new facts. Assign each fact a certainty and a number of days it stays valid (0 for permanent facts).
+		`)
+
+	// each prompt is independent
+	p.HistoryMsgLen = 0
+	return p
+}
+
+type ParamsExtractingFacts struct {
+	Prompt string
+	// Facts already known about the user.
+	Known []string
+}
+
+type ResultExtractingFacts struct {
+	Facts []Fact
+}
+
+type Fact struct {
+	// The fact as a short sentence.
+	Text string
+	// One of: allergy, diet, equipment, preference, other.
+	Category string
+	// Certainty is the probability that this fact is true and durable.
+	Certainty float64
+	// Number of days this fact stays valid, 0 means forever.
+	TTLDays int
+}
+
+func (f Fact) String() string {
+	return fmt.Sprintf("%s@%.2f", f.Text, f.Certainty)
 }
@@ -32,11 +32,21 @@ type AgentLLMStatesDef struct {
 	ResourcesReady   string
 
 	// The LLM is given possible moves and checks if the user wants to make any. Orienting usually runs in parallel with
-	// other prompts. After reaching the required level of certainty, it fills outs `h.MoveOrienting`.
+	// other prompts. After reaching the accepted level of certainty, it fills outs `h.MoveOrienting`. Mid-certainty
+	// moves are offered to the user for confirmation.
 	Orienting string
 	// OrientingMove performs a move decided upon by Orienting.
 	OrientingMove string
 
+	// RestoreFacts loads the facts about the user from the DB.
+	RestoreFacts string
+	// FactsReady means the known facts have been recalled into prompts.
+	FactsReady string
+	// ExtractingFacts pulls durable facts about the user from the passed prompt.
+	ExtractingFacts string
+	// FactForget deletes the fact passed via the ID arg.
+	FactForget string
+
 	// TODO ideally keep story related prompts here
 
 	*ss.AgentBaseStatesDef
@@ -48,6 +58,8 @@ type AgentLLMGroupsDef struct {
 	Character S
 	// All the states for resource generation.
 	Resources S
+	// All the states for restoring facts about the user.
+	Facts S
 }
 
 // AgentLLMSchema represents all relations and properties of AgentLLMStates.
@@ -84,6 +96,22 @@ var AgentLLMSchema = SchemaMerge(
 			Tags:    S{ss.TagPrompt, ss.TagTrigger},
 		},
 		ssL.ResourcesReady: {Remove: sgL.Resources},
+
+		ssL.RestoreFacts: {
+			Auto:    true,
+			Require: S{ssL.BaseDBReady},
+			Remove:  sgL.Facts,
+		},
+		ssL.FactsReady: {Remove: sgL.Facts},
+		ssL.ExtractingFacts: {
+			Multi:   true,
+			Require: S{ssL.FactsReady},
+			Tags:    S{ss.TagPrompt},
+		},
+		ssL.FactForget: {
+			Multi:   true,
+			Require: S{ssL.FactsReady},
+		},
 	})
 
 // EXPORTS AND GROUPS
@@ -93,6 +121,7 @@ var (
 	sgL = am.NewStateGroups(AgentLLMGroupsDef{
 		Character: S{ssL.CharacterReady, ssL.RestoreCharacter, ssL.GenCharacter},
 		Resources: S{ssL.ResourcesReady, ssL.RestoreResources, ssL.GenResources},
+		Facts:     S{ssL.FactsReady, ssL.RestoreFacts},
 	}, ss.AgentBaseGroups)
 
 	// AgentLLMStates contains all the states for the LLMAgent machine.
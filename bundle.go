@@ -0,0 +1,50 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/pancsta/secai/bundle"
+)
+
+// ///// ///// /////
+
+// ///// SESSION BUNDLE
+
+// ///// ///// /////
+
+// ExportBundle writes the agent's dir as a session bundle into [w], see [bundle.Export]. [cfg] is the full config of
+// the agent, defaults to [AgentBase.ConfigBase]. Secrets are stripped and queued writes flushed.
+func (a *AgentBase) ExportBundle(ctx context.Context, w io.Writer, cfg any) error {
+	if cfg == nil {
+		cfg = a.cfg
+	}
+	rawCfg, err := bundle.Redact(cfg)
+	if err != nil {
+		return err
+	}
+	if a.DbConn != nil {
+		if err := a.dbFlush(ctx); err != nil {
+			return err
+		}
+	}
+
+	m := &bundle.Manifest{
+		AgentID:   a.cfg.Agent.ID,
+		SessionID: a.sessionID,
+		Config:    rawCfg,
+	}
+	if a.agentImpl != nil {
+		m.Schema, m.States = a.agentImpl.MachSchema()
+	}
+	conns := []*sql.DB{a.DbConn, a.dbHist}
+	if a.agentImpl != nil {
+		conns = append(conns, a.agentImpl.DBAgent())
+	}
+
+	return bundle.Export(ctx, w, m, bundle.Opts{
+		Dir:   a.cfg.Agent.Dir,
+		Conns: conns,
+	})
+}
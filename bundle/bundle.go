@@ -0,0 +1,388 @@
+// Package bundle packages an agent's dir (SQLite DBs, prompts, values, transcripts and logs) into a single tar.gz
+// archive with a manifest, and imports it into a fresh dir for inspection or replay.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/db"
+)
+
+// Version is the version of the bundle format.
+const Version = 1
+
+// ManifestFile is the name of the manifest inside the archive.
+const ManifestFile = "manifest.json"
+
+// ErrBundle means the archive is invalid or can't be imported.
+var ErrBundle = errors.New("invalid bundle")
+
+// DefaultPatterns are files of the agent's dir included in a bundle.
+var DefaultPatterns = []string{"*.sqlite", "*.jsonl", "prompts/*", "vals/*", "transcripts/*"}
+
+// secretFields are config fields stripped from the manifest.
+var secretFields = []string{"Key", "Token", "Secret", "Password"}
+
+// envFields are config lists of KEY=VALUE env vars, with values stripped from the manifest.
+var envFields = []string{"Env"}
+
+// urlFields are config URLs, with credentials and query values stripped from the manifest.
+var urlFields = []string{"URL"}
+
+// argsFields are config lists of command args, with KEY=VALUE values and values of secret flags stripped from the
+// manifest.
+var argsFields = []string{"Args"}
+
+// Manifest describes a bundle.
+type Manifest struct {
+	// Version is the version of the bundle format.
+	Version   int
+	AgentID   string
+	SessionID string
+	CreatedAt time.Time
+	// Config is the agent's config with secrets stripped.
+	Config json.RawMessage
+	// Migrations are the latest applied versions, per DB file and component.
+	Migrations map[string]map[string]int
+	// Schema is the machine schema of the agent.
+	Schema am.Schema
+	States am.S
+	// Files are the bundled files, relative to the agent's dir.
+	Files []string
+}
+
+type Opts struct {
+	// Dir is the agent's dir.
+	Dir string
+	// Patterns are globs of files to include, relative to Dir. Defaults to [DefaultPatterns].
+	Patterns []string
+	// Conns are open connections to SQLite files in Dir, matched by their paths. Other SQLite files are opened
+	// separately.
+	Conns []*sql.DB
+}
+
+// Export writes a tar.gz archive of [opts.Dir] into [w]. SQLite DBs are snapshotted with "VACUUM INTO", or copied when
+// locked. [m] is completed with files and schema versions.
+func Export(ctx context.Context, w io.Writer, m *Manifest, opts Opts) error {
+	patterns := opts.Patterns
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	var files []string
+	for _, p := range patterns {
+		matches, err := fs.Glob(os.DirFS(opts.Dir), p)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	tmpDir, err := os.MkdirTemp("", "secai-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// open DBs by path
+	conns := map[string]*sql.DB{}
+	for _, conn := range opts.Conns {
+		if conn == nil {
+			continue
+		}
+		var file string
+		err := conn.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file)
+		if err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			conns[abs] = conn
+		}
+	}
+
+	// snapshot DBs
+	m.Version = Version
+	m.Migrations = map[string]map[string]int{}
+	m.Files = nil
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	src := map[string]string{}
+	for _, file := range files {
+		full := filepath.Join(opts.Dir, file)
+		if info, err := os.Stat(full); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		src[file] = full
+		m.Files = append(m.Files, file)
+		if path.Ext(file) != ".sqlite" {
+			continue
+		}
+
+		snap := filepath.Join(tmpDir, strings.ReplaceAll(file, "/", "_"))
+		abs, _ := filepath.Abs(full)
+		versions, err := snapshot(ctx, conns[abs], full, snap)
+		if err != nil {
+			// locked, copy as-is
+			continue
+		}
+		src[file] = snap
+		if len(versions) > 0 {
+			m.Migrations[file] = versions
+		}
+	}
+
+	// write
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(tw, ManifestFile, manifest, m.CreatedAt); err != nil {
+		return err
+	}
+	for _, file := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := os.ReadFile(src[file])
+		if err != nil {
+			return err
+		}
+		if err := writeFile(tw, file, content, m.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// Import extracts a bundle from [r] into [dir], which has to be empty or missing. Returns the manifest.
+func Import(r io.Reader, dir string) (*Manifest, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%w: %s isn't empty", ErrBundle, dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBundle, err)
+	}
+	tr := tar.NewReader(gz)
+	var m *Manifest
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBundle, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(h.Name)
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("%w: invalid path %s", ErrBundle, h.Name)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if name == ManifestFile {
+			m = &Manifest{}
+			if err := json.Unmarshal(content, m); err != nil {
+				return nil, fmt.Errorf("%w: manifest: %w", ErrBundle, err)
+			}
+		}
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(full, content, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if m == nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrBundle, ManifestFile)
+	}
+	if m.Version > Version {
+		return m, fmt.Errorf("%w: unsupported version %d", ErrBundle, m.Version)
+	}
+
+	return m, nil
+}
+
+// Redact marshals [cfg] to JSON, with secret fields (eg API keys) stripped.
+func Redact(cfg any) (json.RawMessage, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(redact(v))
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			s, ok := val.(string)
+			switch {
+			case ok && s != "" && slices.Contains(secretFields, k):
+				v[k] = ""
+			case ok && s != "" && slices.Contains(urlFields, k):
+				v[k] = redactURL(s)
+			case slices.Contains(envFields, k):
+				v[k] = redactEnv(val)
+			case slices.Contains(argsFields, k):
+				v[k] = redactArgs(val)
+			default:
+				v[k] = redact(val)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+
+	return v
+}
+
+// redactURL strips the userinfo and query values of [s].
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{""}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
+
+// redactEnv strips the values of a list of KEY=VALUE env vars.
+func redactEnv(v any) any {
+	list, ok := v.([]any)
+	if !ok {
+		return redact(v)
+	}
+	for i, item := range list {
+		if s, ok := item.(string); ok {
+			key, _, _ := strings.Cut(s, "=")
+			list[i] = key + "="
+		}
+	}
+
+	return list
+}
+
+// redactArgs strips the values of KEY=VALUE args (eg "--api-key=…"), URL credentials, and args following a flag which
+// looks secret (eg "--token …").
+func redactArgs(v any) any {
+	list, ok := v.([]any)
+	if !ok {
+		return redact(v)
+	}
+	secretFlag := false
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			continue
+		}
+		isFlag := strings.HasPrefix(s, "-")
+		switch {
+		case secretFlag && !isFlag:
+			list[i] = ""
+		case strings.Contains(s, "://"):
+			list[i] = redactURL(s)
+		case strings.Contains(s, "="):
+			key, _, _ := strings.Cut(s, "=")
+			list[i] = key + "="
+		}
+		secretFlag = isFlag && !strings.Contains(s, "=") && isSecret(s)
+	}
+
+	return list
+}
+
+// isSecret returns true when [name] contains one of [secretFields], case-insensitive.
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range secretFields {
+		if strings.Contains(name, strings.ToLower(f)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// snapshot copies a consistent version of the [file] DB into [dst] and returns its schema versions. [conn] is an
+// optional open connection.
+func snapshot(ctx context.Context, conn *sql.DB, file, dst string) (map[string]int, error) {
+	if conn == nil {
+		var err error
+		if conn, err = db.Connect(file); err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+	}
+	if _, err := conn.ExecContext(ctx, "VACUUM INTO ?", dst); err != nil {
+		return nil, err
+	}
+
+	return db.Versions(ctx, conn)
+}
+
+func writeFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+
+	return err
+}
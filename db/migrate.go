@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMigration means a migration is invalid or failed to apply.
+var ErrMigration = errors.New("migration failed")
+
+// versionTable keeps applied migrations, per component.
+const versionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	component  text     NOT NULL,
+	version    integer  NOT NULL,
+	name       text     NOT NULL,
+	applied_at datetime NOT NULL,
+	PRIMARY KEY (component, version)
+);`
+
+// Migration is a single versioned schema change, read from a "0001_name.sql" file.
+type Migration struct {
+	Component string
+	Version   int
+	Name      string
+	SQL       string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%s/%04d_%s", m.Component, m.Version, m.Name)
+}
+
+// Migrations is an ordered list of migrations of a single component, eg "base" or "agent_llm". Components share a
+// DB file, but are versioned separately.
+type Migrations struct {
+	Component string
+	List      []Migration
+}
+
+// LoadMigrations reads "*.sql" files from [dir] of [fsys]. File names start with a unique version number.
+func LoadMigrations(component string, fsys fs.FS, dir string) (*Migrations, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Migrations{Component: component}
+	for _, file := range files {
+		num, name, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: invalid file name %s/%s", ErrMigration, component, file)
+		}
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		ret.List = append(ret.List, Migration{
+			Component: component,
+			Version:   version,
+			Name:      name,
+			SQL:       string(content),
+		})
+	}
+
+	slices.SortFunc(ret.List, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+	for i := 1; i < len(ret.List); i++ {
+		if ret.List[i].Version == ret.List[i-1].Version {
+			return nil, fmt.Errorf("%w: duplicate version %s", ErrMigration, ret.List[i])
+		}
+	}
+
+	return ret, nil
+}
+
+// MustLoadMigrations is [LoadMigrations] for embedded files.
+func MustLoadMigrations(component string, fsys fs.FS, dir string) *Migrations {
+	ret, err := LoadMigrations(component, fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return ret
+}
+
+// Pending returns migrations of [sets] which haven't been applied to [conn] yet.
+func Pending(ctx context.Context, conn *sql.DB, sets ...*Migrations) ([]Migration, error) {
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Migration
+	for _, set := range sets {
+		for _, m := range set.List {
+			if !applied[m.Component][m.Version] {
+				ret = append(ret, m)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Migrate applies pending migrations of [sets] in order, each one in a separate transaction. Returns the applied
+// migrations. With [dryRun], only returns the pending ones.
+func Migrate(ctx context.Context, conn *sql.DB, dryRun bool, sets ...*Migrations) ([]Migration, error) {
+	pending, err := Pending(ctx, conn, sets...)
+	if err != nil || dryRun {
+		return pending, err
+	}
+
+	if _, err := conn.ExecContext(ctx, versionTable); err != nil {
+		return nil, err
+	}
+	for i, m := range pending {
+		if err := apply(ctx, conn, m); err != nil {
+			return pending[:i], fmt.Errorf("%w: %s: %w", ErrMigration, m, err)
+		}
+	}
+
+	return pending, nil
+}
+
+func apply(ctx context.Context, conn *sql.DB, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (component, version, name, applied_at) VALUES (?, ?, ?, ?)`,
+		m.Component, m.Version, m.Name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Versions returns the latest applied version per component.
+func Versions(ctx context.Context, conn *sql.DB) (map[string]int, error) {
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]int{}
+	for component, versions := range applied {
+		for v := range versions {
+			ret[component] = max(ret[component], v)
+		}
+	}
+
+	return ret, nil
+}
+
+// appliedVersions returns applied versions per component, or none for a DB without the version table.
+func appliedVersions(ctx context.Context, conn *sql.DB) (map[string]map[int]bool, error) {
+	ret := map[string]map[int]bool{}
+
+	var exists int
+	err := conn.QueryRowContext(ctx,
+		`SELECT count(*) FROM sqlite_schema WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&exists)
+	if err != nil || exists == 0 {
+		return ret, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT component, version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var component string
+		var version int
+		if err := rows.Scan(&component, &version); err != nil {
+			return nil, err
+		}
+		if ret[component] == nil {
+			ret[component] = map[int]bool{}
+		}
+		ret[component][version] = true
+	}
+
+	return ret, rows.Err()
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	conn, err := Connect("file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fsys := fstest.MapFS{
+		"m/0002_bar.sql": {Data: []byte("ALTER TABLE foo ADD COLUMN bar text NOT NULL DEFAULT ('');")},
+		"m/0001_foo.sql": {Data: []byte("CREATE TABLE foo (id integer PRIMARY KEY);")},
+	}
+	set, err := LoadMigrations("test", fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.List) != 2 || set.List[0].Name != "foo" || set.List[1].Version != 2 {
+		t.Fatalf("wrong order: %v", set.List)
+	}
+
+	// dry run
+	pending, err := Migrate(ctx, conn, true, set)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("dry run: %v %v", pending, err)
+	}
+	if _, err := conn.Exec("SELECT * FROM foo"); err == nil {
+		t.Fatal("dry run applied migrations")
+	}
+
+	// apply
+	applied, err := Migrate(ctx, conn, false, set)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("apply: %v %v", applied, err)
+	}
+	if _, err := conn.Exec("INSERT INTO foo (id, bar) VALUES (1, 'x')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// idempotent
+	applied, err = Migrate(ctx, conn, false, set)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("re-apply: %v %v", applied, err)
+	}
+
+	// a failed migration is rolled back
+	fsys["m/0003_err.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE baz (id integer); SELECT * FROM nope;")}
+	set, _ = LoadMigrations("test", fsys, "m")
+	if _, err = Migrate(ctx, conn, false, set); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := conn.Exec("SELECT * FROM baz"); err == nil {
+		t.Fatal("failed migration not rolled back")
+	}
+	pending, _ = Pending(ctx, conn, set)
+	if len(pending) != 1 {
+		t.Fatalf("pending: %v", pending)
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	fsys := fstest.MapFS{"foo.sql": {Data: []byte("")}}
+	if _, err := LoadMigrations("test", fsys, "."); err == nil {
+		t.Fatal("expected an error")
+	}
+	fsys = fstest.MapFS{"0001_a.sql": {}, "1_b.sql": {}}
+	if _, err := LoadMigrations("test", fsys, "."); err == nil {
+		t.Fatal("expected a duplicate error")
+	}
+}
+
+func TestBaseMigrations(t *testing.T) {
+	conn, schema, err := Open(context.Background(), "file::memory:", BaseMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if schema == "" {
+		t.Fatal("empty schema")
+	}
+}
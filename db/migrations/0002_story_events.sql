@@ -0,0 +1,19 @@
+-- activations and deactivations of stories
+-- active is 1 for activations, active_ms and active_ticks are durations of deactivated stories
+CREATE TABLE IF NOT EXISTS story_events
+(
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    session_id    text     NOT NULL,
+    agent         text     NOT NULL,
+    state         text     NOT NULL,
+    active        integer  NOT NULL,
+    cause         text     NOT NULL,
+    active_ms     integer  NOT NULL,
+    active_ticks  integer  NOT NULL,
+    created_at    datetime NOT NULL,
+    mach_time_sum integer  NOT NULL,
+    mach_time     text     NOT NULL,
+    mem_time_sum  integer  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS story_session ON story_events (session_id);
+CREATE INDEX IF NOT EXISTS story_state ON story_events (state);
@@ -0,0 +1,13 @@
+-- chat transcript, prompt_id links assistant messages to the prompt which produced them
+CREATE TABLE IF NOT EXISTS messages
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL,
+    agent      text     NOT NULL,
+    sender     text     NOT NULL,
+    text       text     NOT NULL,
+    prompt_id  integer,
+    created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_session ON messages (session_id);
+CREATE INDEX IF NOT EXISTS messages_created ON messages (created_at);
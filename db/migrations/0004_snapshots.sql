@@ -0,0 +1,10 @@
+-- machine snapshots, one per session, used to resume the previous session after a restart
+CREATE TABLE IF NOT EXISTS snapshots
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL UNIQUE,
+    agent      text     NOT NULL,
+    data       text     NOT NULL,
+    created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS snapshots_agent ON snapshots (agent);
@@ -4,6 +4,12 @@ FROM prompts
 WHERE session_id = ?
 LIMIT 1;
 
+-- name: ListPromptsRecent :many
+SELECT *
+FROM prompts
+ORDER BY id DESC
+LIMIT ?;
+
 -- name: AddPrompt :one
 INSERT INTO prompts (session_id, agent, state, history_len, system, request, provider, model, created_at, mach_time_sum, mach_time)
 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -17,3 +23,122 @@ RETURNING id;
 
 -- name: DropPrompts :exec
 DROP TABLE prompts;
+
+-- name: AddStoryEvent :one
+INSERT INTO story_events (session_id, agent, state, active, cause, active_ms, active_ticks, created_at, mach_time_sum,
+                          mach_time, mem_time_sum)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ListStoryEvents :many
+SELECT *
+FROM story_events
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: ListStoryEventsByState :many
+SELECT *
+FROM story_events
+WHERE state = ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: GetStoryStats :one
+-- unknown durations (0) are skipped in the average
+SELECT COUNT(*)                                                AS runs,
+       CAST(COALESCE(AVG(NULLIF(active_ms, 0)), 0) AS INTEGER) AS avg_ms,
+       CAST(COALESCE(MAX(active_ms), 0) AS INTEGER)            AS max_ms,
+       CAST(COALESCE(SUM(active_ms), 0) AS INTEGER)            AS total_ms
+FROM story_events
+WHERE state = ?
+  AND active = 0;
+
+-- name: ListStoryPreceding :many
+SELECT prev.state, COUNT(*) AS count
+FROM story_events cur
+         JOIN story_events prev ON prev.id = (SELECT MAX(p.id)
+                                              FROM story_events p
+                                              WHERE p.id < cur.id
+                                                AND p.active = 1
+                                                AND p.session_id = cur.session_id)
+WHERE cur.state = ?
+  AND cur.active = 1
+GROUP BY prev.state
+ORDER BY count DESC;
+
+-- name: AddMessage :one
+INSERT INTO messages (session_id, agent, sender, text, prompt_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ListMessagesPrev :many
+SELECT *
+FROM messages
+WHERE session_id != ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: ListMessagesSince :many
+SELECT *
+FROM messages
+WHERE created_at >= ?
+ORDER BY id;
+
+-- name: ListMessagesBySession :many
+SELECT *
+FROM messages
+WHERE session_id = ?
+ORDER BY id;
+
+-- name: DeleteMessagesSince :exec
+DELETE
+FROM messages
+WHERE session_id = ?
+  AND created_at >= ?;
+
+-- name: SaveSnapshot :exec
+INSERT INTO snapshots (session_id, agent, data, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (session_id) DO UPDATE SET data       = excluded.data,
+                                       created_at = excluded.created_at;
+
+-- name: GetSnapshotPrev :one
+SELECT *
+FROM snapshots
+WHERE agent = ?
+  AND session_id != ?
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteSnapshots :exec
+DELETE
+FROM snapshots
+WHERE agent = ?;
+
+-- name: CountPromptsPurge :one
+SELECT COUNT(*)
+FROM prompts
+WHERE (sqlc.narg(session_id) IS NULL OR prompts.session_id = sqlc.narg(session_id))
+  AND (prompts.created_at < @before
+    OR prompts.id NOT IN (SELECT p.id FROM prompts p ORDER BY p.id DESC LIMIT @keep));
+
+-- name: DeletePromptsPurge :execrows
+DELETE
+FROM prompts
+WHERE (sqlc.narg(session_id) IS NULL OR prompts.session_id = sqlc.narg(session_id))
+  AND (prompts.created_at < @before
+    OR prompts.id NOT IN (SELECT p.id FROM prompts p ORDER BY p.id DESC LIMIT @keep));
+
+-- name: CountMessagesPurge :one
+SELECT COUNT(*)
+FROM messages
+WHERE (sqlc.narg(session_id) IS NULL OR messages.session_id = sqlc.narg(session_id))
+  AND (messages.created_at < @before
+    OR messages.id NOT IN (SELECT m.id FROM messages m ORDER BY m.id DESC LIMIT @keep));
+
+-- name: DeleteMessagesPurge :execrows
+DELETE
+FROM messages
+WHERE (sqlc.narg(session_id) IS NULL OR messages.session_id = sqlc.narg(session_id))
+  AND (messages.created_at < @before
+    OR messages.id NOT IN (SELECT m.id FROM messages m ORDER BY m.id DESC LIMIT @keep));
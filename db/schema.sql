@@ -1,4 +1,109 @@
-CREATE TABLE characters (id integer PRIMARY KEY AUTOINCREMENT,result text NOT NULL);
-CREATE TABLE prompts (id integer PRIMARY KEY AUTOINCREMENT,session_id text NOT NULL,agent text NOT NULL,state text NOT NULL,system text NOT NULL,history_len integer NOT NULL,request text NOT NULL,provider text NOT NULL,model text NOT NULL,response text,created_at datetime NOT NULL,mach_time_sum integer NOT NULL,mach_time text NOT NULL);
-CREATE TABLE resources (id integer PRIMARY KEY AUTOINCREMENT,key text NOT NULL,value text NOT NULL);
-CREATE INDEX session ON prompts(session_id);
+CREATE TABLE characters
+(
+    id     integer PRIMARY KEY AUTOINCREMENT,
+    result text NOT NULL
+);
+CREATE UNIQUE INDEX decision_key ON decisions (key);
+CREATE TABLE decisions
+(
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    key         text     NOT NULL,
+    kind        text     NOT NULL,
+    prompt      text     NOT NULL,
+    moves_hash  text     NOT NULL,
+    schema_hash text     NOT NULL,
+    result      text     NOT NULL,
+    created_at  datetime NOT NULL
+);
+CREATE UNIQUE INDEX fact_key ON facts (key);
+CREATE TABLE facts
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    key        text     NOT NULL,
+    category   text     NOT NULL,
+    fact       text     NOT NULL,
+    source     text     NOT NULL,
+    session_id text     NOT NULL,
+    confidence real     NOT NULL,
+    expires_at datetime,
+    created_at datetime NOT NULL
+);
+CREATE INDEX idx_resources_locale ON resources (locale);
+CREATE TABLE messages
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL,
+    agent      text     NOT NULL,
+    sender     text     NOT NULL,
+    text       text     NOT NULL,
+    prompt_id  integer,
+    created_at datetime NOT NULL
+);
+CREATE INDEX messages_created ON messages (created_at);
+CREATE INDEX messages_session ON messages (session_id);
+CREATE TABLE orienting_examples
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL,
+    prompt     text     NOT NULL,
+    move       text     NOT NULL,
+    certainty  real     NOT NULL,
+    candidates text     NOT NULL,
+    created_at datetime NOT NULL
+);
+CREATE TABLE prompts
+(
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    session_id    text     NOT NULL,
+    agent         text     NOT NULL,
+    state         text     NOT NULL,
+    system        text     NOT NULL,
+    history_len   integer  NOT NULL,
+    request       text     NOT NULL,
+    provider      text     NOT NULL,
+    model         text     NOT NULL,
+    response      text,
+    created_at    datetime NOT NULL,
+    mach_time_sum integer  NOT NULL,
+    mach_time     text     NOT NULL
+);
+CREATE TABLE resources
+(
+    id    integer PRIMARY KEY AUTOINCREMENT,
+    key   text NOT NULL,
+    value text NOT NULL
+, locale text NOT NULL DEFAULT ('en'));
+CREATE TABLE schema_migrations (
+	component  text     NOT NULL,
+	version    integer  NOT NULL,
+	name       text     NOT NULL,
+	applied_at datetime NOT NULL,
+	PRIMARY KEY (component, version)
+);
+CREATE INDEX session ON prompts (session_id);
+CREATE TABLE snapshots
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    session_id text     NOT NULL UNIQUE,
+    agent      text     NOT NULL,
+    data       text     NOT NULL,
+    created_at datetime NOT NULL
+);
+CREATE INDEX snapshots_agent ON snapshots (agent);
+CREATE TABLE story_events
+(
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    session_id    text     NOT NULL,
+    agent         text     NOT NULL,
+    state         text     NOT NULL,
+    active        integer  NOT NULL,
+    cause         text     NOT NULL,
+    active_ms     integer  NOT NULL,
+    active_ticks  integer  NOT NULL,
+    created_at    datetime NOT NULL,
+    mach_time_sum integer  NOT NULL,
+    mach_time     text     NOT NULL,
+    mem_time_sum  integer  NOT NULL
+);
+CREATE INDEX story_session ON story_events (session_id);
+CREATE INDEX story_state ON story_events (state);
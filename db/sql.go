@@ -1,75 +1,59 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"time"
+	"embed"
+	"strings"
 
+	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
-	"github.com/ncruces/go-sqlite3/gormlite"
+
 	"github.com/pancsta/secai/shared"
-	"gorm.io/gorm"
 )
 
-// Prompt represents a prompt record in the database.
-type Prompt struct {
-	// IDs
-	ID        uint   `gorm:"primaryKey"`
-	SessionID string `gorm:"not null;index:session"`
-
-	// Content
-	Agent      string `gorm:"not null"`
-	State      string `gorm:"not null"`
-	System     string `gorm:"not null"`
-	HistoryLen int    `gorm:"not null"`
-	Request    string `gorm:"not null"`
-	Provider   string `gorm:"not null"`
-	Model      string `gorm:"not null"`
-	Response   string
+// BaseFile is the name of the base DB file, in the agent's dir.
+const BaseFile = "secai.sqlite"
 
-	// Time
-	CreatedAt   time.Time `gorm:"not null"`
-	MachTimeSum int       `gorm:"not null"`
-	MachTime    string    `gorm:"not null"`
-}
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
 
-// AGENT LLM
-
-type Resource struct {
-	ID uint `gorm:"primaryKey"`
-	// SessionID uint `gorm:"not null"`
-	Key   string `gorm:"not null"`
-	Value string `gorm:"not null"`
-}
-
-type Character struct {
-	ID uint `gorm:"primaryKey"`
-	// SessionID uint `gorm:"not null"`
-	Result string `gorm:"not null"`
-}
-
-func Open(dbFile string) (conn *sql.DB, schema string, err error) {
-	file := gormlite.Open(dbFile)
-	dbGorm, err := gorm.Open(file, &gorm.Config{})
-	if err != nil {
-		return nil, "", err
-	}
+// BaseMigrations are the migrations of the base agent's tables.
+var BaseMigrations = MustLoadMigrations("base", migrationsFS, "migrations")
 
-	err = dbGorm.AutoMigrate(&Prompt{}, &Character{}, &Resource{})
+// Open opens an SQLite DB and applies pending [migrations] in order. Returns the resulting schema.
+func Open(ctx context.Context, dbFile string, migrations ...*Migrations) (conn *sql.DB, schema string, err error) {
+	conn, err = Connect(dbFile)
 	if err != nil {
 		return nil, "", err
 	}
 
-	db, err := dbGorm.DB()
-	if err != nil {
+	if _, err = Migrate(ctx, conn, false, migrations...); err != nil {
+		_ = conn.Close()
 		return nil, "", err
 	}
 
 	// TODO dump SQL queries on config Debug.Misc
 
 	// get schema
-	if schema, err = shared.GetSQLiteSchema(db); err != nil {
+	if schema, err = shared.GetSQLiteSchema(conn); err != nil {
+		_ = conn.Close()
 		return nil, "", err
 	}
 
-	return db, schema, nil
+	return conn, schema, nil
+}
+
+// Connect opens an SQLite DB without migrating it.
+func Connect(dbFile string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		return nil, err
+	}
+	// every connection to an in-memory DB is a separate DB
+	if strings.Contains(dbFile, ":memory:") {
+		conn.SetMaxOpenConns(1)
+	}
+
+	return conn, conn.Ping()
 }
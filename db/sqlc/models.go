@@ -14,6 +14,49 @@ type Character struct {
 	Result string `json:"result"`
 }
 
+type Decision struct {
+	ID         int64     `json:"id"`
+	Key        string    `json:"key"`
+	Kind       string    `json:"kind"`
+	Prompt     string    `json:"prompt"`
+	MovesHash  string    `json:"moves_hash"`
+	SchemaHash string    `json:"schema_hash"`
+	Result     string    `json:"result"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Fact struct {
+	ID         int64        `json:"id"`
+	Key        string       `json:"key"`
+	Category   string       `json:"category"`
+	Fact       string       `json:"fact"`
+	Source     string       `json:"source"`
+	SessionID  string       `json:"session_id"`
+	Confidence float64      `json:"confidence"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type Message struct {
+	ID        int64         `json:"id"`
+	SessionID string        `json:"session_id"`
+	Agent     string        `json:"agent"`
+	Sender    string        `json:"sender"`
+	Text      string        `json:"text"`
+	PromptID  sql.NullInt64 `json:"prompt_id"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type OrientingExample struct {
+	ID         int64     `json:"id"`
+	SessionID  string    `json:"session_id"`
+	Prompt     string    `json:"prompt"`
+	Move       string    `json:"move"`
+	Certainty  float64   `json:"certainty"`
+	Candidates string    `json:"candidates"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Prompt struct {
 	ID          int64          `json:"id"`
 	SessionID   string         `json:"session_id"`
@@ -31,7 +74,38 @@ type Prompt struct {
 }
 
 type Resource struct {
-	ID    int64  `json:"id"`
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	ID     int64  `json:"id"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Locale string `json:"locale"`
+}
+
+type SchemaMigration struct {
+	Component string    `json:"component"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	SessionID string    `json:"session_id"`
+	Agent     string    `json:"agent"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StoryEvent struct {
+	ID          int64     `json:"id"`
+	SessionID   string    `json:"session_id"`
+	Agent       string    `json:"agent"`
+	State       string    `json:"state"`
+	Active      int64     `json:"active"`
+	Cause       string    `json:"cause"`
+	ActiveMs    int64     `json:"active_ms"`
+	ActiveTicks int64     `json:"active_ticks"`
+	CreatedAt   time.Time `json:"created_at"`
+	MachTimeSum int64     `json:"mach_time_sum"`
+	MachTime    string    `json:"mach_time"`
+	MemTimeSum  int64     `json:"mem_time_sum"`
 }
@@ -11,6 +11,35 @@ import (
 	"time"
 )
 
+const addMessage = `-- name: AddMessage :one
+INSERT INTO messages (session_id, agent, sender, text, prompt_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type AddMessageParams struct {
+	SessionID string        `json:"session_id"`
+	Agent     string        `json:"agent"`
+	Sender    string        `json:"sender"`
+	Text      string        `json:"text"`
+	PromptID  sql.NullInt64 `json:"prompt_id"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func (q *Queries) AddMessage(ctx context.Context, arg AddMessageParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, addMessage,
+		arg.SessionID,
+		arg.Agent,
+		arg.Sender,
+		arg.Text,
+		arg.PromptID,
+		arg.CreatedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const addPrompt = `-- name: AddPrompt :one
 INSERT INTO prompts (session_id, agent, state, history_len, system, request, provider, model, created_at, mach_time_sum, mach_time)
 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -67,6 +96,160 @@ func (q *Queries) AddPromptResponse(ctx context.Context, arg AddPromptResponsePa
 	return err
 }
 
+const addStoryEvent = `-- name: AddStoryEvent :one
+INSERT INTO story_events (session_id, agent, state, active, cause, active_ms, active_ticks, created_at, mach_time_sum,
+                          mach_time, mem_time_sum)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type AddStoryEventParams struct {
+	SessionID   string    `json:"session_id"`
+	Agent       string    `json:"agent"`
+	State       string    `json:"state"`
+	Active      int64     `json:"active"`
+	Cause       string    `json:"cause"`
+	ActiveMs    int64     `json:"active_ms"`
+	ActiveTicks int64     `json:"active_ticks"`
+	CreatedAt   time.Time `json:"created_at"`
+	MachTimeSum int64     `json:"mach_time_sum"`
+	MachTime    string    `json:"mach_time"`
+	MemTimeSum  int64     `json:"mem_time_sum"`
+}
+
+func (q *Queries) AddStoryEvent(ctx context.Context, arg AddStoryEventParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, addStoryEvent,
+		arg.SessionID,
+		arg.Agent,
+		arg.State,
+		arg.Active,
+		arg.Cause,
+		arg.ActiveMs,
+		arg.ActiveTicks,
+		arg.CreatedAt,
+		arg.MachTimeSum,
+		arg.MachTime,
+		arg.MemTimeSum,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const countMessagesPurge = `-- name: CountMessagesPurge :one
+SELECT COUNT(*)
+FROM messages
+WHERE (?1 IS NULL OR messages.session_id = ?1)
+  AND (messages.created_at < ?2
+    OR messages.id NOT IN (SELECT m.id FROM messages m ORDER BY m.id DESC LIMIT ?3))
+`
+
+type CountMessagesPurgeParams struct {
+	SessionID interface{} `json:"session_id"`
+	Before    time.Time   `json:"before"`
+	Keep      int64       `json:"keep"`
+}
+
+func (q *Queries) CountMessagesPurge(ctx context.Context, arg CountMessagesPurgeParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countMessagesPurge, arg.SessionID, arg.Before, arg.Keep)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPromptsPurge = `-- name: CountPromptsPurge :one
+SELECT COUNT(*)
+FROM prompts
+WHERE (?1 IS NULL OR prompts.session_id = ?1)
+  AND (prompts.created_at < ?2
+    OR prompts.id NOT IN (SELECT p.id FROM prompts p ORDER BY p.id DESC LIMIT ?3))
+`
+
+type CountPromptsPurgeParams struct {
+	SessionID interface{} `json:"session_id"`
+	Before    time.Time   `json:"before"`
+	Keep      int64       `json:"keep"`
+}
+
+func (q *Queries) CountPromptsPurge(ctx context.Context, arg CountPromptsPurgeParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPromptsPurge, arg.SessionID, arg.Before, arg.Keep)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteMessagesPurge = `-- name: DeleteMessagesPurge :execrows
+DELETE
+FROM messages
+WHERE (?1 IS NULL OR messages.session_id = ?1)
+  AND (messages.created_at < ?2
+    OR messages.id NOT IN (SELECT m.id FROM messages m ORDER BY m.id DESC LIMIT ?3))
+`
+
+type DeleteMessagesPurgeParams struct {
+	SessionID interface{} `json:"session_id"`
+	Before    time.Time   `json:"before"`
+	Keep      int64       `json:"keep"`
+}
+
+func (q *Queries) DeleteMessagesPurge(ctx context.Context, arg DeleteMessagesPurgeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteMessagesPurge, arg.SessionID, arg.Before, arg.Keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteMessagesSince = `-- name: DeleteMessagesSince :exec
+DELETE
+FROM messages
+WHERE session_id = ?
+  AND created_at >= ?
+`
+
+type DeleteMessagesSinceParams struct {
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) DeleteMessagesSince(ctx context.Context, arg DeleteMessagesSinceParams) error {
+	_, err := q.db.ExecContext(ctx, deleteMessagesSince, arg.SessionID, arg.CreatedAt)
+	return err
+}
+
+const deletePromptsPurge = `-- name: DeletePromptsPurge :execrows
+DELETE
+FROM prompts
+WHERE (?1 IS NULL OR prompts.session_id = ?1)
+  AND (prompts.created_at < ?2
+    OR prompts.id NOT IN (SELECT p.id FROM prompts p ORDER BY p.id DESC LIMIT ?3))
+`
+
+type DeletePromptsPurgeParams struct {
+	SessionID interface{} `json:"session_id"`
+	Before    time.Time   `json:"before"`
+	Keep      int64       `json:"keep"`
+}
+
+func (q *Queries) DeletePromptsPurge(ctx context.Context, arg DeletePromptsPurgeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePromptsPurge, arg.SessionID, arg.Before, arg.Keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteSnapshots = `-- name: DeleteSnapshots :exec
+DELETE
+FROM snapshots
+WHERE agent = ?
+`
+
+func (q *Queries) DeleteSnapshots(ctx context.Context, agent string) error {
+	_, err := q.db.ExecContext(ctx, deleteSnapshots, agent)
+	return err
+}
+
 const dropPrompts = `-- name: DropPrompts :exec
 DROP TABLE prompts
 `
@@ -76,6 +259,183 @@ func (q *Queries) DropPrompts(ctx context.Context) error {
 	return err
 }
 
+const getSnapshotPrev = `-- name: GetSnapshotPrev :one
+SELECT id, session_id, agent, data, created_at
+FROM snapshots
+WHERE agent = ?
+  AND session_id != ?
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+type GetSnapshotPrevParams struct {
+	Agent     string `json:"agent"`
+	SessionID string `json:"session_id"`
+}
+
+func (q *Queries) GetSnapshotPrev(ctx context.Context, arg GetSnapshotPrevParams) (Snapshot, error) {
+	row := q.db.QueryRowContext(ctx, getSnapshotPrev, arg.Agent, arg.SessionID)
+	var i Snapshot
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.Agent,
+		&i.Data,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getStoryStats = `-- name: GetStoryStats :one
+SELECT COUNT(*)                                                AS runs,
+       CAST(COALESCE(AVG(NULLIF(active_ms, 0)), 0) AS INTEGER) AS avg_ms,
+       CAST(COALESCE(MAX(active_ms), 0) AS INTEGER)            AS max_ms,
+       CAST(COALESCE(SUM(active_ms), 0) AS INTEGER)            AS total_ms
+FROM story_events
+WHERE state = ?
+  AND active = 0
+`
+
+type GetStoryStatsRow struct {
+	Runs    int64 `json:"runs"`
+	AvgMs   int64 `json:"avg_ms"`
+	MaxMs   int64 `json:"max_ms"`
+	TotalMs int64 `json:"total_ms"`
+}
+
+// unknown durations (0) are skipped in the average
+func (q *Queries) GetStoryStats(ctx context.Context, state string) (GetStoryStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getStoryStats, state)
+	var i GetStoryStatsRow
+	err := row.Scan(
+		&i.Runs,
+		&i.AvgMs,
+		&i.MaxMs,
+		&i.TotalMs,
+	)
+	return i, err
+}
+
+const listMessagesBySession = `-- name: ListMessagesBySession :many
+SELECT id, session_id, agent, sender, text, prompt_id, created_at
+FROM messages
+WHERE session_id = ?
+ORDER BY id
+`
+
+func (q *Queries) ListMessagesBySession(ctx context.Context, sessionID string) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesBySession, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.Sender,
+			&i.Text,
+			&i.PromptID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesPrev = `-- name: ListMessagesPrev :many
+SELECT id, session_id, agent, sender, text, prompt_id, created_at
+FROM messages
+WHERE session_id != ?
+ORDER BY id DESC
+LIMIT ?
+`
+
+type ListMessagesPrevParams struct {
+	SessionID string `json:"session_id"`
+	Limit     int64  `json:"limit"`
+}
+
+func (q *Queries) ListMessagesPrev(ctx context.Context, arg ListMessagesPrevParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesPrev, arg.SessionID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.Sender,
+			&i.Text,
+			&i.PromptID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesSince = `-- name: ListMessagesSince :many
+SELECT id, session_id, agent, sender, text, prompt_id, created_at
+FROM messages
+WHERE created_at >= ?
+ORDER BY id
+`
+
+func (q *Queries) ListMessagesSince(ctx context.Context, createdAt time.Time) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesSince, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.Sender,
+			&i.Text,
+			&i.PromptID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listPromptsBySessID = `-- name: ListPromptsBySessID :one
 SELECT id, session_id, agent, state, system, history_len, request, provider, model, response, created_at, mach_time_sum, mach_time
 FROM prompts
@@ -103,3 +463,205 @@ func (q *Queries) ListPromptsBySessID(ctx context.Context, sessionID string) (Pr
 	)
 	return i, err
 }
+
+const listPromptsRecent = `-- name: ListPromptsRecent :many
+SELECT id, session_id, agent, state, system, history_len, request, provider, model, response, created_at, mach_time_sum, mach_time
+FROM prompts
+ORDER BY id DESC
+LIMIT ?
+`
+
+func (q *Queries) ListPromptsRecent(ctx context.Context, limit int64) ([]Prompt, error) {
+	rows, err := q.db.QueryContext(ctx, listPromptsRecent, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Prompt
+	for rows.Next() {
+		var i Prompt
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.State,
+			&i.System,
+			&i.HistoryLen,
+			&i.Request,
+			&i.Provider,
+			&i.Model,
+			&i.Response,
+			&i.CreatedAt,
+			&i.MachTimeSum,
+			&i.MachTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoryEvents = `-- name: ListStoryEvents :many
+SELECT id, session_id, agent, state, active, cause, active_ms, active_ticks, created_at, mach_time_sum, mach_time, mem_time_sum
+FROM story_events
+ORDER BY id DESC
+LIMIT ?
+`
+
+func (q *Queries) ListStoryEvents(ctx context.Context, limit int64) ([]StoryEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listStoryEvents, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StoryEvent
+	for rows.Next() {
+		var i StoryEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.State,
+			&i.Active,
+			&i.Cause,
+			&i.ActiveMs,
+			&i.ActiveTicks,
+			&i.CreatedAt,
+			&i.MachTimeSum,
+			&i.MachTime,
+			&i.MemTimeSum,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoryEventsByState = `-- name: ListStoryEventsByState :many
+SELECT id, session_id, agent, state, active, cause, active_ms, active_ticks, created_at, mach_time_sum, mach_time, mem_time_sum
+FROM story_events
+WHERE state = ?
+ORDER BY id DESC
+LIMIT ?
+`
+
+type ListStoryEventsByStateParams struct {
+	State string `json:"state"`
+	Limit int64  `json:"limit"`
+}
+
+func (q *Queries) ListStoryEventsByState(ctx context.Context, arg ListStoryEventsByStateParams) ([]StoryEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listStoryEventsByState, arg.State, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StoryEvent
+	for rows.Next() {
+		var i StoryEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Agent,
+			&i.State,
+			&i.Active,
+			&i.Cause,
+			&i.ActiveMs,
+			&i.ActiveTicks,
+			&i.CreatedAt,
+			&i.MachTimeSum,
+			&i.MachTime,
+			&i.MemTimeSum,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoryPreceding = `-- name: ListStoryPreceding :many
+SELECT prev.state, COUNT(*) AS count
+FROM story_events cur
+         JOIN story_events prev ON prev.id = (SELECT MAX(p.id)
+                                              FROM story_events p
+                                              WHERE p.id < cur.id
+                                                AND p.active = 1
+                                                AND p.session_id = cur.session_id)
+WHERE cur.state = ?
+  AND cur.active = 1
+GROUP BY prev.state
+ORDER BY count DESC
+`
+
+type ListStoryPrecedingRow struct {
+	State string `json:"state"`
+	Count int64  `json:"count"`
+}
+
+func (q *Queries) ListStoryPreceding(ctx context.Context, state string) ([]ListStoryPrecedingRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStoryPreceding, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListStoryPrecedingRow
+	for rows.Next() {
+		var i ListStoryPrecedingRow
+		if err := rows.Scan(&i.State, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const saveSnapshot = `-- name: SaveSnapshot :exec
+INSERT INTO snapshots (session_id, agent, data, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (session_id) DO UPDATE SET data       = excluded.data,
+                                       created_at = excluded.created_at
+`
+
+type SaveSnapshotParams struct {
+	SessionID string    `json:"session_id"`
+	Agent     string    `json:"agent"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) SaveSnapshot(ctx context.Context, arg SaveSnapshotParams) error {
+	_, err := q.db.ExecContext(ctx, saveSnapshot,
+		arg.SessionID,
+		arg.Agent,
+		arg.Data,
+		arg.CreatedAt,
+	)
+	return err
+}
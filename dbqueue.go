@@ -0,0 +1,223 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ncruces/go-sqlite3"
+)
+
+// ///// ///// /////
+
+// ///// DB WRITE QUEUE
+
+// ///// ///// /////
+
+// dbQuery is a queued write, see [shared.A.DBQuery].
+type dbQuery = func(ctx context.Context, tx *sql.Tx) error
+
+// dbQueue batches writes to the base DB. Queries are executed in order, each batch in a single transaction, with
+// every query in its own savepoint.
+type dbQueue struct {
+	mx      sync.Mutex
+	pending []dbQuery
+	// flushMx serializes flushes
+	flushMx sync.Mutex
+	// flushCh signals a flush before the interval
+	flushCh chan struct{}
+	// closing is the DB to flush and close, see [AgentBase.dbClose]
+	closing *sql.DB
+	// closed is the last closed DB
+	closed *sql.DB
+}
+
+// dbEnqueue adds [fn] to the write queue and schedules a flush when the batch is full.
+func (a *AgentBase) dbEnqueue(fn dbQuery) {
+	q := &a.dbQueue
+	q.mx.Lock()
+	q.pending = append(q.pending, fn)
+	full := len(q.pending) >= max(1, a.cfg.Agent.DB.BatchSize)
+	q.mx.Unlock()
+
+	if full {
+		a.dbFlushSignal()
+	}
+}
+
+// dbFlushSignal schedules a flush, without blocking.
+func (a *AgentBase) dbFlushSignal() {
+	select {
+	case a.dbQueue.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// dbQueueLen returns the number of queued queries.
+func (a *AgentBase) dbQueueLen() int {
+	a.dbQueue.mx.Lock()
+	defer a.dbQueue.mx.Unlock()
+
+	return len(a.dbQueue.pending)
+}
+
+// dbFlushLoop flushes the queue on an interval or a full batch, until [ctx] expires.
+func (a *AgentBase) dbFlushLoop(ctx context.Context) {
+	interval := a.cfg.Agent.DB.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-a.dbQueue.flushCh:
+		}
+
+		if err := a.dbFlush(ctx); err != nil {
+			AddErrDB(nil, a.mach, err)
+		}
+		if a.dbQueueLen() == 0 {
+			a.mach.Remove1(ss.BaseDBSaving, nil)
+		}
+	}
+}
+
+// dbFlush executes all the queued queries in batches. Errors of single queries are reported, but don't abort the
+// batch. A busy DB is retried with a backoff.
+func (a *AgentBase) dbFlush(ctx context.Context) error {
+	return a.dbFlushTo(ctx, a.DbConn)
+}
+
+// DBFlush executes the queued queries of [ss.BaseDBSaving], eg before deleting what they could insert.
+func (a *AgentBase) DBFlush(ctx context.Context) error {
+	return a.dbFlush(ctx)
+}
+
+// dbFlushTo is [AgentBase.dbFlush] into [conn].
+func (a *AgentBase) dbFlushTo(ctx context.Context, conn *sql.DB) error {
+	a.dbQueue.flushMx.Lock()
+	defer a.dbQueue.flushMx.Unlock()
+	if conn == nil {
+		return ErrDBNil
+	}
+
+	for {
+		// take a batch
+		a.dbQueue.mx.Lock()
+		size := min(len(a.dbQueue.pending), max(1, a.cfg.Agent.DB.BatchSize))
+		batch := a.dbQueue.pending[:size:size]
+		a.dbQueue.mx.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// execute
+		var errs []error
+		var err error
+		for i := 0; i <= a.cfg.Agent.DB.Retries; i++ {
+			errs, err = a.dbExecBatch(ctx, conn, batch)
+			if !errors.Is(err, sqlite3.BUSY) {
+				break
+			}
+			a.Log("db busy, retrying", "try", i+1, "batch", len(batch))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(i+1) * 50 * time.Millisecond):
+			}
+		}
+		if err != nil {
+			// keep the batch for the next flush
+			return fmt.Errorf("db batch of %d: %w", len(batch), err)
+		}
+
+		// dequeue
+		a.dbQueue.mx.Lock()
+		a.dbQueue.pending = a.dbQueue.pending[len(batch):]
+		a.dbQueue.mx.Unlock()
+		for _, err := range errs {
+			AddErrDB(nil, a.mach, err)
+		}
+	}
+}
+
+// dbExecBatch executes [batch] in a single transaction. Returns errors of single queries and an error of the whole
+// batch.
+func (a *AgentBase) dbExecBatch(ctx context.Context, conn *sql.DB, batch []dbQuery) ([]error, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var errs []error
+	for _, fn := range batch {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT query"); err != nil {
+			return nil, err
+		}
+		if err := fn(ctx, tx); err != nil {
+			if errors.Is(err, sqlite3.BUSY) {
+				return nil, err
+			}
+			errs = append(errs, err)
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO query"); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE query"); err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// dbCloseLater marks [conn] to be flushed and closed by [AgentBase.dbClose]. Returns false for closed DBs.
+func (a *AgentBase) dbCloseLater(conn *sql.DB) bool {
+	q := &a.dbQueue
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	if conn == nil || conn == q.closed {
+		return false
+	}
+	q.closing = conn
+
+	return true
+}
+
+// dbClose flushes the queue into the DB marked by [AgentBase.dbCloseLater] and closes it. Blocks for up to 5s, so
+// shouldn't be called from handlers.
+func (a *AgentBase) dbClose() {
+	q := &a.dbQueue
+	q.mx.Lock()
+	conn := q.closing
+	q.closing = nil
+	q.mx.Unlock()
+	if conn == nil {
+		return
+	}
+
+	// TODO config
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if a.dbQueueLen() > 0 {
+		if err := a.dbFlushTo(ctx, conn); err != nil {
+			a.LogErr("db final flush", err, "lost", a.dbQueueLen())
+		}
+	}
+
+	q.mx.Lock()
+	q.closed = conn
+	q.mx.Unlock()
+	if err := conn.Close(); err != nil {
+		a.LogErr("db close", err)
+	}
+}
@@ -5,10 +5,11 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io"
 	"runtime/debug"
 	"slices"
-	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -20,13 +21,18 @@ import (
 	am "github.com/pancsta/asyncmachine-go/pkg/machine"
 	arpc "github.com/pancsta/asyncmachine-go/pkg/rpc"
 
+	"github.com/pancsta/secai"
 	agentllm "github.com/pancsta/secai/agent_llm"
 	sallm "github.com/pancsta/secai/agent_llm/schema"
 	"github.com/pancsta/secai/examples/cook/db/sqlc"
 	sa "github.com/pancsta/secai/examples/cook/schema"
 	"github.com/pancsta/secai/examples/cook/states"
+	"github.com/pancsta/secai/i18n"
+	"github.com/pancsta/secai/plan"
 	"github.com/pancsta/secai/shared"
 	ssbase "github.com/pancsta/secai/states"
+	"github.com/pancsta/secai/tools/history"
+	"github.com/pancsta/secai/tools/mcp"
 	"github.com/pancsta/secai/tools/searxng"
 	"github.com/pancsta/secai/tui"
 	"github.com/pancsta/secai/web"
@@ -84,6 +90,13 @@ type S = am.S
 
 var WelcomeMessage = "Please wait while loading..."
 
+// keys of snapshot values
+const (
+	snapIngredients  = "ingredients"
+	snapRecipe       = "recipe"
+	snapStepComments = "step_comments"
+)
+
 //go:embed web
 var webAssets embed.FS
 
@@ -116,22 +129,19 @@ type ConfigCook struct {
 	StepCommentFreq int
 	// Heartbeat frequency.
 	HeartbeatFreq time.Duration `kdl:",duration"`
-	// Certainty above which the orienting move should be accepted.
-	OrientingMoveThreshold float64
 }
 
 func ConfigDefault() Config {
 	cfg := Config{
 		Config: shared.ConfigDefault(),
 		Cook: ConfigCook{
-			MinIngredients:         3,
-			GenJokesAmount:         3,
-			SessionTimeout:         time.Hour,
-			GenRecipes:             3,
-			MinPromptLen:           2,
-			StepCommentFreq:        2,
-			HeartbeatFreq:          time.Hour,
-			OrientingMoveThreshold: 0.5,
+			MinIngredients:  3,
+			GenJokesAmount:  3,
+			SessionTimeout:  time.Hour,
+			GenRecipes:      3,
+			MinPromptLen:    2,
+			StepCommentFreq: 2,
+			HeartbeatFreq:   time.Hour,
 		},
 	}
 	cfg.Agent.ID = "cook"
@@ -169,6 +179,8 @@ type Agent struct {
 	recipe       atomic.Pointer[sa.Recipe]
 	stepComments atomic.Pointer[sa.ResultGenStepComments]
 	ingredients  atomic.Pointer[[]sa.Ingredient]
+	// prevSnapshot is the snapshot of the previous session, which can be resumed.
+	prevSnapshot atomic.Pointer[shared.Snapshot]
 
 	// machs
 
@@ -177,6 +189,9 @@ type Agent struct {
 	// tools
 
 	tSearxng *searxng.Tool
+	tHistory *history.Tool
+	// tMCP are the connected servers of [shared.ConfigTools.MCP]
+	tMCP []*mcp.Server
 
 	// prompts
 
@@ -190,6 +205,7 @@ type Agent struct {
 	// internals
 
 	srvUI           *ssh.Server
+	planner         *plan.Planner
 	loop            *amhelp.StateLoop
 	loopCooking     *amhelp.StateLoop
 	loopIngredients *amhelp.StateLoop
@@ -277,8 +293,23 @@ func (a *Agent) Init(cfg *Config) error {
 	a.pGenSteps = sa.NewPromptGenSteps(a)
 	a.pGenStepComments = sa.NewPromptGenStepComments(a)
 
+	// steps planner, ends with states.MemMealReady
+	a.planner = &plan.Planner{
+		Prefix: "Step",
+		Goal:   "MealReady",
+		Repair: true,
+	}
+
+	// init history - timeline tool
+	a.tHistory, err = history.New(a)
+	if err != nil {
+		return err
+	}
+
 	// register tools
 	// secai.ToolAddToPrompts(a.tSearxng, a.pSearchingLLM, a.pAnswering)
+	secai.ToolAddToPrompts(a.tHistory, a.pGenStepComments, a.pGenJokes, a.pCookingStarted)
+	a.initMCP()
 
 	// init memory
 	err = a.initMem()
@@ -286,7 +317,9 @@ func (a *Agent) Init(cfg *Config) error {
 		return err
 	}
 
-	a.initStories()
+	if err := a.initStories(); err != nil {
+		return err
+	}
 	// TODO NewClockService
 	a.clockService = &tui.ClockService{
 		Cfg:       &a.Config.Config,
@@ -305,7 +338,7 @@ func (a *Agent) Init(cfg *Config) error {
 
 func (a *Agent) Queries() *sqlc.Queries {
 	if a.dbQueries == nil {
-		a.dbQueries = sqlc.New(a.dbConn)
+		a.dbQueries = sqlc.New(a.DBTX(a.dbConn))
 	}
 
 	return a.dbQueries
@@ -330,6 +363,10 @@ func (a *Agent) HistoryStates() S {
 	return trackedStates
 }
 
+func (a *Agent) RewindStates() S {
+	return states.CookGroups.Flow
+}
+
 func (a *Agent) Splash() string {
 	cfg := a.Config
 	lines := []string{}
@@ -444,6 +481,15 @@ func (a *Agent) Msgs() []*shared.Msg {
 	return a.msgs
 }
 
+// ExportBundle includes the full config of the cook in the session bundle.
+func (a *Agent) ExportBundle(ctx context.Context, w io.Writer, cfg any) error {
+	if cfg == nil {
+		cfg = a.Config
+	}
+
+	return a.AgentLLM.ExportBundle(ctx, w, cfg)
+}
+
 func (a *Agent) MachMem() *am.Machine {
 	return a.mem
 }
@@ -507,6 +553,11 @@ func (a *Agent) Actions() []shared.ActionInfo {
 		}
 	}
 
+	// moves awaiting confirmation
+	ret = append(ret, a.OrientingActions()...)
+	// remembered facts
+	ret = append(ret, a.FactActions()...)
+
 	a.ValFile(nil, "actions", ret, "")
 	return ret
 }
@@ -553,6 +604,9 @@ func (a *Agent) initMem() error {
 		return err
 	}
 	shared.MachTelemetry(a.mem, nil)
+	if err := a.RewindTrackMem(a.mem); err != nil {
+		return err
+	}
 	if cfg.Debug.REPL {
 		opts := arpc.ReplOpts{
 			AddrDir: cfg.Agent.Dir,
@@ -577,12 +631,45 @@ func (a *Agent) initMem() error {
 		s.Memory.TimeActivated = nil
 		s.Memory.TimeDeactivated = nil
 	}
+	if mach.Is1(ss.Start) {
+		a.StoriesBind()
+	}
 
 	return nil
 }
 
+// initMCP connects to the configured MCP servers and adds their tools to the prompts answering the user. Failed
+// servers are skipped.
+func (a *Agent) initMCP() {
+	ctx := a.Mach().Context()
+	for _, cfg := range a.Config.Tools.MCP {
+		srv, err := mcp.Connect(ctx, a, cfg)
+		if err != nil {
+			a.LogErr("mcp connect "+cfg.Name, err)
+			continue
+		}
+		a.tMCP = append(a.tMCP, srv)
+		for _, t := range srv.Tools {
+			secai.ToolAddToPrompts(t, a.pIngredientsPicking, a.pRecipePicking, a.pCookingStarted)
+		}
+	}
+	if len(a.tMCP) == 0 {
+		return
+	}
+
+	// disconnect
+	a.DisposedHandlers.DisposedHandlers = append(a.DisposedHandlers.DisposedHandlers,
+		func(id string, ctx context.Context) {
+			for _, srv := range a.tMCP {
+				if err := srv.Close(); err != nil {
+					a.LogErr("mcp close "+srv.Cfg.Name, err)
+				}
+			}
+		})
+}
+
 // initStories inits stories and their buttons
-func (a *Agent) initStories() {
+func (a *Agent) initStories() error {
 	mach := a.Mach()
 
 	// TODO NewAction & merge
@@ -617,6 +704,18 @@ func (a *Agent) initStories() {
 					Not: S{ss.Ready},
 				},
 			},
+			{
+				ID:    amhelp.RandId(8),
+				Label: a.T(i18n.KeyResumeSession),
+				Desc:  a.T(i18n.KeyResumeSessionDesc),
+				VisibleAgent: amhelp.Cond{
+					Is:  S{ss.Ready, ss.SessionResumable},
+					Not: S{ss.SessionResuming, ss.IngredientsReady},
+				},
+				Action: func() {
+					mach.Add1(ss.SessionResuming, nil)
+				},
+			},
 		}),
 
 		// joke (hidden / visible / active)
@@ -734,7 +833,13 @@ func (a *Agent) initStories() {
 		}),
 	}
 
-	// sort stories according to the schema
+	// merge declarative stories
+	added, err := a.StoriesLoad(a.stories)
+	if err != nil {
+		return err
+	}
+
+	// sort stories according to the schema, with declarative ones at the end
 	var list []string
 	for _, s := range states.CookGroups.Stories {
 		if _, ok := a.stories[s]; !ok {
@@ -744,6 +849,11 @@ func (a *Agent) initStories() {
 
 		list = append(list, s)
 	}
+	for _, name := range added {
+		if !slices.Contains(list, name) {
+			list = append(list, name)
+		}
+	}
 	a.storiesOrder = list
 
 	// bind the machines to all the stories
@@ -751,6 +861,8 @@ func (a *Agent) initStories() {
 		s.Agent.Mach = mach
 		s.Memory.Mach = a.mem
 	}
+
+	return nil
 }
 
 // allSteps returns all the step states (but only final or solo ones) from the memory machine.
@@ -825,6 +937,43 @@ func (a *Agent) hasJokes() bool {
 	return j != nil && len(j.Jokes) > 0
 }
 
+// saveSnapshot persists the flow, the memory and the values needed to resume this session after a restart. Sessions
+// without ingredients aren't worth resuming.
+func (a *Agent) saveSnapshot(e *am.Event) {
+	mach := a.Mach()
+	if a.mem == nil || mach.Not(S{ss.BaseDBReady, ss.IngredientsReady}) {
+		return
+	}
+
+	snap := &shared.Snapshot{
+		Machs: []*shared.MachSnapshot{shared.SnapshotMach(mach), shared.SnapshotMach(a.mem)},
+	}
+	err := errors.Join(
+		snap.SetValue(snapIngredients, a.ingredients.Load()),
+		snap.SetValue(snapRecipe, a.recipe.Load()),
+		snap.SetValue(snapStepComments, a.stepComments.Load()),
+	)
+	if err != nil {
+		mach.EvAddErr(e, err, nil)
+		return
+	}
+	a.SaveSnapshot(e, snap)
+}
+
+// historyQuery narrows the timeline of the history tool to [params], requested by an LLM to answer a question about
+// the past. Returns true when the timeline changed.
+func (a *Agent) historyQuery(ctx context.Context, params *history.Params) bool {
+	if params == nil {
+		return false
+	}
+	if _, err := a.tHistory.Query(ctx, params); err != nil {
+		a.Log("history query", "err", err)
+		return false
+	}
+
+	return true
+}
+
 // TODO state OrientingToPrompt?
 func (a *Agent) runOrienting(ctx context.Context, e *am.Event) {
 	mach := a.Mach()
@@ -855,79 +1004,6 @@ func (a *Agent) redrawClock(e *am.Event) {
 
 // ///// ///// /////
 
-// ///// MISC
-
-// ///// ///// /////
-
-func validateStepSchema(schema am.Schema, stepStates, allStates am.S) error {
-	// TODO check min steps amount
-
-	// check if going 1,2,3..n will end on MealReady
-	mach := am.New(context.Background(), schema, nil)
-	for _, step := range stepStates {
-		mach.Add1(step, nil)
-	}
-
-	if !mach.Is1(states.MemMealReady) {
-		return fmt.Errorf("step schema is invalid: %s", stepStates)
-	}
-
-	// TODO should fail when actiavted from the end
-
-	return nil
-}
-
-// sorting steps
-
-func sortSteps(schema am.Schema) S {
-	steps := []StepsByReqFinal{}
-	for name := range schema {
-		steps = append(steps, StepsByReqFinal{
-			Name:   name,
-			Schema: schema,
-		})
-	}
-
-	sort.Sort(sortStepsByIdx(steps))
-
-	return shared.Map(steps, func(s StepsByReqFinal) string {
-		return s.Name
-	})
-}
-
-type StepsByReqFinal struct {
-	Name   string
-	Schema am.Schema
-}
-
-type sortStepsByIdx []StepsByReqFinal
-
-func (s sortStepsByIdx) Len() int { return len(s) }
-func (s sortStepsByIdx) Less(n1, n2 int) bool {
-	el1 := s[n1]
-	name1 := el1.Name
-	state1 := el1.Schema[name1]
-	idx1 := amhelp.TagValue(state1.Tags, "idx")
-	idx1Int, _ := strconv.Atoi(idx1)
-	isFinal1 := amhelp.TagValue(state1.Tags, "final") != ""
-
-	el2 := s[n2]
-	name2 := el2.Name
-	state2 := el2.Schema[name2]
-	idx2 := amhelp.TagValue(state2.Tags, "idx")
-	idx2Int, _ := strconv.Atoi(idx2)
-	isFinal2 := amhelp.TagValue(state2.Tags, "final") != ""
-
-	if idx1Int < idx2Int || (idx1 == idx2 && !isFinal1 && isFinal2) {
-		return true
-	}
-
-	return false
-}
-func (s sortStepsByIdx) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
-
-// ///// ///// /////
-
 // ///// ARGS
 
 // ///// ///// /////
@@ -980,7 +1056,7 @@ type ARPC struct {
 	*shared.A
 
 	// agent's args
-	Move *sallm.ResultOrienting `log:"move"`
+	Move *sallm.OrientingMove `log:"move"`
 }
 
 // ParseArgs extracts A from [am.Event.Args][APrefix] (decoder).
@@ -1,44 +1,62 @@
 package cook
 
 import (
+	"context"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	am "github.com/pancsta/asyncmachine-go/pkg/machine"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/examples/cook/db"
+	sa "github.com/pancsta/secai/examples/cook/schema"
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/tools/history"
 )
 
-func TestSortSteps(t *testing.T) {
-	schema := am.Schema{
-		"0": {
-			Tags: []string{
-				"idx:0",
-			},
-		},
-		"1": {
-			Remove: S{"2", "3"},
-			Tags: []string{
-				"idx:1",
-			},
-		},
-		"2": {
-			Remove: S{"1", "3"},
-			Tags: []string{
-				"idx:1",
-			},
-		},
-		"3": {
-			Remove: S{"1", "2"},
-			Tags: []string{
-				"idx:1",
-				"final",
-			},
-		},
-		"4": {
-			Tags: []string{
-				"idx:2",
-			},
-		},
+// TestHistoryQuery answers "what did we do before the joke?", with the params an LLM would request in
+// [sa.ResultCookingStarted.History].
+func TestHistoryQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := ConfigDefault()
+	cfg.Agent.ID = "cook-test"
+	cfg.Agent.Dir = t.TempDir()
+	cfg.Agent.Retention.Interval = 0
+	cfg.AI = shared.ConfigAI{}
+	a := New(ctx)
+	require.NoError(t, a.Init(&cfg))
+	mach := a.Mach()
+	defer mach.Dispose()
+
+	// DBs, without starting the UI
+	conn, _, err := db.Open(ctx, filepath.Join(cfg.Agent.Dir, db.File))
+	require.NoError(t, err)
+	defer conn.Close()
+	a.dbConn = conn
+	mach.Add1(ss.HistoryDBStarting, nil)
+	select {
+	case <-mach.When1(ss.HistoryDBReady, ctx):
+	case <-ctx.Done():
+		t.Fatal("history not ready")
 	}
-	names := sortSteps(schema)
-	assert.Equal(t, S{"0", "1", "2", "3", "4"}, names)
+
+	// ingredients, then a joke
+	mach.Add1(ss.IngredientsReady, nil)
+	a.jokes.Store(&sa.ResultGenJokes{Jokes: []string{"joke"}, IDs: []int64{1}})
+	mach.Add1(ss.StoryJoke, nil)
+	require.True(t, mach.Is1(ss.StoryJoke))
+
+	// no question about the past
+	assert.False(t, a.historyQuery(ctx, nil))
+	assert.False(t, a.historyQuery(ctx, &history.Params{Before: "Foo"}))
+
+	// what did we do before the joke
+	require.True(t, a.historyQuery(ctx, &history.Params{Before: ss.StoryJoke}))
+	timeline := strings.Join(a.tHistory.Document().Parts(), "\n")
+	assert.Contains(t, timeline, "state "+ss.IngredientsReady+" started")
+	assert.NotContains(t, timeline, ss.StoryJoke)
 }
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"syscall"
 	"time"
 
@@ -19,8 +24,17 @@ import (
 	"github.com/pancsta/fblog-go"
 	"github.com/sblinch/kdl-go"
 
+	"github.com/pancsta/secai"
+	"github.com/pancsta/secai/agent_llm"
+	"github.com/pancsta/secai/bundle"
+	"github.com/pancsta/secai/db"
+	"github.com/pancsta/secai/db/sqlc"
 	"github.com/pancsta/secai/examples/cook"
+	cookdb "github.com/pancsta/secai/examples/cook/db"
+	"github.com/pancsta/secai/graph"
+	"github.com/pancsta/secai/retention"
 	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/transcript"
 )
 
 func init() {
@@ -36,6 +50,12 @@ type CLI struct {
 	Log       *Log       `arg:"subcommand:log" help:"Show the agent's log"`
 	Env       *Env       `arg:"subcommand:env" help:"Generate a dotenv file"`
 	GenConfig *GenConfig `arg:"subcommand:gen-config" help:"Generate a default config file into --config"`
+	Graph     *Graph     `arg:"subcommand:graph" help:"Export the stories graph (Mermaid or DOT)"`
+	Migrate   *Migrate   `arg:"subcommand:migrate" help:"Apply pending DB migrations"`
+	Export    *Export    `arg:"subcommand:export" help:"Export the chat transcript (Markdown, JSON or HTML)"`
+	Session   *Session   `arg:"subcommand:session" help:"Export or import a session bundle"`
+	Wipe      *Wipe      `arg:"subcommand:wipe" help:"Delete stored data by class and session, or enforce the retention"`
+	MCP       *MCP       `arg:"subcommand:mcp" help:"Start the bot as an MCP server on stdio"`
 }
 
 type REPL struct{}
@@ -51,6 +71,46 @@ type Env struct {
 
 type GenConfig struct{}
 
+type Graph struct {
+	Format string `arg:"-f,--format" help:"Output format: mermaid, dot." default:"mermaid"`
+	Output string `arg:"-o,--output" help:"Output filename (default: stdout)."`
+}
+
+type Migrate struct {
+	DryRun bool `arg:"-n,--dry-run" help:"List pending migrations without applying them."`
+}
+
+type Export struct {
+	Format  string `arg:"-f,--format" help:"Output format: md, json, html (default: from the config)."`
+	Output  string `arg:"-o,--output" help:"Output filename (default: stdout)."`
+	Session string `arg:"-s,--session" help:"Session ID (default: the latest session)."`
+	All     bool   `arg:"-a,--all" help:"Export all the sessions."`
+	Prompts bool   `arg:"-p,--prompts" help:"Annotate assistant messages with prompt IDs."`
+}
+
+type Session struct {
+	Export *SessionExport `arg:"subcommand:export" help:"Bundle the agent's dir into a single archive"`
+	Import *SessionImport `arg:"subcommand:import" help:"Extract a bundle into a fresh agent dir"`
+}
+
+type SessionExport struct {
+	Output string `arg:"-o,--output" help:"Output filename (default: {ID}-{session}.tar.gz)."`
+}
+
+type Wipe struct {
+	Class     string `arg:"--class" help:"Comma-separated data classes: prompts, transcripts, history, vals, colly (default: all)."`
+	Session   string `arg:"-s,--session" help:"Only data of this session."`
+	Retention bool   `arg:"-r,--retention" help:"Only data violating the configured retention."`
+	DryRun    bool   `arg:"-n,--dry-run" help:"Report what would be deleted, without deleting."`
+}
+
+type MCP struct{}
+
+type SessionImport struct {
+	File string `arg:"positional,required" help:"Bundle file."`
+	Dir  string `arg:"-d,--dir" help:"Target agent dir, has to be empty." default:"./tmp-import"`
+}
+
 var cli CLI
 
 func main() {
@@ -131,6 +191,70 @@ func main() {
 			os.Exit(1)
 		}
 		return
+
+		// GRAPH
+	} else if cli.Graph != nil {
+		err := cmdGraph(ctx, cfg)
+		if err != nil {
+			err := p.FailSubcommand(fmt.Sprintf(
+				"ERROR: exporting graph: %v\n", err), "graph")
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+		// MIGRATE
+	} else if cli.Migrate != nil {
+		err := cmdMigrate(ctx, cfg)
+		if err != nil {
+			err := p.FailSubcommand(fmt.Sprintf(
+				"ERROR: migrating: %v\n", err), "migrate")
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+		// EXPORT
+	} else if cli.Export != nil {
+		err := cmdExport(ctx, cfg)
+		if err != nil {
+			err := p.FailSubcommand(fmt.Sprintf(
+				"ERROR: exporting transcript: %v\n", err), "export")
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+		// SESSION
+	} else if cli.Session != nil {
+		err := cmdSession(ctx, cfg)
+		if err != nil {
+			err := p.FailSubcommand(fmt.Sprintf(
+				"ERROR: session bundle: %v\n", err), "session")
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+		// WIPE
+	} else if cli.Wipe != nil {
+		err := cmdWipe(ctx, cfg)
+		if err != nil {
+			err := p.FailSubcommand(fmt.Sprintf(
+				"ERROR: wiping: %v\n", err), "wipe")
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		return
+
+		// MCP
+	} else if cli.MCP != nil {
+		err := cmdMCP(ctx, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: serving MCP: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	// BOT
@@ -281,6 +405,304 @@ func findStartOffset(f *os.File, linesToRead int) (int64, error) {
 
 // -----
 
+// GRAPH
+
+// -----
+
+// cmdGraph exports the stories graph from a running agent, or from a local (not started) instance.
+func cmdGraph(ctx context.Context, cfg cook.Config) error {
+	format := graph.Format(cli.Graph.Format)
+	out, err := fetchGraph(ctx, cfg, format)
+	if err != nil {
+		a, err := cook.NewCook(ctx, &cfg)
+		if err != nil {
+			return err
+		}
+		out, err = graph.FromAgent(a).Render(format)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cli.Graph.Output == "" {
+		fmt.Print(out)
+		return nil
+	}
+
+	return os.WriteFile(cli.Graph.Output, []byte(out), 0644)
+}
+
+// -----
+
+// MIGRATE
+
+// -----
+
+// cmdMigrate applies (or lists) pending migrations of the base and the cook's DBs.
+func cmdMigrate(ctx context.Context, cfg cook.Config) error {
+	dbs := []struct {
+		file string
+		sets []*db.Migrations
+	}{
+		{db.BaseFile, []*db.Migrations{db.BaseMigrations, agent_llm.Migrations}},
+		{cookdb.File, []*db.Migrations{cookdb.Migrations}},
+	}
+
+	for _, d := range dbs {
+		file := filepath.Join(cfg.Agent.Dir, d.file)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			fmt.Printf("%s: not created yet\n", file)
+			continue
+		}
+
+		conn, err := db.Connect(file)
+		if err != nil {
+			return err
+		}
+		list, err := db.Migrate(ctx, conn, cli.Migrate.DryRun, d.sets...)
+		_ = conn.Close()
+
+		verb := "applied"
+		if cli.Migrate.DryRun {
+			verb = "pending"
+		}
+		fmt.Printf("%s: %d %s\n", file, len(list), verb)
+		for _, m := range list {
+			fmt.Printf("  %s\n", m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// -----
+
+// EXPORT
+
+// -----
+
+// cmdExport exports the persisted chat transcript from the base DB, without a running agent.
+func cmdExport(ctx context.Context, cfg cook.Config) error {
+	file := filepath.Join(cfg.Agent.Dir, db.BaseFile)
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	conn, err := db.Connect(file)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	q := sqlc.New(conn)
+
+	// pick the session
+	var rows []sqlc.Message
+	switch {
+	case cli.Export.All:
+		rows, err = q.ListMessagesSince(ctx, time.Time{})
+	case cli.Export.Session != "":
+		rows, err = q.ListMessagesBySession(ctx, cli.Export.Session)
+	default:
+		// the latest message of any session
+		rows, err = q.ListMessagesPrev(ctx, sqlc.ListMessagesPrevParams{Limit: 1})
+		if err == nil && len(rows) > 0 {
+			rows, err = q.ListMessagesBySession(ctx, rows[0].SessionID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	format := transcript.Format(cli.Export.Format)
+	if format == "" {
+		format = transcript.Format(cfg.Agent.Transcript.Format)
+	}
+	out, err := transcript.Render(secai.MsgsFromRows(rows), format, transcript.Opts{
+		Title:   cfg.Agent.Label,
+		Prompts: cli.Export.Prompts || cfg.Agent.Transcript.Prompts,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cli.Export.Output == "" {
+		fmt.Print(out)
+		return nil
+	}
+
+	return os.WriteFile(cli.Export.Output, []byte(out), 0644)
+}
+
+// -----
+
+// SESSION
+
+// -----
+
+// cmdSession exports a session bundle from a running agent (or the agent's dir), or imports one into a fresh dir.
+func cmdSession(ctx context.Context, cfg cook.Config) error {
+	// IMPORT
+	if imp := cli.Session.Import; imp != nil {
+		f, err := os.Open(imp.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		m, err := bundle.Import(f, imp.Dir)
+		if err != nil {
+			return err
+		}
+
+		// config pointing to the new dir
+		cfgImp := cook.ConfigDefault()
+		if err := json.Unmarshal(m.Config, &cfgImp); err != nil {
+			return err
+		}
+		cfgImp.Agent.Dir = imp.Dir
+		cfgImp.File = filepath.Join(imp.Dir, "config.kdl")
+		data, err := kdl.Marshal(cfgImp)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(cfgImp.File, data, 0644); err != nil {
+			return err
+		}
+
+		fmt.Printf("Imported session %s of %s (%s) into %s\n", m.SessionID, m.AgentID,
+			m.CreatedAt.Format(time.DateTime), imp.Dir)
+		for _, file := range m.Files {
+			fmt.Printf("  %s\n", file)
+		}
+		fmt.Printf("Run with: -c %s\n", cfgImp.File)
+		return nil
+	}
+
+	// EXPORT
+	if cli.Session.Export == nil {
+		return fmt.Errorf("missing a subcommand: export, import")
+	}
+	data, err := fetchAgent(ctx, cfg, "/session/export", time.Minute)
+	if err != nil {
+		// not running, use a local (not started) instance
+		a, err := cook.NewCook(ctx, &cfg)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		if err := a.ExportBundle(ctx, buf, nil); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	out := cli.Session.Export.Output
+	if out == "" {
+		out = fmt.Sprintf("%s-%s.tar.gz", cfg.Agent.ID, time.Now().Format("20060102-150405"))
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s\n", out)
+
+	return nil
+}
+
+// -----
+
+// WIPE
+
+// -----
+
+// cmdWipe deletes data of the agent's dir by class and session, or according to the retention policies, without a
+// running agent.
+func cmdWipe(ctx context.Context, cfg cook.Config) error {
+	classes, err := retention.ParseClasses(cli.Wipe.Class)
+	if err != nil {
+		return err
+	}
+
+	// open existing DBs
+	store := retention.Store{Dir: cfg.Agent.Dir}
+	for _, d := range []struct {
+		file string
+		conn **sql.DB
+	}{
+		{db.BaseFile, &store.Base},
+		{"machine.sqlite", &store.History},
+	} {
+		file := filepath.Join(cfg.Agent.Dir, d.file)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		conn, err := db.Connect(file)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		*d.conn = conn
+	}
+
+	var report *retention.Report
+	if cli.Wipe.Retention {
+		policies := secai.RetentionPolicies(cfg.Agent.Retention)
+		for c := range policies {
+			if !slices.Contains(classes, c) {
+				delete(policies, c)
+			}
+		}
+		report, err = retention.Enforce(ctx, store, policies, cli.Wipe.DryRun)
+	} else {
+		report, err = retention.Wipe(ctx, store, retention.Opts{
+			Classes:   classes,
+			SessionID: cli.Wipe.Session,
+			DryRun:    cli.Wipe.DryRun,
+		})
+	}
+	if report != nil {
+		fmt.Print(report)
+	}
+
+	return err
+}
+
+// fetchGraph gets the graph from a running agent, with active states marked.
+func fetchGraph(ctx context.Context, cfg cook.Config, format graph.Format) (string, error) {
+	body, err := fetchAgent(ctx, cfg, "/stories/graph?format="+string(format), time.Second)
+
+	return string(body), err
+}
+
+// fetchAgent GETs [path] from the web server of a running agent.
+func fetchAgent(ctx context.Context, cfg cook.Config, path string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s%s", cfg.Web.Addr, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+// -----
+
 // ENV
 
 // -----
@@ -293,3 +715,21 @@ func cmdEnv(ctx context.Context, cfg cook.Config) error {
 
 	return nil
 }
+
+// -----
+
+// MCP
+
+// -----
+
+// cmdMCP runs the bot with an MCP server on stdio, so stdout is reserved for the protocol.
+func cmdMCP(ctx context.Context, cfg cook.Config) error {
+	a, err := cook.NewCook(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	a.Start()
+	defer a.Stop(nil)
+
+	return a.MCPServeStdio(ctx, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS jokes
+(
+    id   integer PRIMARY KEY AUTOINCREMENT,
+    text text NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ingredients
+(
+    id     integer PRIMARY KEY AUTOINCREMENT,
+    name   text NOT NULL,
+    amount text NOT NULL
+);
@@ -1,48 +1,22 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 
-	_ "github.com/ncruces/go-sqlite3/embed"
-	"github.com/ncruces/go-sqlite3/gormlite"
-	"github.com/pancsta/secai/shared"
-	"gorm.io/gorm"
+	secaidb "github.com/pancsta/secai/db"
 )
 
-type Joke struct {
-	ID uint `gorm:"primaryKey"`
-	// SessionID uint `gorm:"not null"`
-	Text string `gorm:"not null"`
-}
-
-type Ingredient struct {
-	ID uint `gorm:"primaryKey"`
-	// SessionID uint `gorm:"not null"`
-	Name   string `gorm:"not null"`
-	Amount string `gorm:"not null"`
-}
-
-func Open(dbFile string) (conn *sql.DB, schema string, err error) {
-	file := gormlite.Open(dbFile)
-	dbGorm, err := gorm.Open(file, &gorm.Config{})
-	if err != nil {
-		return nil, "", err
-	}
-
-	err = dbGorm.AutoMigrate(&Joke{}, &Ingredient{})
-	if err != nil {
-		return nil, "", err
-	}
+// File is the name of the cook's DB file, in the agent's dir.
+const File = "cook.sqlite"
 
-	db, err := dbGorm.DB()
-	if err != nil {
-		return nil, "", err
-	}
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
 
-	// get schema
-	if schema, err = shared.GetSQLiteSchema(db); err != nil {
-		return nil, "", err
-	}
+// Migrations are the migrations of the cook's DB.
+var Migrations = secaidb.MustLoadMigrations("cook", migrationsFS, "migrations")
 
-	return db, schema, nil
+func Open(ctx context.Context, dbFile string) (conn *sql.DB, schema string, err error) {
+	return secaidb.Open(ctx, dbFile, Migrations)
 }
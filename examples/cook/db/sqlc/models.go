@@ -4,10 +4,9 @@
 
 package sqlc
 
-type Character struct {
-	ID     int64  `json:"id"`
-	Result string `json:"result"`
-}
+import (
+	"time"
+)
 
 type Ingredient struct {
 	ID     int64  `json:"id"`
@@ -20,8 +19,9 @@ type Joke struct {
 	Text string `json:"text"`
 }
 
-type Resource struct {
-	ID    int64  `json:"id"`
-	Key   string `json:"key"`
-	Value string `json:"value"`
+type SchemaMigration struct {
+	Component string    `json:"component"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
 }
@@ -1,7 +1,6 @@
 package cook
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -16,6 +15,7 @@ import (
 
 	sa "github.com/pancsta/secai/examples/cook/schema"
 	"github.com/pancsta/secai/examples/cook/states"
+	"github.com/pancsta/secai/plan"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -32,6 +32,13 @@ func (a *Agent) CharacterReadyState(e *am.Event) {
 	a.DocCharacter.AddToPrompts(a.pGenJokes, a.pIngredientsPicking, a.pRecipePicking, a.pGenStepComments)
 }
 
+func (a *Agent) FactsReadyState(e *am.Event) {
+	// call super
+	a.AgentLLM.FactsReadyState(e)
+
+	a.DocFacts.AddToPrompts(a.pIngredientsPicking, a.pRecipePicking, a.pGenSteps, a.pGenStepComments)
+}
+
 func (a *Agent) GenJokesEnter(e *am.Event) bool {
 	return len((*a.jokes.Load()).Jokes) == 0
 }
@@ -114,6 +121,11 @@ func (a *Agent) GenJokesEnd(e *am.Event) {
 	a.pGenJokes.HistClean()
 }
 
+func (a *Agent) GenStepCommentsEnter(e *am.Event) bool {
+	// comments restored from the previous session
+	return !e.Machine().Is(S{ss.SessionResumed, ss.StepCommentsReady})
+}
+
 func (a *Agent) GenStepCommentsState(e *am.Event) {
 
 	// collect
@@ -198,6 +210,10 @@ func (a *Agent) GenStepCommentsEnd(e *am.Event) {
 }
 
 func (a *Agent) GenStepsEnter(e *am.Event) bool {
+	// steps restored from the previous session
+	if e.Machine().Is(S{ss.SessionResumed, ss.StepsReady}) {
+		return false
+	}
 	recipe := a.recipe.Load()
 	return recipe != nil
 }
@@ -216,7 +232,7 @@ func (a *Agent) GenStepsState(e *am.Event) {
 		var err error
 		// try 5 times TODO config
 		for i := range 5 {
-			res := &sa.ResultGenSteps{}
+			res := &plan.Result{}
 			if i > 0 {
 				a.Log("GenSteps", "try", i)
 			}
@@ -242,27 +258,31 @@ func (a *Agent) GenStepsState(e *am.Event) {
 				}
 			}
 
-			memSchema, newNames, err := a.processStepSchema(ctx, res)
+			var steps *plan.Plan
+			steps, err = a.processStepSchema(res)
 
 			// try to set if OK
 			if err == nil {
-				err = a.mem.SetSchema(memSchema, newNames)
+				err = steps.Apply(a.mem)
 			}
 
 			// handle both errs
 			if err != nil {
 				a.LogErr("GenSteps_bad_schema", err,
-					"schema", memSchema,
-					"states", newNames,
+					"schema", steps.Merged,
+					"states", steps.Names,
 				)
 
+				// re-ask with feedback
+				params.Feedback = steps.Feedback(a.planner.Prefix)
+
 				// try again
 				continue
 			}
 
-			// next
+			// subscribe to new steps and next
+			a.StoriesBind()
 			mach.EvAdd1(e, ss.StepsReady, nil)
-			mach.EvAdd1(e, ss.CheckStories, nil)
 			break
 		}
 
@@ -364,6 +384,7 @@ func (a *Agent) StepsReadyState(e *am.Event) {
 
 func (a *Agent) StepsReadyEnd(e *am.Event) {
 	mach := a.Mach()
+	mach.EvRemove1(e, ss.SessionResumed, nil)
 
 	// reset buttons
 	a.stories[ss.StoryCookingStarted].Actions = a.stories[ss.StoryCookingStarted].Actions[0:1]
@@ -391,49 +412,20 @@ func (a *Agent) StepsReadyEnd(e *am.Event) {
 
 // ///// ///// /////
 
-func (a *Agent) processStepSchema(ctx context.Context, res *sa.ResultGenSteps) (am.Schema, am.S, error) {
+// processStepSchema turns a generated schema into a plan for the memory machine.
+func (a *Agent) processStepSchema(res *plan.Result) (*plan.Plan, error) {
 	// TODO prevent clicking MealReady
-	//
+	a.ValFile(nil, "steps", res.Schema, "yaml")
 
-	schemaRAW := res.Schema
-	a.ValFile(nil, "steps", schemaRAW, "yaml")
-
-	// prefix and checksum the schema TODO why count?
-	cBefore := 0
-	cAfter := 0
-	for _, state := range schemaRAW {
-		cBefore += amhelp.CountRelations(&state)
-	}
-	// prefix state names
-	schema := amhelp.PrefixStates(schemaRAW, "Step", true, nil, nil)
-	for _, state := range schema {
-		cAfter += amhelp.CountRelations(&state)
-
-		// prefer require over remove TODO fix the other state the opposite way?
-		for _, name := range state.Require {
-			slices.DeleteFunc(state.Remove, func(s string) bool {
-				return s == name
-			})
-		}
-	}
-
-	if cBefore != cAfter {
-		err := fmt.Errorf("%w: %d before, %d after", am.ErrSchema, cBefore, cAfter)
-		return nil, nil, err
+	steps, err := a.planner.Process(a.mem.Schema(), a.mem.StateNames(), res.Schema)
+	for _, issue := range steps.Issues {
+		a.Log("GenSteps_issue", "issue", issue.String(), "repaired", issue.Repaired)
 	}
-
-	// merge steps schema into memory
-	memSchema := am.SchemaMerge(a.mem.Schema(), schema)
-	stepNames := sortSteps(schema)
-	newNames := slices.Concat(a.mem.StateNames(), stepNames)
-
-	a.ValFile(nil, "mem", memSchema, "yaml")
-
-	err := validateStepSchema(memSchema, stepNames, newNames)
 	if err != nil {
-		a.ValFile(nil, "steps-failed", schemaRAW, "yaml")
-		return nil, nil, err
+		a.ValFile(nil, "steps-failed", res.Schema, "yaml")
+		return steps, err
 	}
+	a.ValFile(nil, "mem", steps.Merged, "yaml")
 
-	return memSchema, newNames, nil
+	return steps, nil
 }
@@ -3,6 +3,7 @@ package cook
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -21,7 +22,9 @@ import (
 	"github.com/pancsta/secai/examples/cook/db"
 	sa "github.com/pancsta/secai/examples/cook/schema"
 	"github.com/pancsta/secai/examples/cook/states"
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
+	ssbase "github.com/pancsta/secai/states"
 	"github.com/pancsta/secai/tui"
 	"github.com/pancsta/secai/web"
 )
@@ -59,6 +62,14 @@ func (a *Agent) StartState(e *am.Event) {
 	mach.EvAdd1(e, ss.UIMode, nil)
 	mach.EvAdd1(e, ss.Mock, nil)
 
+	// start tools
+	a.tHistory.Mach().Add1(ssbase.ToolStates.Start, nil)
+	for _, srv := range a.tMCP {
+		for _, t := range srv.Tools {
+			t.Mach().Add1(ssbase.ToolStates.Start, nil)
+		}
+	}
+
 	a.handlersWeb = &web.Handlers{A: a}
 	mach.AddErr(mach.BindHandlers(a.handlersWeb), nil)
 
@@ -174,16 +185,23 @@ func (a *Agent) AnyState(e *am.Event) {
 	tx := e.Transition()
 	mtime := mach.Time(nil).Sum(nil)
 
-	// refresh stories on state changes but avoid recursion and DUPs
-	// TODO bind each story directly via wait methods (maybe a group?)
+	// refresh stories' buttons on state changes but avoid recursion and DUPs (triggers are checked by the base agent)
 	skipCalled := S{ss.CheckStories, ss.StoryChanged, ss.Healthcheck, ss.Loop, ss.Requesting,
 		ss.RequestingAI, ss.RequestedAI, ss.Heartbeat, ss.UIRenderStories, ss.UICleanOutput, ss.UIUpdateClock}
 	called := tx.Mutation.CalledIndex(mach.StateNames())
 	if a.lastStoryCheck != mtime && called.Not(skipCalled) && !mach.WillBe1(ss.CheckStories) {
-		mach.EvAdd1(e, ss.CheckStories, nil)
+		a.renderStories(e)
 	}
 	a.lastStoryCheck = mtime
 
+	// persist the flow for resuming
+	added, removed := e.Transition().TimeIndexDiff()
+	names := slices.Concat(added.ActiveStates(nil), removed.ActiveStates(nil))
+	flow := SAdd(states.CookGroups.Flow, S{ss.StepCompleted})
+	if slices.ContainsFunc(names, func(s string) bool { return slices.Contains(flow, s) }) {
+		a.saveSnapshot(e)
+	}
+
 	// redraw clock
 	hist, err := a.Hist()
 	if err != nil {
@@ -191,8 +209,6 @@ func (a *Agent) AnyState(e *am.Event) {
 	}
 
 	// redraw on tracked changed
-	added, removed := e.Transition().TimeIndexDiff()
-	names := slices.Concat(added.ActiveStates(nil), removed.ActiveStates(nil))
 	for _, s := range names {
 		if hist.IsTracked1(s) {
 			a.Mach().EvAdd1(e, ss.UIUpdateClock, nil)
@@ -215,128 +231,13 @@ func (a *Agent) HeartbeatState(e *am.Event) {
 }
 
 func (a *Agent) CheckStoriesState(e *am.Event) {
-	// TODO debounce using schedule
-	// TODO move to base agent?
-	// TODO bind to When methods, dont re-run each time on AnyState
-	mach := a.Mach()
-
-	var stateList S
-	var activateList []bool
-	for _, s := range a.stories {
-		// TODO env const
-		isDebug := os.Getenv("SECAI_DEBUG_STORY") == s.State
-		if isDebug {
-			a.Log("checking", "story", s.State)
-		}
-
-		// validate
-		if !mach.Has1(s.State) {
-			mach.AddErr(fmt.Errorf("%w: %s", am.ErrStateMissing, s.State), nil)
-			continue
-		}
-
-		s.Tick = mach.Tick(s.State)
-		// this story should be active
-		activate := false
-		// this story has automatic triggers
-		hasTriggers := false
-
-		// dont activate without passing triggers
-
-		// check the agent machine
-		if !s.Agent.Trigger.IsEmpty() {
-			activate = s.Agent.Trigger.Check(s.Agent.Mach)
-			if isDebug {
-				a.Log("cook", "check", activate)
-			}
-			hasTriggers = true
-		}
-
-		// check the memory machine
-		if !s.Memory.Trigger.IsEmpty() {
-			check := s.Memory.Trigger.Check(s.Memory.Mach)
-			activate = (activate || !hasTriggers) && check
-			if isDebug {
-				a.Log("memory", "check", check)
-			}
-			hasTriggers = true
-		}
-
-		// manual story
-		if !hasTriggers {
-			if isDebug {
-				a.Log("no triggers", "story", s.State)
-			}
-			continue
-		}
-
-		// add to the list after a passed "impossibility check"
-		if mach.Is1(s.State) && !activate && !amhelp.CantRemove1(mach, s.State, nil) ||
-			mach.Not1(s.State) && activate && !amhelp.CantAdd1(mach, s.State, nil) {
-
-			if isDebug {
-				a.Log("story changed", "story", s.State)
-			}
-			stateList = append(stateList, s.State)
-			activateList = append(activateList, activate)
-		}
-	}
-
-	// apply the changes if any
-	if len(stateList) > 0 {
-		mach.EvAdd1(e, ss.StoryChanged, Pass3(&A3{
-			StatesList:   stateList,
-			ActivateList: activateList,
-		}))
-	}
+	// call super
+	a.AgentLLM.CheckStoriesState(e)
 
 	// re-render all buttons
 	a.renderStories(e)
 }
 
-func (a *Agent) StoryChangedState(e *am.Event) {
-	mach := a.Mach()
-	args := ParseArgs(e.Args)
-	states := args.StatesList
-	activates := args.ActivateList
-
-	for i, name := range states {
-		activate := activates[i]
-		s := a.stories[name]
-
-		if s == nil {
-			a.Log("story not found", "state", name)
-			continue
-		}
-
-		// deactivate
-		if mach.Is1(s.State) && !activate {
-			res := mach.EvRemove1(e, s.State, nil)
-
-			// TODO handle Queued?
-			if res != am.Canceled {
-				s.Agent.TimeDeactivated = mach.Time(nil)
-				s.Memory.TimeDeactivated = a.mem.Time(nil)
-				s.DeactivatedAt = time.Now()
-				s.LastActiveTicks = s.Agent.TimeDeactivated.Sum(nil) -
-					s.Agent.TimeActivated.Sum(nil)
-			}
-
-			// activate
-		} else if mach.Not1(s.State) && activate {
-			res := mach.EvAdd1(e, s.State, nil)
-
-			// TODO handle Queued?
-			if res != am.Canceled {
-				s.Agent.TimeActivated = mach.Time(nil)
-				s.Memory.TimeActivated = a.mem.Time(nil)
-			} else {
-				a.Log("failed to activate", "state", name)
-			}
-		}
-	}
-}
-
 func (a *Agent) InterruptedState(e *am.Event) {
 	// call super
 	a.AgentLLM.InterruptedState(e)
@@ -393,6 +294,7 @@ func (a *Agent) SSHConnState(e *am.Event) {
 	uiMain := tui.NewTui(mach, a.Logger(), a.ConfigBase(),
 		// TODO remote addr of local fwder, not the browser
 		sess.RemoteAddr().String())
+	uiMain.Locale = a.Locale()
 
 	// screen init is required for cview, but not for tview TODO still?
 	if err := screen.Init(); err != nil {
@@ -531,10 +433,53 @@ func (a *Agent) SSHReadyState(e *am.Event) {
 }
 
 func (a *Agent) UIMsgState(e *am.Event) {
+	// call super
+	a.AgentLLM.UIMsgState(e)
+
 	msg := ParseArgs(e.Args).Msg
 	a.msgs = append(a.msgs, msg)
 }
 
+func (a *Agent) BaseDBReadyState(e *am.Event) {
+	// call super
+	a.AgentLLM.BaseDBReadyState(e)
+
+	mach := a.Mach()
+	ctx := mach.NewStateCtx(ss.BaseDBReady)
+
+	// restore the transcript of previous sessions
+	mach.Fork(ctx, e, func() {
+		msgs, err := a.RestoreMsgs(ctx)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			mach.EvAddErrState(e, ss.ErrDB, err, nil)
+			return
+		}
+		if len(msgs) > 0 {
+			mach.Eval("restore_msgs", func() {
+				a.msgs = slices.Concat(msgs, a.msgs)
+			}, ctx)
+		}
+
+		// offer to resume the previous session
+		snap, err := a.PrevSnapshot(ctx)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			mach.EvAddErrState(e, ss.ErrDB, err, nil)
+			return
+		}
+		if snap == nil || !snap.Mach(mach.Id()).Is1(ss.IngredientsReady) {
+			return
+		}
+		a.prevSnapshot.Store(snap)
+		mach.EvAdd1(e, ss.SessionResumable, nil)
+	})
+}
+
 func (a *Agent) PromptEnter(e *am.Event) bool {
 	// call super
 	if !a.AgentLLM.PromptEnter(e) {
@@ -647,8 +592,8 @@ func (a *Agent) DBStartingState(e *am.Event) {
 	ctx := mach.NewStateCtx(ss.DBStarting)
 
 	mach.Fork(ctx, e, func() {
-		dbFile := filepath.Join(a.Config.Agent.Dir, "cook.sqlite")
-		conn, _, err := db.Open(dbFile)
+		dbFile := filepath.Join(a.Config.Agent.Dir, db.File)
+		conn, _, err := db.Open(ctx, dbFile)
 		if ctx.Err() != nil {
 			return // expired
 		}
@@ -778,7 +723,9 @@ func (a *Agent) StoryActionState(e *am.Event) {
 	}
 
 	// TODO move to Enter
-	if action == nil {
+	if action == nil && (a.OrientingAction(e, id) || a.FactAction(e, id)) {
+		return
+	} else if action == nil {
 		a.Mach().EvAddErr(e, fmt.Errorf("action not found: %s", id), nil)
 		return
 	}
@@ -868,7 +815,7 @@ func (a *Agent) StoryIngredientsPickingState(e *am.Event) {
 			params.Prompt = a.UserInput
 
 			// run the prompt (checks ctx)
-			res, err := llm.Exec(e, params)
+			res, ref, err := llm.ExecRef(e, params)
 			if ctx.Err() != nil {
 				return // expired
 			}
@@ -915,13 +862,13 @@ func (a *Agent) StoryIngredientsPickingState(e *am.Event) {
 				break
 			}
 
-			msg := fmt.Sprintf("I need at least %d ingredients to continue.", a.Config.Cook.MinIngredients)
 			if res.RedoMsg == "" {
 				mach.EvAddErr(e, fmt.Errorf("not enough ingredients, but redo msg empty"), nil)
+				a.Output(fmt.Sprintf("I need at least %d ingredients to continue.", a.Config.Cook.MinIngredients),
+					shared.FromAssistant)
 			} else {
-				msg = res.RedoMsg
+				a.OutputPrompt(res.RedoMsg, shared.FromAssistant, ref)
 			}
-			a.Output(msg, shared.FromAssistant)
 
 			// feed back the current list, update the UI, and go again
 			params.Ingredients = res.Ingredients
@@ -972,7 +919,7 @@ func (a *Agent) StoryRecipePickingState(e *am.Event) {
 		for a.loopRecipe.Ok(nil) {
 
 			// run the prompt (checks ctx)
-			res, err := llm.Exec(e, params)
+			res, ref, err := llm.ExecRef(e, params)
 			if ctx.Err() != nil {
 				return // expired
 			}
@@ -994,7 +941,7 @@ func (a *Agent) StoryRecipePickingState(e *am.Event) {
 				a.OfferList[i] = tmpl(&rec)
 			}
 			a.OfferList[lenRecipes] = tmpl(&res.ExtraRecipe)
-			a.Output(res.Summary+"\n\n"+a.BuildOffer(), shared.FromAssistant)
+			a.OutputPrompt(res.Summary+"\n\n"+a.BuildOffer(), shared.FromAssistant, ref)
 
 			// ask the user
 			mach.EvAdd1(e, ss.InputPending, nil)
@@ -1104,7 +1051,9 @@ func (a *Agent) StoryCookingStartedState(e *am.Event) {
 			a.runOrienting(ctx, e)
 
 			// run the prompt (checks ctx)
-			res, err = llm.Exec(e, params)
+			var ref *shared.PromptRef
+			params.Prompt = a.UserInput
+			res, ref, err = llm.ExecRef(e, params)
 			if ctx.Err() != nil {
 				return // expired
 			}
@@ -1113,6 +1062,18 @@ func (a *Agent) StoryCookingStartedState(e *am.Event) {
 				return
 			}
 
+			// questions about the past, run again with the timeline
+			if a.historyQuery(ctx, res.History) {
+				res, ref, err = llm.ExecRef(e, params)
+				if ctx.Err() != nil {
+					return // expired
+				}
+				if err != nil {
+					mach.EvAddErrState(e, ss.ErrAI, err, nil)
+					return
+				}
+			}
+
 			// wait for orienting to finish
 			<-mach.WhenNot1(ss.Orienting, ctx)
 			if ctx.Err() != nil {
@@ -1127,7 +1088,7 @@ func (a *Agent) StoryCookingStartedState(e *am.Event) {
 					Move: move,
 				}))
 			} else if res.Answer != "" {
-				a.Output(res.Answer, shared.FromAssistant)
+				a.OutputPrompt(res.Answer, shared.FromAssistant, ref)
 			}
 		}
 	}()
@@ -1136,6 +1097,11 @@ func (a *Agent) StoryCookingStartedState(e *am.Event) {
 func (a *Agent) storyCookingStartedCleanup(e *am.Event) bool {
 	mach := a.Mach()
 
+	// keep the restored steps
+	if mach.Is(S{ss.SessionResumed, ss.StepsReady}) {
+		return true
+	}
+
 	// remove step states
 	mach.EvRemove(e, S{ss.StepsReady, ss.StepCompleted}, nil)
 
@@ -1221,3 +1187,90 @@ func (a *Agent) StoryStartAgainState(e *am.Event) {
 	a.Mach().EvRemove(e, S{ss.StepsReady, ss.StepCommentsReady, ss.RecipeReady, ss.IngredientsReady}, nil)
 	a.StoryActivate(e, ss.StoryIngredientsPicking)
 }
+
+func (a *Agent) RewoundState(e *am.Event) {
+	// call super
+	a.AgentLLM.RewoundState(e)
+
+	point := ParseArgs(e.Args).Rewind
+	if point == nil {
+		return
+	}
+	a.msgs = point.Msgs(a.msgs)
+	prompts := []secai.PromptApi{a.pIngredientsPicking, a.pRecipePicking, a.pGenSteps, a.pGenStepComments,
+		a.pCookingStarted}
+	for _, p := range prompts {
+		p.HistRewind(point.HTime)
+	}
+}
+
+// ///// ///// /////
+
+// ///// SESSION
+
+// ///// ///// /////
+
+func (a *Agent) SessionResumableState(e *am.Event) {
+	a.Output(a.T(i18n.KeySessionResumable, a.T(i18n.KeyResumeSession)), shared.FromNarrator)
+}
+
+func (a *Agent) SessionResumingEnter(e *am.Event) bool {
+	return a.prevSnapshot.Load() != nil
+}
+
+func (a *Agent) SessionResumingState(e *am.Event) {
+	mach := a.Mach()
+	snap := a.prevSnapshot.Load()
+	prev := snap.Mach(mach.Id())
+
+	// values
+	var ingredients []sa.Ingredient
+	var recipe sa.Recipe
+	var comments sa.ResultGenStepComments
+	okIngredients, err1 := snap.Value(snapIngredients, &ingredients)
+	okRecipe, err2 := snap.Value(snapRecipe, &recipe)
+	okComments, err3 := snap.Value(snapStepComments, &comments)
+	err := errors.Join(err1, err2, err3)
+	if err == nil && (!okIngredients || !prev.Is1(ss.IngredientsReady)) {
+		err = errors.New("nothing to resume")
+	}
+	if err != nil {
+		mach.EvRemove1(e, ss.SessionResuming, nil)
+		mach.EvAddErrState(e, ss.ErrMem, err, nil)
+		return
+	}
+
+	// memory with ingredients and steps, on a fresh machine
+	if err := a.initMem(); err != nil {
+		mach.EvRemove1(e, ss.SessionResuming, nil)
+		mach.EvAddErrState(e, ss.ErrMem, err, nil)
+		return
+	}
+	if err := shared.RestoreMach(a.mem, snap.Mach(a.mem.Id())); err != nil {
+		mach.EvRemove1(e, ss.SessionResuming, nil)
+		mach.EvAddErrState(e, ss.ErrMem, err, nil)
+		return
+	}
+	a.StoriesBind()
+
+	// flow
+	a.ingredients.Store(&ingredients)
+	flow := S{ss.IngredientsReady}
+	if okRecipe && prev.Is1(ss.RecipeReady) {
+		a.recipe.Store(&recipe)
+		flow = append(flow, ss.RecipeReady)
+		if prev.Is1(ss.StepsReady) && len(a.mem.StateNamesMatch(sa.MatchSteps)) > 0 {
+			flow = append(flow, ss.StepsReady)
+			if okComments && prev.Is1(ss.StepCommentsReady) {
+				a.stepComments.Store(&comments)
+				flow = append(flow, ss.StepCommentsReady)
+			}
+		}
+	}
+	a.prevSnapshot.Store(nil)
+	mach.EvAdd(e, SAdd(flow, S{ss.SessionResumed, ss.CheckStories}), nil)
+}
+
+func (a *Agent) SessionResumedState(e *am.Event) {
+	a.Output(a.T(i18n.KeySessionResumed), shared.FromNarrator)
+}
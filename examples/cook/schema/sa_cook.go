@@ -10,7 +10,9 @@ import (
 	"github.com/pancsta/secai"
 	sa "github.com/pancsta/secai/agent_llm/schema"
 	"github.com/pancsta/secai/examples/cook/states"
+	"github.com/pancsta/secai/plan"
 	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/tools/history"
 )
 
 var sp = shared.Sp
@@ -158,19 +160,15 @@ type ResultRecipePicking struct {
 
 // STEPS
 
-type PromptGenSteps = secai.Prompt[ParamsGenSteps, ResultGenSteps]
+type PromptGenSteps = secai.Prompt[ParamsGenSteps, plan.Result]
 
 func NewPromptGenSteps(agent shared.AgentBaseAPI) *PromptGenSteps {
-	p := secai.NewPrompt[ParamsGenSteps, ResultGenSteps](
+	return plan.NewPrompt[ParamsGenSteps](
 		agent, ss.GenSteps, `
 			- You're a cooking process planner.
 		`, `
-			1. Extract actionable steps from the cooking recipe and represent them as binary flags called "states". Each step can represent either a long-running action (eg WaterHeatingUp), a short-running action (WaterBoiling), a fact (WaterBoiled). Each state can relate to any other state via Require, Remove, and Add relation.
-			1. The final and mandatory state is called MealReady.
-			1. Not all the states have to be connected with relations.
-			1. Put the time length of procedures (if given) inside Tags as "time:5m" to wait for 5min.
-			1. Index the steps using a tag "idx:4" for the 5th step in the input. Steps which can't be active at the same time should have Remove relation between them.
-			
+			Extract actionable steps from the cooking recipe.
+		`, "MealReady", `
 			Example "make turkish coffee":
 			- WaterHeatingUp
 				- Remove: WaterBoiling, WaterBoiled
@@ -210,22 +208,13 @@ func NewPromptGenSteps(agent shared.AgentBaseAPI) *PromptGenSteps {
 			- MealReady
 				- Auto: true
 				- Require: MealBaked
-		`, `
-			2 states CAN'T require and remove each other - these relations are for a single point in time. Skip empty fields (null, false). Start the "idx:" counter from 1. If the same "idx" tag is present for more than 1 state, pick a final state from the same group "idx" group and mark it with a "final" tag (eg WaterBoiled is a final state for WaterBoiling).
 		`)
-
-	// short history
-	p.HistoryMsgLen = 1
-
-	return p
 }
 
 type ParamsGenSteps struct {
 	Recipe Recipe
-}
-
-type ResultGenSteps struct {
-	Schema am.Schema
+	// Feedback lists problems of the previous attempt.
+	Feedback []string
 }
 
 // STEP COMMENTS
@@ -265,6 +254,7 @@ func NewPromptCookingStarted(agent shared.AgentBaseAPI) *PromptCookingStarted {
 		`, `
 			1. Answer questions about the cooking process. Keep the tone of the character's personality.
 			2. Use the full recipe and steps as a context.
+			3. For questions about the past (how long something took, what happened before something), request the Timeline of Events via History, unless it's already in the context.
 		`, `
 			Answering is optional. Dont answer rhetorical questions or vague statements. Sometimes simply acknowledge the question.
 		`)
@@ -273,11 +263,15 @@ func NewPromptCookingStarted(agent shared.AgentBaseAPI) *PromptCookingStarted {
 type ParamsCookingStarted struct {
 	Recipe         Recipe
 	ExtractedSteps []string
+	// The user's message.
+	Prompt string
 }
 
 type ResultCookingStarted struct {
 	// Max 2 sentences, min 3 words.
 	Answer string
+	// Query of the Timeline of Events, to answer a question about the past in the next round. Leave Answer empty then.
+	History *history.Params
 }
 
 // TEMPLATE
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/pancsta/secai/examples/cook/db"
@@ -11,7 +12,7 @@ var schemaFile = "db/schema.sql"
 func main() {
 
 	// init DB
-	_, schema, err := db.Open("file::memory:")
+	_, schema, err := db.Open(context.Background(), "file::memory:")
 	if err != nil {
 		panic(err)
 	}
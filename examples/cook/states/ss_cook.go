@@ -38,6 +38,15 @@ type CookStatesDef struct {
 	// One of the cooking steps have been completed.
 	StepCompleted string
 
+	// session
+
+	// SessionResumable is when a snapshot of a previous session is available.
+	SessionResumable string
+	// SessionResuming restores the flow and the memory from the previous session.
+	SessionResuming string
+	// SessionResumed is when the flow has been restored, which skips re-generating the restored steps.
+	SessionResumed string
+
 	// stories
 
 	// StoryJoke indicates that the joke story is currently happening.
@@ -90,6 +99,8 @@ type CookGroupsDef struct {
 	Jokes S
 	// List of main flow states.
 	MainFlow S
+	// Flow are the ready states of the flow, from ingredients to step comments.
+	Flow S
 }
 
 // CookSchema represents all relations and properties of CookStates.
@@ -109,6 +120,15 @@ var CookSchema = SchemaMerge(
 		ssC.RecipeReady:      {Require: S{ssC.IngredientsReady}},
 		ssC.StepCompleted:    {Multi: true},
 
+		// session
+
+		ssC.SessionResumable: {},
+		ssC.SessionResuming: {
+			Require: S{ssC.SessionResumable, ssC.Ready},
+			Remove:  S{ssC.SessionResumed},
+		},
+		ssC.SessionResumed: {Remove: S{ssC.SessionResumable, ssC.SessionResuming}},
+
 		// stories
 
 		ssC.StoryJoke:               {},
@@ -196,6 +216,7 @@ var (
 	sgC = am.NewStateGroups(CookGroupsDef{
 		MainFlow: S{ssC.StoryWakingUp, ssC.StoryIngredientsPicking, ssC.StoryRecipePicking, ssC.StoryCookingStarted,
 			ssC.StoryMealReady},
+		Flow:          S{ssC.IngredientsReady, ssC.RecipeReady, ssC.StepsReady, ssC.StepCommentsReady},
 		Stories:       stories,
 		BootGen:       S{ssC.GenCharacter, ssC.GenJokes, ssC.GenResources},
 		BootGenReady:  S{ssC.CharacterReady, ssC.JokesReady, ssC.ResourcesReady},
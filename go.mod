@@ -47,6 +47,7 @@ require (
 	github.com/jaytaylor/html2text v0.0.0-20230321000545-74c2419ad056
 	github.com/joho/godotenv v1.5.1
 	github.com/lithammer/dedent v1.1.0
+	github.com/mark3labs/mcp-go v0.44.0
 	github.com/navidys/tvxwidgets v0.11.0
 	github.com/ncruces/go-sqlite3 v0.30.4
 	github.com/ncruces/go-sqlite3/gormlite v0.30.2
@@ -63,6 +64,7 @@ require (
 	github.com/sblinch/kdl-go v0.0.0-20251203232544-981d4ecc17c3
 	github.com/stretchr/testify v1.11.1
 	github.com/teivah/onecontext v1.3.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/sync v0.19.0
 	google.golang.org/genai v1.28.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
@@ -462,6 +464,8 @@ require (
 	github.com/ulikunitz/xz v0.5.15 // indirect
 	github.com/urfave/cli/v2 v2.25.7 // indirect
 	github.com/vbatts/tar-split v0.12.2 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/wagoodman/go-progress v0.0.0-20230925121702-07e42b3cdba0 // indirect
 	github.com/wasilibs/go-pgquery v0.0.0-20250409022910-10ac41983c07 // indirect
 	github.com/wasilibs/wazero-helpers v0.0.0-20240620070341-3dff1577cd52 // indirect
@@ -470,6 +474,7 @@ require (
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
+	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
 	github.com/yudai/hcl v0.0.0-20151013225006-5fa2393b3552 // indirect
 	github.com/yuin/goldmark v1.7.4 // indirect
 	github.com/zyedidia/clipper v0.1.1 // indirect
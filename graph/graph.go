@@ -0,0 +1,309 @@
+// Package graph exports stories with their triggers, actions and schema relations as Mermaid or Graphviz (DOT)
+// diagrams. Active states can be highlighted.
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/shared"
+)
+
+// ErrFormat means the output format isn't supported.
+var ErrFormat = errors.New("unknown graph format")
+
+type Format string
+
+const (
+	FormatMermaid Format = "mermaid"
+	FormatDOT     Format = "dot"
+)
+
+type NodeKind string
+
+const (
+	// KindStory is a story state of the agent.
+	KindStory NodeKind = "story"
+	// KindState is a regular state of the agent.
+	KindState NodeKind = "state"
+	// KindMem is a state of the memory machine.
+	KindMem NodeKind = "mem"
+)
+
+type EdgeKind string
+
+const (
+	// EdgeTrigger is a [amhelp.Cond] trigger leading to a story.
+	EdgeTrigger EdgeKind = "trigger"
+	// EdgeTriggerNot is a negated trigger.
+	EdgeTriggerNot EdgeKind = "not"
+	// EdgeHist is a [shared.HistTrigger].
+	EdgeHist EdgeKind = "hist"
+	// EdgeAction is an action of a story adding or removing a state.
+	EdgeAction EdgeKind = "action"
+	// EdgeRelation is a schema relation of a story.
+	EdgeRelation EdgeKind = "relation"
+)
+
+// memPrefix separates memory states from the agent's ones.
+const memPrefix = "mem_"
+
+type Node struct {
+	// ID is unique within the graph.
+	ID     string
+	State  string
+	Label  string
+	Kind   NodeKind
+	Active bool
+}
+
+type Edge struct {
+	From  string
+	To    string
+	Label string
+	Kind  EdgeKind
+}
+
+// Graph of stories, see [New].
+type Graph struct {
+	Nodes []*Node
+	Edges []*Edge
+}
+
+// New creates a graph of [stories], with relations from the agent's [schema] (optional).
+func New(stories []*shared.Story, schema am.Schema) *Graph {
+	g := &Graph{}
+
+	for _, s := range stories {
+		label := s.Title
+		if label == "" {
+			label = s.State
+		}
+		story := g.node(s.State, KindStory)
+		story.Label = label
+
+		// triggers
+		g.condEdges(story, s.Agent.Trigger, KindState)
+		g.condEdges(story, s.Memory.Trigger, KindMem)
+		for _, t := range s.Agent.HistTriggers {
+			g.edge(g.node(t.State, KindState), story, histLabel(t), EdgeHist)
+		}
+		for _, t := range s.Memory.HistTriggers {
+			g.edge(g.node(t.State, KindMem), story, histLabel(t), EdgeHist)
+		}
+
+		// actions
+		for _, act := range s.Actions {
+			if act.StateAdd != "" {
+				g.edge(story, g.node(act.StateAdd, KindState), "add: "+act.Label, EdgeAction)
+			}
+			if act.StateRemove != "" {
+				g.edge(story, g.node(act.StateRemove, KindState), "remove: "+act.Label, EdgeAction)
+			}
+		}
+	}
+
+	// relations between the existing nodes only
+	for _, s := range stories {
+		state := schema[s.State]
+		for rel, targets := range map[string]am.S{"require": state.Require, "add": state.Add, "remove": state.Remove} {
+			for _, target := range targets {
+				if n := g.Node(target); n != nil && target != s.State {
+					g.edge(g.Node(s.State), n, rel, EdgeRelation)
+				}
+			}
+		}
+	}
+
+	// stable output
+	slices.SortStableFunc(g.Edges, func(a, b *Edge) int {
+		return strings.Compare(a.From+a.To+a.Label, b.From+b.To+b.Label)
+	})
+
+	return g
+}
+
+// Node returns a node of the agent's [state], or nil.
+func (g *Graph) Node(state string) *Node {
+	return g.nodeByID(state)
+}
+
+// SetActive marks active nodes using the agent's and memory's machines (both optional).
+func (g *Graph) SetActive(agent, mem am.Api) {
+	for _, n := range g.Nodes {
+		mach := agent
+		if n.Kind == KindMem {
+			mach = mem
+		}
+		n.Active = mach != nil && mach.Has1(n.State) && mach.Is1(n.State)
+	}
+}
+
+// Render returns the graph in the requested format.
+func (g *Graph) Render(format Format) (string, error) {
+	switch format {
+	case FormatMermaid:
+		return g.Mermaid(), nil
+	case FormatDOT:
+		return g.DOT(), nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrFormat, format)
+}
+
+// Mermaid returns a Mermaid flowchart.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	var active []string
+	for _, n := range g.Nodes {
+		label := mermaidEsc(n.Label)
+		switch n.Kind {
+		case KindStory:
+			fmt.Fprintf(&b, "    %s([\"%s\"])\n", n.ID, label)
+		case KindMem:
+			fmt.Fprintf(&b, "    %s[/\"%s\"/]\n", n.ID, label)
+		default:
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", n.ID, label)
+		}
+		if n.Active {
+			active = append(active, n.ID)
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		switch e.Kind {
+		case EdgeTriggerNot, EdgeRelation:
+			arrow = "-.->"
+		case EdgeAction:
+			arrow = "==>"
+		}
+		fmt.Fprintf(&b, "    %s %s|\"%s\"| %s\n", e.From, arrow, mermaidEsc(e.Label), e.To)
+	}
+
+	if len(active) > 0 {
+		b.WriteString("    classDef active fill:#22c55e,stroke:#15803d,color:#000\n")
+		fmt.Fprintf(&b, "    class %s active\n", strings.Join(active, ","))
+	}
+
+	return b.String()
+}
+
+// DOT returns a Graphviz digraph.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph stories {\n")
+	b.WriteString("    rankdir=LR;\n")
+	b.WriteString("    node [shape=box, fontname=\"sans-serif\"];\n")
+
+	for _, n := range g.Nodes {
+		attrs := []string{fmt.Sprintf("label=%q", n.Label)}
+		styles := []string{}
+		switch n.Kind {
+		case KindStory:
+			styles = append(styles, "rounded")
+		case KindMem:
+			attrs = append(attrs, "shape=parallelogram")
+		}
+		if n.Active {
+			styles = append(styles, "filled")
+			attrs = append(attrs, "fillcolor=palegreen")
+		}
+		if len(styles) > 0 {
+			attrs = append(attrs, fmt.Sprintf("style=%q", strings.Join(styles, ",")))
+		}
+		fmt.Fprintf(&b, "    %q [%s];\n", n.ID, strings.Join(attrs, ", "))
+	}
+
+	for _, e := range g.Edges {
+		attrs := []string{fmt.Sprintf("label=%q", e.Label)}
+		switch e.Kind {
+		case EdgeTriggerNot:
+			attrs = append(attrs, "style=dashed", "arrowhead=tee")
+		case EdgeRelation:
+			attrs = append(attrs, "style=dotted")
+		case EdgeAction:
+			attrs = append(attrs, "style=bold")
+		}
+		fmt.Fprintf(&b, "    %q -> %q [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (g *Graph) condEdges(story *Node, cond amhelp.Cond, kind NodeKind) {
+	for _, state := range cond.Is {
+		g.edge(g.node(state, kind), story, "is", EdgeTrigger)
+	}
+	for _, state := range cond.Any1 {
+		g.edge(g.node(state, kind), story, "any", EdgeTrigger)
+	}
+	for _, group := range cond.Any {
+		for _, state := range group {
+			g.edge(g.node(state, kind), story, "any", EdgeTrigger)
+		}
+	}
+	for _, state := range cond.Not {
+		g.edge(g.node(state, kind), story, "not", EdgeTriggerNot)
+	}
+	for _, state := range slices.Sorted(maps.Keys(cond.Clock)) {
+		g.edge(g.node(state, kind), story, "clock", EdgeTrigger)
+	}
+}
+
+// node returns an existing node or creates a new one.
+func (g *Graph) node(state string, kind NodeKind) *Node {
+	id := state
+	if kind == KindMem {
+		id = memPrefix + state
+	}
+	if n := g.nodeByID(id); n != nil {
+		// stories can be referenced before being added
+		if kind == KindStory {
+			n.Kind = KindStory
+		}
+		return n
+	}
+
+	n := &Node{ID: id, State: state, Label: state, Kind: kind}
+	g.Nodes = append(g.Nodes, n)
+
+	return n
+}
+
+func (g *Graph) nodeByID(id string) *Node {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (g *Graph) edge(from, to *Node, label string, kind EdgeKind) {
+	for _, e := range g.Edges {
+		if e.From == from.ID && e.To == to.ID && e.Label == label {
+			return
+		}
+	}
+	g.Edges = append(g.Edges, &Edge{From: from.ID, To: to.ID, Label: label, Kind: kind})
+}
+
+func histLabel(t shared.HistTrigger) string {
+	return strings.TrimPrefix(t.String(), t.State+" ")
+}
+
+func mermaidEsc(txt string) string {
+	return strings.ReplaceAll(txt, `"`, "#quot;")
+}
@@ -0,0 +1,28 @@
+//go:build !wasm
+
+package graph
+
+import (
+	"github.com/pancsta/secai/shared"
+)
+
+// FromAgent creates a graph of all the stories of [agent], with the current active states marked.
+func FromAgent(agent shared.AgentAPI) *Graph {
+	var stories []*shared.Story
+	for _, info := range agent.Stories() {
+		if s := agent.Story(info.State); s != nil {
+			stories = append(stories, s)
+		}
+	}
+
+	mach := agent.Mach()
+	g := New(stories, mach.Schema())
+	// avoid typed nil
+	if mem := agent.MachMem(); mem != nil {
+		g.SetActive(mach, mem)
+	} else {
+		g.SetActive(mach, nil)
+	}
+
+	return g
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pancsta/secai/shared"
+)
+
+func TestNew(t *testing.T) {
+	schema := am.Schema{
+		"Ready":    {},
+		"StoryFoo": {Remove: am.S{"StoryBar"}},
+		"StoryBar": {},
+		"Add":      {},
+	}
+	stories := []*shared.Story{
+		{
+			StoryInfo: shared.StoryInfo{State: "StoryFoo", Title: "Foo \"1\""},
+			Agent:     shared.StoryActor{Trigger: amhelp.Cond{Is: am.S{"Ready"}, Not: am.S{"StoryBar"}}},
+			Memory:    shared.StoryActor{Trigger: amhelp.Cond{Is: am.S{"Step"}}},
+			Actions:   []shared.Action{{Label: "Go", StateAdd: "Add"}},
+		},
+		{
+			StoryInfo: shared.StoryInfo{State: "StoryBar"},
+			Agent:     shared.StoryActor{HistTriggers: []shared.HistTrigger{{State: "Ready", ActiveFor: 1e9}}},
+		},
+	}
+	g := New(stories, schema)
+
+	assert.Len(t, g.Nodes, 5)
+	assert.Equal(t, KindStory, g.Node("StoryBar").Kind)
+	assert.Equal(t, KindMem, g.nodeByID("mem_Step").Kind)
+	assert.Len(t, g.Edges, 6)
+
+	mach := am.New(t.Context(), schema, nil)
+	mach.Add1("Ready", nil)
+	g.SetActive(mach, nil)
+	assert.True(t, g.Node("Ready").Active)
+	assert.False(t, g.Node("StoryFoo").Active)
+
+	mermaid, err := g.Render(FormatMermaid)
+	assert.NoError(t, err)
+	assert.Contains(t, mermaid, `StoryFoo(["Foo #quot;1#quot;"])`)
+	assert.Contains(t, mermaid, `StoryBar -.->|"not"| StoryFoo`)
+	assert.Contains(t, mermaid, "class Ready active")
+
+	dot := g.DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph stories {"))
+	assert.Contains(t, dot, `"StoryFoo" -> "Add" [label="add: Go", style=bold];`)
+
+	_, err = g.Render("svg")
+	assert.ErrorIs(t, err, ErrFormat)
+}
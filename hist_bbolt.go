@@ -0,0 +1,31 @@
+//go:build !wasm
+
+package secai
+
+import (
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	amhistbb "github.com/pancsta/asyncmachine-go/pkg/history/bbolt"
+)
+
+// HistBBolt returns the bbolt history backend, or nil.
+func (a *AgentBase) HistBBolt() *amhistbb.Memory {
+	mem, _ := a.histBBolt.(*amhistbb.Memory)
+	return mem
+}
+
+// histBBoltNew opens the bbolt history backend in [file].db.
+func (a *AgentBase) histBBoltNew(
+	file string, cfg amhist.BaseConfig, onErr func(err error),
+) (amhist.MemoryApi, error) {
+	db, err := amhistbb.NewDb(file)
+	if err != nil {
+		return nil, err
+	}
+	mem, err := amhistbb.NewMemory(a.ctx, db, a.mach, amhistbb.Config{BaseConfig: cfg}, onErr)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return mem, nil
+}
@@ -0,0 +1,14 @@
+//go:build wasm
+
+package secai
+
+import (
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+)
+
+// histBBoltNew isn't supported in WASM, as bbolt needs mmap.
+func (a *AgentBase) histBBoltNew(
+	file string, cfg amhist.BaseConfig, onErr func(err error),
+) (amhist.MemoryApi, error) {
+	return nil, ErrHistBackend
+}
@@ -0,0 +1,145 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/states"
+	"github.com/pancsta/secai/tui"
+)
+
+// histAgent is a minimal agent, tracking [ss.Mock] in the history.
+type histAgent struct {
+	*AgentBase
+
+	clock chan [][]int
+}
+
+func (a *histAgent) Msgs() []*shared.Msg               { return nil }
+func (a *histAgent) Splash() string                    { return "" }
+func (a *histAgent) MachSchema() (am.Schema, am.S)     { return states.AgentSchema, ss.Names() }
+func (a *histAgent) Actions() []shared.ActionInfo      { return nil }
+func (a *histAgent) Stories() []shared.StoryInfo       { return nil }
+func (a *histAgent) Story(state string) *shared.Story  { return nil }
+func (a *histAgent) DBAgent() *sql.DB                  { return nil }
+func (a *histAgent) MachMem() *am.Machine              { return nil }
+func (a *histAgent) OrientingMoves() map[string]string { return nil }
+func (a *histAgent) HistoryStates() am.S               { return am.S{ss.Mock, ss.REPL} }
+func (a *histAgent) RewindStates() am.S                { return nil }
+
+func (a *histAgent) UIRenderClockState(e *am.Event) {
+	a.clock <- tui.ParseArgs(e.Args).ClockDiff
+}
+
+func TestHistBackends(t *testing.T) {
+	for backend, file := range map[string]string{
+		"memory": "",
+		"sqlite": "machine.sqlite",
+		"bbolt":  "machine.db",
+	} {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			dir := t.TempDir()
+
+			cfg := shared.ConfigDefault()
+			cfg.Agent.ID = "hist-" + backend
+			cfg.Agent.Dir = dir
+			cfg.Agent.History.Backend = backend
+			cfg.Agent.Retention.Interval = 0
+			cfg.AI = shared.ConfigAI{}
+
+			a := &histAgent{
+				AgentBase: NewAgent(ctx, ss.Names(), states.AgentSchema),
+				clock:     make(chan [][]int, 1),
+			}
+			require.NoError(t, a.Init(a, &cfg, nil, states.AgentBaseGroups, states.AgentBaseStates, nil))
+			mach := a.Mach()
+			defer mach.Dispose()
+
+			// no history before starting
+			_, err := a.Hist()
+			assert.ErrorIs(t, err, ErrHistNil)
+
+			// start
+			a.Start()
+			<-mach.When1(ss.HistoryDBReady, ctx)
+			require.NoError(t, ctx.Err(), "history not ready")
+			require.NoError(t, mach.Err())
+			if file != "" {
+				_, err := os.Stat(filepath.Join(dir, file))
+				assert.NoError(t, err)
+			}
+
+			// record
+			for range 3 {
+				mach.Add1(ss.Mock, nil)
+				mach.Remove1(ss.Mock, nil)
+			}
+			hist, err := a.Hist()
+			require.NoError(t, err)
+			// persistent backends write asynchronously
+			require.Eventually(t, func() bool {
+				if hist.Sync() != nil {
+					return false
+				}
+				rows, err := hist.FindLatest(ctx, false, 10, amhist.Query{})
+				return err == nil && len(rows) > 0
+			}, 5*time.Second, 50*time.Millisecond)
+
+			// clock
+			clock := &tui.ClockService{
+				Agent:     mach,
+				Cfg:       &cfg,
+				Hist:      a.Hist,
+				SeriesLen: 1,
+				Height:    4,
+			}
+			require.NoError(t, mach.BindHandlers(clock))
+			mach.Add1(ss.UIMode, nil)
+			mach.Add1(ss.UIUpdateClock, nil)
+			select {
+			case diff := <-a.clock:
+				require.Len(t, diff, 1)
+				assert.NotEmpty(t, diff[0])
+			case <-ctx.Done():
+				t.Fatal("clock not rendered")
+			}
+		})
+	}
+}
+
+func TestRewindMem(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mem, err := am.NewCommon(ctx, "memory", am.Schema{"Foo": {}, "Bar": {}}, am.S{"Foo", "Bar", am.StateException}, nil,
+		nil, nil)
+	require.NoError(t, err)
+	defer mem.Dispose()
+	a := NewAgent(ctx, ss.Names(), states.AgentSchema)
+	require.NoError(t, a.RewindTrackMem(mem))
+
+	mem.Add1("Foo", nil)
+	point := time.Now()
+	mem.Remove1("Foo", nil)
+	mem.Add1("Bar", nil)
+
+	a.rewindMem(point)
+	assert.True(t, mem.Is1("Foo"))
+	assert.False(t, mem.Is1("Bar"))
+
+	// before tracking
+	a.rewindMem(point.Add(-time.Hour))
+	assert.True(t, mem.Is1("Foo"))
+}
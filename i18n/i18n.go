@@ -0,0 +1,245 @@
+// Package i18n provides locale fallbacks and translation catalogs of UI strings, shared by the agent, TUI and web UI.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default is the locale of the builtin strings and the last fallback.
+const Default = "en"
+
+// UI string keys.
+const (
+	KeyMessages           = "ui.messages"
+	KeyPrompt             = "ui.prompt"
+	KeyPlaceholder        = "ui.placeholder"
+	KeyStories            = "ui.stories"
+	KeyActive             = "ui.active"
+	KeyAgoFor             = "ui.ago_for"
+	KeySend               = "ui.send"
+	KeySendMessage        = "ui.send_message"
+	KeySending            = "ui.sending"
+	KeyInterrupt          = "ui.interrupt"
+	KeyResume             = "ui.resume"
+	KeyInterruptedUser    = "agent.interrupted_user"
+	KeyInterruptedTimeout = "agent.interrupted_timeout"
+	KeyResumed            = "agent.resumed"
+	KeyDidYouMean         = "agent.did_you_mean"
+	KeyTranscriptSaved    = "agent.transcript_saved"
+	KeyExport             = "ui.export"
+	KeyUndo               = "ui.undo"
+	KeyRewound            = "agent.rewound"
+	KeyFacts              = "ui.facts"
+	KeyFactNoted          = "agent.fact_noted"
+	KeyFactForgotten      = "agent.fact_forgotten"
+	KeyResumeSession      = "ui.resume_session"
+	KeyResumeSessionDesc  = "ui.resume_session_desc"
+	KeySessionResumable   = "agent.session_resumable"
+	KeySessionResumed     = "agent.session_resumed"
+)
+
+// Catalog maps keys to translated strings (with optional fmt verbs).
+type Catalog map[string]string
+
+// Catalogs maps locales to catalogs.
+type Catalogs map[string]Catalog
+
+// Builtin are the bundled catalogs.
+var Builtin = Catalogs{
+	"en": {
+		KeyMessages:           "Messages",
+		KeyPrompt:             "Prompt",
+		KeyPlaceholder:        "Type your message here...",
+		KeyStories:            "Stories",
+		KeyActive:             "Active",
+		KeyAgoFor:             "%.0fm ago for t%d",
+		KeySend:               "Send",
+		KeySendMessage:        "Send Message",
+		KeySending:            "Sending",
+		KeyInterrupt:          "Interrupt",
+		KeyResume:             "Resume",
+		KeyInterruptedUser:    "Interrupted by the user",
+		KeyInterruptedTimeout: "Interrupted by a timeout",
+		KeyResumed:            "Resumed by the user",
+		KeyDidYouMean:         "Did you mean:",
+		KeyTranscriptSaved:    "Transcript saved to %s",
+		KeyExport:             "Export",
+		KeyUndo:               "Undo",
+		KeyRewound:            "Rewound, dropped: %s",
+		KeyFacts:              "Remembered facts (%d)",
+		KeyFactNoted:          "Noted: %s",
+		KeyFactForgotten:      "Forgotten: %s",
+		KeyResumeSession:      "Resume previous session?",
+		KeyResumeSessionDesc:  "This button restores the progress of the previous session",
+		KeySessionResumable:   "The previous session can be resumed, press \"%s\" to continue where you left off.",
+		KeySessionResumed:     "Resumed the previous session.",
+	},
+	"pl": {
+		KeyMessages:           "Wiadomości",
+		KeyPrompt:             "Polecenie",
+		KeyPlaceholder:        "Wpisz wiadomość...",
+		KeyStories:            "Historie",
+		KeyActive:             "Aktywna",
+		KeyAgoFor:             "%.0fm temu przez t%d",
+		KeySend:               "Wyślij",
+		KeySendMessage:        "Wyślij wiadomość",
+		KeySending:            "Wysyłanie",
+		KeyInterrupt:          "Przerwij",
+		KeyResume:             "Wznów",
+		KeyInterruptedUser:    "Przerwane przez użytkownika",
+		KeyInterruptedTimeout: "Przerwane z powodu limitu czasu",
+		KeyResumed:            "Wznowione przez użytkownika",
+		KeyDidYouMean:         "Czy chodziło o:",
+		KeyTranscriptSaved:    "Zapisano transkrypcję w %s",
+		KeyExport:             "Eksportuj",
+		KeyUndo:               "Cofnij",
+		KeyRewound:            "Cofnięto, usunięto: %s",
+		KeyFacts:              "Zapamiętane fakty (%d)",
+		KeyFactNoted:          "Zapamiętano: %s",
+		KeyFactForgotten:      "Zapomniano: %s",
+		KeyResumeSession:      "Wznowić poprzednią sesję?",
+		KeyResumeSessionDesc:  "Ten przycisk przywraca postęp poprzedniej sesji",
+		KeySessionResumable:   "Poprzednią sesję można wznowić, naciśnij \"%s\", aby kontynuować tam, gdzie skończono.",
+		KeySessionResumed:     "Wznowiono poprzednią sesję.",
+	},
+	"de": {
+		KeyMessages:           "Nachrichten",
+		KeyPrompt:             "Eingabe",
+		KeyPlaceholder:        "Nachricht eingeben...",
+		KeyStories:            "Geschichten",
+		KeyActive:             "Aktiv",
+		KeyAgoFor:             "vor %.0fm für t%d",
+		KeySend:               "Senden",
+		KeySendMessage:        "Nachricht senden",
+		KeySending:            "Senden",
+		KeyInterrupt:          "Unterbrechen",
+		KeyResume:             "Fortsetzen",
+		KeyInterruptedUser:    "Vom Benutzer unterbrochen",
+		KeyInterruptedTimeout: "Wegen Zeitüberschreitung unterbrochen",
+		KeyResumed:            "Vom Benutzer fortgesetzt",
+		KeyDidYouMean:         "Meintest du:",
+		KeyTranscriptSaved:    "Transkript gespeichert in %s",
+		KeyExport:             "Exportieren",
+		KeyUndo:               "Rückgängig",
+		KeyRewound:            "Zurückgespult, entfernt: %s",
+		KeyFacts:              "Gemerkte Fakten (%d)",
+		KeyFactNoted:          "Gemerkt: %s",
+		KeyFactForgotten:      "Vergessen: %s",
+		KeyResumeSession:      "Vorherige Sitzung fortsetzen?",
+		KeyResumeSessionDesc:  "Diese Schaltfläche stellt den Fortschritt der vorherigen Sitzung wieder her",
+		KeySessionResumable:   "Die vorherige Sitzung kann fortgesetzt werden, drücke \"%s\", um dort weiterzumachen, wo du aufgehört hast.",
+		KeySessionResumed:     "Die vorherige Sitzung wurde fortgesetzt.",
+	},
+	"es": {
+		KeyMessages:           "Mensajes",
+		KeyPrompt:             "Entrada",
+		KeyPlaceholder:        "Escribe tu mensaje...",
+		KeyStories:            "Historias",
+		KeyActive:             "Activa",
+		KeyAgoFor:             "hace %.0fm durante t%d",
+		KeySend:               "Enviar",
+		KeySendMessage:        "Enviar mensaje",
+		KeySending:            "Enviando",
+		KeyInterrupt:          "Interrumpir",
+		KeyResume:             "Reanudar",
+		KeyInterruptedUser:    "Interrumpido por el usuario",
+		KeyInterruptedTimeout: "Interrumpido por tiempo de espera",
+		KeyResumed:            "Reanudado por el usuario",
+		KeyDidYouMean:         "¿Quisiste decir?",
+		KeyTranscriptSaved:    "Transcripción guardada en %s",
+		KeyExport:             "Exportar",
+		KeyUndo:               "Deshacer",
+		KeyRewound:            "Rebobinado, descartado: %s",
+		KeyFacts:              "Datos recordados (%d)",
+		KeyFactNoted:          "Anotado: %s",
+		KeyFactForgotten:      "Olvidado: %s",
+		KeyResumeSession:      "¿Reanudar la sesión anterior?",
+		KeyResumeSessionDesc:  "Este botón restaura el progreso de la sesión anterior",
+		KeySessionResumable:   "La sesión anterior se puede reanudar, pulsa \"%s\" para continuar donde lo dejaste.",
+		KeySessionResumed:     "Se reanudó la sesión anterior.",
+	},
+}
+
+// languages are English names of languages, used in LLM prompts.
+var languages = map[string]string{
+	"en": "English",
+	"pl": "Polish",
+	"de": "German",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"cs": "Czech",
+	"uk": "Ukrainian",
+	"ja": "Japanese",
+	"zh": "Chinese",
+}
+
+// Normalize returns [locale] as "ll" or "ll-RR", eg "pt_br" becomes "pt-BR".
+func Normalize(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	// drop the encoding, eg "pl_PL.UTF-8"
+	locale, _, _ = strings.Cut(locale, ".")
+	lang, region, ok := strings.Cut(locale, "-")
+	lang = strings.ToLower(lang)
+	if !ok || region == "" {
+		return lang
+	}
+
+	return lang + "-" + strings.ToUpper(region)
+}
+
+// Base returns the language part of [locale], eg "pt" for "pt-BR".
+func Base(locale string) string {
+	lang, _, _ := strings.Cut(Normalize(locale), "-")
+	return lang
+}
+
+// Fallbacks returns the lookup order for [locale]: the locale, its base language, [def] and [Default].
+func Fallbacks(locale, def string) []string {
+	var ret []string
+	for _, l := range []string{Normalize(locale), Base(locale), Normalize(def), Base(def), Default} {
+		if l == "" {
+			continue
+		}
+		dup := false
+		for _, r := range ret {
+			dup = dup || r == l
+		}
+		if !dup {
+			ret = append(ret, l)
+		}
+	}
+
+	return ret
+}
+
+// Language returns the English name of the language of [locale], eg "Polish" for "pl-PL".
+func Language(locale string) string {
+	if name, ok := languages[Base(locale)]; ok {
+		return name
+	}
+
+	return Normalize(locale)
+}
+
+// T returns a translated string from [Builtin].
+func T(locale, key string, args ...any) string {
+	return Builtin.T(locale, key, args...)
+}
+
+// T returns a string under [key] for [locale], with fallbacks, or the key itself.
+func (c Catalogs) T(locale, key string, args ...any) string {
+	for _, l := range Fallbacks(locale, Default) {
+		if txt, ok := c[l][key]; ok {
+			if len(args) > 0 {
+				return fmt.Sprintf(txt, args...)
+			}
+			return txt
+		}
+	}
+
+	return key
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"pl":          "pl",
+		"PL":          "pl",
+		"pt_br":       "pt-BR",
+		"pl_PL.UTF-8": "pl-PL",
+		" de-at ":     "de-AT",
+	}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	got := Fallbacks("pt_BR", "pl")
+	want := []string{"pt-BR", "pt", "pl", "en"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = Fallbacks("", "en")
+	if !slices.Equal(got, []string{"en"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("pl-PL", KeySend); got != "Wyślij" {
+		t.Errorf("got %q", got)
+	}
+	// missing locale
+	if got := T("xx", KeySend); got != "Send" {
+		t.Errorf("got %q", got)
+	}
+	// missing key
+	if got := T("pl", "foo"); got != "foo" {
+		t.Errorf("got %q", got)
+	}
+	// args
+	if got := T("en", KeyAgoFor, 2.0, 3); got != "2m ago for t3" {
+		t.Errorf("got %q", got)
+	}
+	// custom catalogs
+	c := Catalogs{"pl": {KeySend: "Ślij"}}
+	if got := c.T("pl", KeySend); got != "Ślij" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	if got := Language("pl_PL"); got != "Polish" {
+		t.Errorf("got %q", got)
+	}
+	if got := Language("xx-YY"); got != "xx-YY" {
+		t.Errorf("got %q", got)
+	}
+}
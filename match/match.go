@@ -0,0 +1,288 @@
+// Package match resolves user prompts to known choices locally, before asking an LLM. It combines normalized exact
+// matching, keywords with synonyms, tense-aware token matching (eg "rice cooked" is StepRiceCooked, not
+// StepRiceCooking) and fuzzy string similarity.
+package match
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/pancsta/secai/shared"
+)
+
+type Method string
+
+const (
+	MethodExact   Method = "exact"
+	MethodKeyword Method = "keyword"
+	MethodTokens  Method = "tokens"
+)
+
+// Candidate is a single choice to match against.
+type Candidate struct {
+	// ID is returned on a match, eg a state name like "StepRiceCooked". CamelCase is split into words.
+	ID string
+	// Text is an optional human description.
+	Text string
+	// Keywords are additional phrases, eg synonyms. A keyword contained in the prompt is a strong match.
+	Keywords []string
+}
+
+// Result is a successful match.
+type Result struct {
+	ID string
+	// Index of the candidate.
+	Index int
+	// Score is the confidence 0-1.
+	Score  float64
+	Method Method
+}
+
+// Matcher matches prompts to candidates. Safe for concurrent use, as long as the config isn't modified.
+type Matcher struct {
+	// Threshold is the min score of a match (0-1).
+	Threshold float64
+	// Margin is the min score distance to the 2nd-best candidate, otherwise the match is ambiguous.
+	Margin float64
+	// Synonyms maps words to their canonical forms, eg "begin" -> "start".
+	Synonyms map[string]string
+	// Prefixes are dropped from IDs, eg "Step" or "Story".
+	Prefixes []string
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// New returns a matcher with the default config.
+func New(threshold float64) *Matcher {
+	return &Matcher{
+		Threshold: threshold,
+		Margin:    0.1,
+		Prefixes:  []string{"Step", "Story"},
+		Synonyms: map[string]string{
+			"begin":    "start",
+			"finished": "ready",
+			"done":     "ready",
+			"complete": "ready",
+			"recipes":  "recipe",
+			"receipe":  "recipe",
+		},
+	}
+}
+
+// Match returns the best candidate for [prompt], or nil if there's no obvious match.
+func (m *Matcher) Match(prompt string, candidates []Candidate) *Result {
+	return m.MatchMin(prompt, candidates, m.Threshold)
+}
+
+// MatchMin is [Matcher.Match] with a custom [threshold], eg from a reloadable config.
+func (m *Matcher) MatchMin(prompt string, candidates []Candidate, threshold float64) *Result {
+	res := m.match(prompt, candidates, threshold)
+	if res == nil {
+		m.misses.Add(1)
+	} else {
+		m.hits.Add(1)
+	}
+
+	return res
+}
+
+// Normalize returns [txt] as normalized words, with synonyms replaced and stop words removed. Useful as a cache key.
+func (m *Matcher) Normalize(txt string) string {
+	return strings.Join(m.tokens(txt), " ")
+}
+
+// Stats returns the amount of hits and misses so far.
+func (m *Matcher) Stats() (hits, misses int64) {
+	return m.hits.Load(), m.misses.Load()
+}
+
+func (m *Matcher) match(prompt string, candidates []Candidate, threshold float64) *Result {
+	words := m.tokens(prompt)
+	if len(words) == 0 || len(candidates) == 0 {
+		return nil
+	}
+	norm := strings.Join(words, " ")
+
+	var best, second *Result
+	for i, c := range candidates {
+		res := &Result{ID: c.ID, Index: i}
+		names := []string{m.idText(c.ID), c.Text}
+
+		// exact
+		for _, name := range names {
+			if name != "" && strings.Join(m.tokens(name), " ") == norm {
+				res.Score, res.Method = 1, MethodExact
+			}
+		}
+
+		// keywords
+		if res.Score < 1 {
+			for _, kw := range c.Keywords {
+				kwNorm := strings.Join(m.tokens(kw), " ")
+				if kwNorm != "" && strings.Contains(" "+norm+" ", " "+kwNorm+" ") {
+					res.Score, res.Method = 0.95, MethodKeyword
+				}
+			}
+		}
+
+		// tokens (tense-aware, fuzzy)
+		if res.Score < 0.95 {
+			for _, name := range names {
+				if score := tokensScore(words, m.tokens(name)); score > res.Score {
+					res.Score, res.Method = score, MethodTokens
+				}
+			}
+		}
+
+		// rank
+		if best == nil || res.Score > best.Score {
+			best, second = res, best
+		} else if second == nil || res.Score > second.Score {
+			second = res
+		}
+	}
+
+	if best.Score < threshold {
+		return nil
+	}
+	if second != nil && best.Score-second.Score < m.Margin {
+		return nil // ambiguous
+	}
+
+	return best
+}
+
+// idText splits a CamelCase ID into words and drops the known prefix.
+func (m *Matcher) idText(id string) string {
+	for _, p := range m.Prefixes {
+		if rest, ok := strings.CutPrefix(id, p); ok && rest != "" && unicode.IsUpper(rune(rest[0])) {
+			id = rest
+			break
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range id {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// tokens returns normalized words of [txt], with synonyms replaced.
+func (m *Matcher) tokens(txt string) []string {
+	txt = strings.ToLower(shared.RemoveStyling(txt))
+	words := strings.FieldsFunc(txt, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	ret := make([]string, 0, len(words))
+	for _, w := range words {
+		if syn, ok := m.Synonyms[w]; ok {
+			w = syn
+		}
+		if slices.Contains(stopWords, w) {
+			continue
+		}
+		ret = append(ret, w)
+	}
+
+	return ret
+}
+
+var stopWords = []string{"a", "an", "the", "is", "are", "to", "of", "and", "now", "please", "i", "im", "my", "it",
+	"its", "has", "have", "been", "be", "story", "step", "switch", "go"}
+
+// tokensScore returns the share of [target] words present in [words], weighted by the tense and similarity.
+func tokensScore(words, target []string) float64 {
+	if len(target) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, t := range target {
+		var best float64
+		for _, w := range words {
+			best = max(best, wordScore(w, t))
+		}
+		sum += best
+	}
+	score := sum / float64(len(target))
+
+	// penalize extra words in the prompt
+	if extra := len(words) - len(target); extra > 0 {
+		score *= 1 - 0.05*float64(min(extra, 4))
+	}
+
+	return score
+}
+
+// wordScore compares 2 words, respecting their tenses.
+func wordScore(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	stemA, tenseA := stem(a)
+	stemB, tenseB := stem(b)
+	if stemA == stemB {
+		if tenseA == tenseB {
+			return 1
+		}
+		// same word, wrong tense
+		return 0.5
+	}
+
+	// typos
+	if sim := Similarity(a, b); sim >= 0.8 {
+		return sim * 0.9
+	}
+
+	return 0
+}
+
+// stem returns a naive stem and tense suffix ("ed", "ing" or "").
+func stem(w string) (string, string) {
+	if len(w) <= 4 {
+		return w, ""
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if s, ok := strings.CutSuffix(w, suffix); ok {
+			return strings.TrimSuffix(s, "e"), suffix
+		}
+	}
+
+	return strings.TrimSuffix(w, "e"), ""
+}
+
+// Similarity returns a normalized Levenshtein similarity 0-1 of 2 strings.
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
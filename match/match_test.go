@@ -0,0 +1,65 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	m := New(0.8)
+	cands := []Candidate{
+		{ID: "StepRiceCooking"},
+		{ID: "StepRiceCooked"},
+		{ID: "StoryIngredientsPicking", Text: "Collect the ingredients", Keywords: []string{"ingredients"}},
+		{ID: "StoryJoke", Keywords: []string{"joke", "funny"}},
+	}
+
+	// tense
+	res := m.Match("rice cooked", cands)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "StepRiceCooked", res.ID)
+		assert.Equal(t, MethodExact, res.Method)
+	}
+	res = m.Match("the rice is cooking fast", cands)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "StepRiceCooking", res.ID)
+		assert.Equal(t, MethodTokens, res.Method)
+	}
+
+	// typo
+	res = m.Match("rice cookd", cands)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "StepRiceCooked", res.ID)
+	}
+
+	// keyword
+	res = m.Match("switch to story ingredients", cands)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, 2, res.Index)
+		assert.Equal(t, MethodKeyword, res.Method)
+	}
+
+	// exact text
+	res = m.Match("Collect the ingredients!", cands)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, MethodExact, res.Method)
+	}
+
+	// miss
+	assert.Nil(t, m.Match("what's the weather like", cands))
+	assert.Nil(t, m.Match("rice", cands))
+
+	// custom threshold
+	assert.Nil(t, m.MatchMin("switch to story ingredients", cands, 0.99))
+
+	hits, misses := m.Stats()
+	assert.Equal(t, int64(5), hits)
+	assert.Equal(t, int64(3), misses)
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("rice", "rice"))
+	assert.InDelta(t, 0.75, Similarity("rice", "ricy"), 0.01)
+	assert.Equal(t, 0.0, Similarity("abc", "xyz"))
+}
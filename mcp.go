@@ -0,0 +1,355 @@
+package secai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/states"
+)
+
+// ///// ///// /////
+
+// ///// MCP
+
+// ///// ///// /////
+
+const (
+	// MCPToolPrompt is the MCP tool sending a prompt to the agent.
+	MCPToolPrompt = "prompt"
+	// MCPToolActionPrefix prefixes MCP tools calling [shared.AgentAPI.Actions].
+	MCPToolActionPrefix = "action-"
+	// MCPToolStoryPrefix prefixes MCP tools activating manual stories.
+	MCPToolStoryPrefix = "story-"
+
+	// MCPResMsgs is the MCP resource with the chat transcript.
+	MCPResMsgs = "secai://msgs"
+	// MCPResStates is the MCP resource with the active states.
+	MCPResStates = "secai://states"
+	// MCPResPrompts is the MCP resource with the recent LLM prompts.
+	MCPResPrompts = "secai://prompts"
+)
+
+var (
+	// ErrMCPPrompt means the prompt wasn't accepted by the agent.
+	ErrMCPPrompt = errors.New("prompt not accepted")
+	// ErrMCPTimeout means the agent didn't reply within [shared.ConfigMCP.ReplyTimeout].
+	ErrMCPTimeout = errors.New("no reply from the agent")
+)
+
+// mcpToolName matches invalid characters of MCP tool names.
+var mcpToolName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+type mcpServer struct {
+	once sync.Once
+	srv  *server.MCPServer
+	// promptMx serializes prompt calls, as replies aren't linked to prompts
+	promptMx sync.Mutex
+	// mx guards the fields below
+	mx sync.Mutex
+	// tools is the signature of the dynamic tools
+	tools string
+	http  *http.Server
+	addr  string
+	// subs are the pending prompt calls
+	subs map[chan *shared.Msg]struct{}
+}
+
+// mcpSubBuffer is the number of messages buffered per prompt call, before dropping.
+const mcpSubBuffer = 100
+
+// MCPServer returns the MCP server of the agent, exposing actions and manual stories as tools, a prompt tool, and
+// the transcript, active states and recent LLM prompts as resources.
+func (a *AgentBase) MCPServer() *server.MCPServer {
+	a.mcp.once.Do(func() {
+		hooks := &server.Hooks{}
+		hooks.AddBeforeListTools(func(ctx context.Context, id any, req *mcp.ListToolsRequest) {
+			a.mcpSyncTools()
+		})
+		hooks.AddBeforeCallTool(func(ctx context.Context, id any, req *mcp.CallToolRequest) {
+			a.mcpSyncTools()
+		})
+		a.mcp.srv = server.NewMCPServer(a.cfg.Agent.ID, "1.0.0",
+			server.WithToolCapabilities(true),
+			server.WithResourceCapabilities(false, false),
+			server.WithHooks(hooks),
+		)
+
+		res := func(uri, name, desc string, handler func(ctx context.Context) (any, error)) server.ServerResource {
+			return server.ServerResource{
+				Resource: mcp.NewResource(uri, name, mcp.WithResourceDescription(desc),
+					mcp.WithMIMEType("application/json")),
+				Handler: func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+					data, err := handler(ctx)
+					if err != nil {
+						return nil, err
+					}
+					j, err := json.MarshalIndent(data, "", "  ")
+					if err != nil {
+						return nil, err
+					}
+					return []mcp.ResourceContents{mcp.TextResourceContents{
+						URI:      uri,
+						MIMEType: "application/json",
+						Text:     string(j),
+					}}, nil
+				},
+			}
+		}
+		a.mcp.srv.AddResources(
+			res(MCPResMsgs, "Messages", "Chat transcript of the current session.",
+				func(ctx context.Context) (any, error) {
+					return a.agentImpl.Msgs(), nil
+				}),
+			res(MCPResStates, "Active states", "Currently active states of the agent.",
+				func(ctx context.Context) (any, error) {
+					return a.Mach().ActiveStates(nil), nil
+				}),
+			res(MCPResPrompts, "Prompts", "Recent LLM prompts, with responses.",
+				func(ctx context.Context) (any, error) {
+					if a.Mach().Not1(ss.BaseDBReady) {
+						return nil, ErrDBNil
+					}
+					// TODO config
+					return a.QueriesBase().ListPromptsRecent(ctx, 100)
+				}),
+		)
+		a.mcpSyncTools()
+	})
+
+	return a.mcp.srv
+}
+
+// MCPServeStdio serves [AgentBase.MCPServer] over [in] and [out], until [ctx] expires.
+func (a *AgentBase) MCPServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	srv := server.NewStdioServer(a.MCPServer())
+	srv.SetErrorLogger(log.New(&SlogWriter{Logger: a.logger, Level: slog.LevelError}, "mcp ", 0))
+
+	return srv.Listen(ctx, in, out)
+}
+
+// MCPAddr returns the address of the MCP HTTP server, once [states.AgentBaseStatesDef.MCPReady].
+func (a *AgentBase) MCPAddr() string {
+	a.mcp.mx.Lock()
+	defer a.mcp.mx.Unlock()
+
+	return a.mcp.addr
+}
+
+// private
+
+// mcpSyncTools replaces the tools, when actions or stories have changed.
+func (a *AgentBase) mcpSyncTools() {
+	mach := a.Mach()
+	schema := mach.Schema()
+	tools := []server.ServerTool{{
+		Tool: mcp.NewTool(MCPToolPrompt,
+			mcp.WithDescription("Send a prompt to the agent, like in the chat, and return its replies."),
+			mcp.WithString("text", mcp.Required(), mcp.Description("Text of the prompt.")),
+		),
+		Handler: a.mcpPrompt,
+	}}
+
+	// actions
+	for _, act := range a.agentImpl.Actions() {
+		if !act.Action || act.ID == "" {
+			continue
+		}
+		desc := act.Label
+		if act.Desc != "" {
+			desc += " - " + act.Desc
+		}
+		tools = append(tools, server.ServerTool{
+			Tool: mcp.NewTool(mcpToolID(MCPToolActionPrefix, act.ID), mcp.WithDescription(desc)),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				res := mach.Add1(ss.StoryAction, Pass(&A{ID: act.ID}))
+				return mcp.NewToolResultText(res.String()), nil
+			},
+		})
+	}
+
+	// manual stories
+	for _, s := range a.agentImpl.Stories() {
+		state, ok := schema[s.State]
+		if !ok || amhelp.TagValue(state.Tags, states.TagManual) == "" {
+			continue
+		}
+		desc := s.Title
+		if s.Desc != "" {
+			desc += " - " + s.Desc
+		}
+		tools = append(tools, server.ServerTool{
+			Tool: mcp.NewTool(mcpToolID(MCPToolStoryPrefix, s.State), mcp.WithDescription(desc)),
+			Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				res := a.StoryActivate(nil, s.State)
+				return mcp.NewToolResultText(res.String()), nil
+			},
+		})
+	}
+
+	// compare
+	var sig strings.Builder
+	for _, t := range tools {
+		sig.WriteString(t.Tool.Name + "\n" + t.Tool.Description + "\n")
+	}
+	a.mcp.mx.Lock()
+	defer a.mcp.mx.Unlock()
+	if a.mcp.tools == sig.String() {
+		return
+	}
+	a.mcp.tools = sig.String()
+	a.mcp.srv.SetTools(tools...)
+}
+
+// mcpPrompt sends a prompt and waits for the assistant's replies, up to [shared.ConfigMCP.ReplyTimeout]. Calls are
+// serialized, so each one gets the replies of its own prompt.
+func (a *AgentBase) mcpPrompt(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	text, err := req.RequireString("text")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// one prompt at a time
+	a.mcp.promptMx.Lock()
+	defer a.mcp.promptMx.Unlock()
+
+	ch := a.mcpSubscribe()
+	defer a.mcpUnsubscribe(ch)
+	if a.Mach().Add1(ss.Prompt, Pass(&A{Prompt: text})) == am.Canceled {
+		return mcp.NewToolResultError(ErrMCPPrompt.Error()), nil
+	}
+
+	// wait for the assistant
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.MCP.ReplyTimeout)
+	defer cancel()
+	var replies []string
+	for {
+		select {
+		case <-ctx.Done():
+			return mcp.NewToolResultError(ErrMCPTimeout.Error()), nil
+		case msg := <-ch:
+			if msg.From == shared.FromUser {
+				continue
+			}
+			replies = append(replies, msg.Text)
+			if msg.From == shared.FromAssistant {
+				return mcp.NewToolResultText(strings.Join(replies, "\n\n")), nil
+			}
+		}
+	}
+}
+
+// mcpSubscribe returns a channel of new messages, see [AgentBase.UIMsgState].
+func (a *AgentBase) mcpSubscribe() chan *shared.Msg {
+	ch := make(chan *shared.Msg, mcpSubBuffer)
+	a.mcp.mx.Lock()
+	defer a.mcp.mx.Unlock()
+	if a.mcp.subs == nil {
+		a.mcp.subs = map[chan *shared.Msg]struct{}{}
+	}
+	a.mcp.subs[ch] = struct{}{}
+
+	return ch
+}
+
+func (a *AgentBase) mcpUnsubscribe(ch chan *shared.Msg) {
+	a.mcp.mx.Lock()
+	defer a.mcp.mx.Unlock()
+	delete(a.mcp.subs, ch)
+}
+
+// mcpBroadcast passes [msg] to pending prompt calls, dropping it for slow ones.
+func (a *AgentBase) mcpBroadcast(msg *shared.Msg) {
+	a.mcp.mx.Lock()
+	defer a.mcp.mx.Unlock()
+	for ch := range a.mcp.subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func mcpToolID(prefix, id string) string {
+	ret := prefix + mcpToolName.ReplaceAllString(id, "_")
+
+	return ret[:min(64, len(ret))]
+}
+
+// ///// ///// /////
+
+// ///// HANDLERS
+
+// ///// ///// /////
+
+func (a *AgentBase) MCPStartingState(e *am.Event) {
+	mach := a.Mach()
+	ctx := mach.NewStateCtx(ss.MCPStarting)
+	srv := a.MCPServer()
+
+	go func() {
+		if ctx.Err() != nil {
+			return // expired
+		}
+
+		ln, err := net.Listen("tcp", a.cfg.MCP.Addr)
+		if err != nil {
+			mach.EvAddErr(e, err, nil)
+			return
+		}
+		sse := server.NewSSEServer(srv)
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", server.NewStreamableHTTPServer(srv))
+		mux.Handle("/sse", sse)
+		mux.Handle("/message", sse)
+		httpSrv := &http.Server{Handler: mux}
+
+		a.mcp.mx.Lock()
+		a.mcp.http = httpSrv
+		a.mcp.addr = ln.Addr().String()
+		a.mcp.mx.Unlock()
+
+		go func() {
+			err := httpSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				mach.AddErr(err, nil)
+			}
+		}()
+		a.Log("MCP server listening", "addr", ln.Addr().String())
+
+		// next
+		mach.EvAdd1(e, ss.MCPReady, nil)
+	}()
+}
+
+func (a *AgentBase) MCPReadyEnd(e *am.Event) {
+	a.mcp.mx.Lock()
+	httpSrv := a.mcp.http
+	a.mcp.http = nil
+	a.mcp.addr = ""
+	a.mcp.mx.Unlock()
+	if httpSrv == nil {
+		return
+	}
+
+	go func() {
+		// TODO config
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(ctx)
+	}()
+}
@@ -0,0 +1,197 @@
+package secai
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/states"
+)
+
+// mcpStory is a manual story of [mcpAgent].
+const mcpStory = "StoryMCP"
+
+var mcpSchema = am.SchemaMerge(states.AgentSchema, am.Schema{
+	mcpStory: {Tags: am.S{states.TagManual}},
+})
+
+// mcpAgent replies "pong" to every prompt and exposes a single action and a single manual story.
+type mcpAgent struct {
+	*histAgent
+
+	mx      sync.Mutex
+	msgs    []*shared.Msg
+	actions chan string
+	story   *shared.Story
+}
+
+func (a *mcpAgent) MachSchema() (am.Schema, am.S) { return mcpSchema, append(ss.Names(), mcpStory) }
+func (a *mcpAgent) Stories() []shared.StoryInfo   { return []shared.StoryInfo{a.story.StoryInfo} }
+
+func (a *mcpAgent) Story(state string) *shared.Story {
+	if state == mcpStory {
+		return a.story
+	}
+	return nil
+}
+
+func (a *mcpAgent) Msgs() []*shared.Msg {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	return append([]*shared.Msg{}, a.msgs...)
+}
+
+func (a *mcpAgent) Actions() []shared.ActionInfo {
+	return []shared.ActionInfo{{ID: "test-1", Label: "Test", Action: true}}
+}
+
+func (a *mcpAgent) UIMsgState(e *am.Event) {
+	a.AgentBase.UIMsgState(e)
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.msgs = append(a.msgs, ParseArgs(e.Args).Msg)
+}
+
+func (a *mcpAgent) PromptState(e *am.Event) {
+	a.AgentBase.PromptState(e)
+	a.Output("pong", shared.FromAssistant)
+}
+
+func (a *mcpAgent) StoryActionState(e *am.Event) {
+	a.actions <- ParseArgs(e.Args).ID
+}
+
+func TestMCPServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cfg := shared.ConfigDefault()
+	cfg.Agent.ID = "mcp"
+	cfg.Agent.Dir = t.TempDir()
+	cfg.AI = shared.ConfigAI{}
+	cfg.MCP.Addr = "127.0.0.1:0"
+	cfg.MCP.ReplyTimeout = 5 * time.Second
+
+	a := &mcpAgent{
+		histAgent: &histAgent{AgentBase: NewAgent(ctx, append(ss.Names(), mcpStory), mcpSchema)},
+		actions:   make(chan string, 10),
+		story:     &shared.Story{StoryInfo: shared.StoryInfo{State: mcpStory, Title: "MCP"}},
+	}
+	require.NoError(t, a.Init(a, &cfg, nil, states.AgentBaseGroups, states.AgentBaseStates, nil))
+	mach := a.Mach()
+	defer mach.Dispose()
+	a.Start()
+	// actions require the UI
+	mach.Add1(ss.UIMode, nil)
+	<-mach.When(am.S{ss.MCPReady, ss.BaseDBReady}, ctx)
+	require.NoError(t, ctx.Err(), "MCP not ready")
+	addr := "http://" + a.MCPAddr()
+
+	t.Run("http", func(t *testing.T) {
+		c, err := client.NewStreamableHttpClient(addr + "/mcp")
+		require.NoError(t, err)
+		testMCPClient(t, ctx, a, c)
+	})
+
+	t.Run("sse", func(t *testing.T) {
+		c, err := client.NewSSEMCPClient(addr + "/sse")
+		require.NoError(t, err)
+		testMCPClient(t, ctx, a, c)
+	})
+
+	t.Run("stdio", func(t *testing.T) {
+		ctxStdio, cancelStdio := context.WithCancel(ctx)
+		defer cancelStdio()
+		srvIn, cliOut := io.Pipe()
+		cliIn, srvOut := io.Pipe()
+		go func() {
+			_ = a.MCPServeStdio(ctxStdio, srvIn, srvOut)
+		}()
+		c := client.NewClient(transport.NewIO(cliIn, cliOut, io.NopCloser(nil)))
+		testMCPClient(t, ctx, a, c)
+	})
+}
+
+func testMCPClient(t *testing.T, ctx context.Context, a *mcpAgent, c *client.Client) {
+	defer c.Close()
+	require.NoError(t, c.Start(ctx))
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initReq.Params.ClientInfo = mcp.Implementation{Name: "test", Version: "1.0.0"}
+	_, err := c.Initialize(ctx, initReq)
+	require.NoError(t, err)
+
+	// tools
+	tools, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.ElementsMatch(t, []string{MCPToolPrompt, MCPToolActionPrefix + "test-1", MCPToolStoryPrefix + mcpStory},
+		names)
+
+	// prompt
+	call := mcp.CallToolRequest{}
+	call.Params.Name = MCPToolPrompt
+	call.Params.Arguments = map[string]any{"text": "ping"}
+	res, err := c.CallTool(ctx, call)
+	require.NoError(t, err)
+	require.False(t, res.IsError)
+	assert.Equal(t, "pong", mcp.GetTextFromContent(res.Content[0]))
+
+	// action
+	call = mcp.CallToolRequest{}
+	call.Params.Name = MCPToolActionPrefix + "test-1"
+	_, err = c.CallTool(ctx, call)
+	require.NoError(t, err)
+	select {
+	case id := <-a.actions:
+		assert.Equal(t, "test-1", id)
+	case <-ctx.Done():
+		t.Fatal("action not called")
+	}
+
+	// manual story, via the story timeline
+	mach := a.Mach()
+	call = mcp.CallToolRequest{}
+	call.Params.Name = MCPToolStoryPrefix + mcpStory
+	_, err = c.CallTool(ctx, call)
+	require.NoError(t, err)
+	<-mach.When1(mcpStory, ctx)
+	require.NoError(t, ctx.Err(), "story not activated")
+	assert.False(t, a.story.ActivatedAt.IsZero())
+	require.Eventually(t, func() bool {
+		events, err := a.StoryEvents(ctx, mcpStory, 1)
+		return err == nil && len(events) == 1 && events[0].Active && events[0].Cause == "manual"
+	}, 5*time.Second, 50*time.Millisecond)
+	a.StoryDeactivate(nil, mcpStory)
+	<-mach.WhenNot1(mcpStory, ctx)
+
+	// resources
+	for uri, want := range map[string]string{
+		MCPResMsgs:    `"ping"`,
+		MCPResStates:  `"Start"`,
+		MCPResPrompts: ``,
+	} {
+		req := mcp.ReadResourceRequest{}
+		req.Params.URI = uri
+		res, err := c.ReadResource(ctx, req)
+		require.NoError(t, err, uri)
+		require.Len(t, res.Contents, 1, uri)
+		text, ok := res.Contents[0].(mcp.TextResourceContents)
+		require.True(t, ok, uri)
+		assert.Contains(t, text.Text, want, uri)
+	}
+}
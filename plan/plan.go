@@ -0,0 +1,411 @@
+// Package plan turns LLM-generated state schemas into live states of a memory machine. It provides prompt
+// scaffolding, prefixing, relation sanity checks with auto-repair, ordering by "idx" tags and merging.
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai"
+	"github.com/pancsta/secai/shared"
+)
+
+type S = am.S
+
+// ErrPlan means the generated schema can't be used, even after a repair.
+var ErrPlan = errors.New("invalid plan")
+
+const (
+	// TagIdx orders steps, eg "idx:2".
+	TagIdx = "idx"
+	// TagFinal marks the final state of an "idx" group.
+	TagFinal = "final"
+)
+
+// ///// ///// /////
+
+// ///// PROMPT
+
+// ///// ///// /////
+
+// Result is the result of a planning prompt.
+type Result struct {
+	Schema am.Schema
+}
+
+// Params are generic params of a planning prompt. Agents can use their own params, but should include Feedback to
+// support re-asking.
+type Params struct {
+	// Task to plan.
+	Task string
+	// Feedback lists problems of the previous attempt.
+	Feedback []string
+}
+
+// NewPrompt creates a planning prompt with the given role, task description and domain examples. [goal] is the final
+// and mandatory state (unprefixed).
+func NewPrompt[P any](
+	agent shared.AgentBaseAPI, state, role, task, goal, examples string,
+) *secai.Prompt[P, Result] {
+	steps := shared.Sl(`
+		1. %s Represent them as binary flags called "states". Each step can represent either a long-running action (eg WaterHeatingUp), a short-running action (WaterBoiling), a fact (WaterBoiled). Each state can relate to any other state via Require, Remove, and Add relation.
+		1. The final and mandatory state is called %s.
+		1. Not all the states have to be connected with relations.
+		1. Put the time length of procedures (if given) inside Tags as "time:5m" to wait for 5min.
+		1. Index the steps using a tag "idx:4" for the 5th step in the input. Steps which can't be active at the same time should have Remove relation between them.
+		1. If Feedback is present, fix the listed problems of the previous attempt.
+	`, shared.Sp(task), goal)
+	if examples != "" {
+		steps += "\n" + shared.Sp(examples)
+	}
+
+	p := secai.NewPrompt[P, Result](agent, state, role, steps, shared.Sp(`
+		2 states CAN'T require and remove each other - these relations are for a single point in time. States CAN'T require themselves, directly or via other states. Skip empty fields (null, false). Start the "idx:" counter from 1. If the same "idx" tag is present for more than 1 state, pick a final state from the same group "idx" group and mark it with a "final" tag (eg WaterBoiled is a final state for WaterBoiling).
+	`))
+
+	// short history
+	p.HistoryMsgLen = 1
+
+	return p
+}
+
+// ///// ///// /////
+
+// ///// ISSUES
+
+// ///// ///// /////
+
+type IssueKind string
+
+const (
+	// IssueDangling is a relation to an unknown state.
+	IssueDangling IssueKind = "dangling"
+	// IssueSelf is a relation to the same state.
+	IssueSelf IssueKind = "self"
+	// IssueConflict is a state both required and removed.
+	IssueConflict IssueKind = "conflict"
+	// IssueCycle is a cycle of Require relations.
+	IssueCycle IssueKind = "cycle"
+	// IssueGoal is a missing or unreachable goal state.
+	IssueGoal IssueKind = "goal"
+)
+
+// Issue is a single problem found in a generated schema.
+type Issue struct {
+	Kind     IssueKind
+	State    string
+	Relation am.Relation
+	Target   string
+	Repaired bool
+	// Msg is an optional description.
+	Msg string
+}
+
+func (i Issue) String() string {
+	if i.Msg != "" {
+		return string(i.Kind) + ": " + i.Msg
+	}
+
+	return fmt.Sprintf("%s: %s %s %s", i.Kind, i.State, i.Relation, i.Target)
+}
+
+// Check finds relation issues in [schema], optionally repairing them in place. [known] are states from outside the
+// schema, which are valid relation targets. Require cycles can't be repaired.
+func Check(schema am.Schema, known S, repair bool) []Issue {
+	var issues []Issue
+	names := slices.Sorted(maps.Keys(schema))
+
+	for _, name := range names {
+		state := schema[name]
+
+		// dangling and self refs
+		for _, rel := range []am.Relation{am.RelationRequire, am.RelationRemove, am.RelationAdd, am.RelationAfter} {
+			targets := relTargets(&state, rel)
+			for _, target := range *targets {
+				_, ok := schema[target]
+				kind := IssueKind("")
+				if target == name {
+					kind = IssueSelf
+				} else if !ok && !slices.Contains(known, target) {
+					kind = IssueDangling
+				}
+				if kind == "" {
+					continue
+				}
+				issues = append(issues, Issue{Kind: kind, State: name, Relation: rel, Target: target, Repaired: repair})
+			}
+			if repair {
+				*targets = slices.DeleteFunc(*targets, func(target string) bool {
+					_, ok := schema[target]
+					return target == name || (!ok && !slices.Contains(known, target))
+				})
+			}
+		}
+
+		// prefer require over remove within the same state
+		for _, target := range state.Require {
+			if !slices.Contains(state.Remove, target) {
+				continue
+			}
+			issues = append(issues, Issue{
+				Kind: IssueConflict, State: name, Relation: am.RelationRemove, Target: target, Repaired: repair,
+			})
+			if repair {
+				state.Remove = slices.DeleteFunc(state.Remove, func(s string) bool {
+					return s == target
+				})
+			}
+		}
+
+		schema[name] = state
+	}
+
+	// prefer require over remove between 2 states
+	for _, name := range names {
+		state := schema[name]
+		for _, target := range state.Require {
+			other, ok := schema[target]
+			if !ok || !slices.Contains(other.Remove, name) {
+				continue
+			}
+			issues = append(issues, Issue{
+				Kind: IssueConflict, State: target, Relation: am.RelationRemove, Target: name, Repaired: repair,
+			})
+			if repair {
+				other.Remove = slices.DeleteFunc(other.Remove, func(s string) bool {
+					return s == name
+				})
+				schema[target] = other
+			}
+		}
+	}
+
+	return append(issues, checkCycles(schema, names)...)
+}
+
+func checkCycles(schema am.Schema, names S) []Issue {
+	var issues []Issue
+	// 0 - unvisited, 1 - visiting, 2 - done
+	visited := map[string]int{}
+
+	var visit func(name string)
+	visit = func(name string) {
+		visited[name] = 1
+		for _, target := range schema[name].Require {
+			if _, ok := schema[target]; !ok {
+				continue
+			}
+			switch visited[target] {
+			case 0:
+				visit(target)
+			case 1:
+				issues = append(issues, Issue{
+					Kind: IssueCycle, State: name, Relation: am.RelationRequire, Target: target,
+				})
+			}
+		}
+		visited[name] = 2
+	}
+
+	for _, name := range names {
+		if visited[name] == 0 {
+			visit(name)
+		}
+	}
+
+	return issues
+}
+
+func relTargets(state *am.State, rel am.Relation) *S {
+	switch rel {
+	case am.RelationRequire:
+		return &state.Require
+	case am.RelationRemove:
+		return &state.Remove
+	case am.RelationAdd:
+		return &state.Add
+	default:
+		return &state.After
+	}
+}
+
+// ///// ///// /////
+
+// ///// PLANNER
+
+// ///// ///// /////
+
+// Planner processes generated schemas into plans.
+type Planner struct {
+	// Prefix is prepended to all the generated state names, eg "Step".
+	Prefix string
+	// Goal is the final state (unprefixed), which has to be active after activating all the steps in order.
+	Goal string
+	// Repair fixes repairable issues, instead of rejecting the schema.
+	Repair bool
+}
+
+// Plan is a processed schema, ready to be merged into a memory machine.
+type Plan struct {
+	// Raw is the schema as generated.
+	Raw am.Schema
+	// Schema is the prefixed and repaired schema.
+	Schema am.Schema
+	// Steps are the prefixed state names, ordered by "idx" tags.
+	Steps S
+	// Merged is the base schema merged with Schema.
+	Merged am.Schema
+	// Names are the state names for Merged.
+	Names S
+	// Issues found during processing.
+	Issues []Issue
+}
+
+// GoalState returns the prefixed goal state.
+func (p *Planner) GoalState() string {
+	return p.Prefix + p.Goal
+}
+
+// Process prefixes, checks, orders and validates [raw] against the [base] schema of a memory machine. The returned
+// plan is non-nil even on errors, to provide [Plan.Feedback].
+func (p *Planner) Process(base am.Schema, baseNames S, raw am.Schema) (*Plan, error) {
+	pl := &Plan{Raw: raw}
+
+	// prefix and checksum the schema
+	cBefore := 0
+	cAfter := 0
+	for _, state := range raw {
+		cBefore += amhelp.CountRelations(&state)
+	}
+	schema := amhelp.PrefixStates(raw, p.Prefix, true, nil, nil)
+	for _, state := range schema {
+		cAfter += amhelp.CountRelations(&state)
+	}
+	if cBefore != cAfter {
+		return pl, fmt.Errorf("%w: %d before, %d after", am.ErrSchema, cBefore, cAfter)
+	}
+
+	// check relations
+	pl.Issues = Check(schema, baseNames, p.Repair)
+	pl.Schema = schema
+	goal := p.GoalState()
+	if _, ok := schema[goal]; p.Goal != "" && !ok {
+		pl.Issues = append(pl.Issues, Issue{Kind: IssueGoal, Msg: "missing state " + p.Goal})
+	}
+	if err := pl.Err(); err != nil {
+		return pl, err
+	}
+
+	// merge into memory
+	pl.Merged = am.SchemaMerge(base, schema)
+	pl.Steps = Sort(schema)
+	pl.Names = slices.Concat(baseNames, pl.Steps)
+
+	if p.Goal == "" {
+		return pl, nil
+	}
+	err := Validate(pl.Merged, pl.Steps, goal)
+	if err != nil {
+		pl.Issues = append(pl.Issues, Issue{Kind: IssueGoal, Msg: err.Error()})
+		return pl, err
+	}
+
+	return pl, nil
+}
+
+// Err returns an error for unrepaired issues, if any.
+func (pl *Plan) Err() error {
+	var msgs []string
+	for _, i := range pl.Issues {
+		if !i.Repaired {
+			msgs = append(msgs, i.String())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrPlan, strings.Join(msgs, "; "))
+}
+
+// Feedback returns unrepaired issues in a form suitable for re-asking the LLM, using unprefixed names.
+func (pl *Plan) Feedback(prefix string) []string {
+	var ret []string
+	for _, i := range pl.Issues {
+		if i.Repaired {
+			continue
+		}
+		i.State, _ = strings.CutPrefix(i.State, prefix)
+		i.Target, _ = strings.CutPrefix(i.Target, prefix)
+		ret = append(ret, i.String())
+	}
+
+	return ret
+}
+
+// Apply merges the plan into the memory machine.
+func (pl *Plan) Apply(mem *am.Machine) error {
+	if pl.Merged == nil {
+		return fmt.Errorf("%w: not processed", ErrPlan)
+	}
+
+	return mem.SetSchema(pl.Merged, pl.Names)
+}
+
+// Validate checks if activating [steps] in order ends with [goal] being active.
+func Validate(schema am.Schema, steps S, goal string) error {
+	// TODO check min steps amount
+	mach := am.New(context.Background(), schema, nil)
+	for _, step := range steps {
+		mach.Add1(step, nil)
+	}
+
+	if !mach.Is1(goal) {
+		return fmt.Errorf("%w: %s not active after %s", ErrPlan, goal, steps)
+	}
+
+	// TODO should fail when activated from the end
+
+	return nil
+}
+
+// ///// ///// /////
+
+// ///// SORTING
+
+// ///// ///// /////
+
+// Sort returns state names of [schema] ordered by "idx" tags, with final states last within an "idx" group.
+func Sort(schema am.Schema) S {
+	names := slices.Sorted(maps.Keys(schema))
+	sort.Stable(byIdx{names: names, schema: schema})
+
+	return names
+}
+
+type byIdx struct {
+	names  S
+	schema am.Schema
+}
+
+func (s byIdx) Len() int { return len(s.names) }
+func (s byIdx) Less(n1, n2 int) bool {
+	state1 := s.schema[s.names[n1]]
+	idx1 := amhelp.TagValueInt(state1.Tags, TagIdx)
+	isFinal1 := amhelp.TagValue(state1.Tags, TagFinal) != ""
+
+	state2 := s.schema[s.names[n2]]
+	idx2 := amhelp.TagValueInt(state2.Tags, TagIdx)
+	isFinal2 := amhelp.TagValue(state2.Tags, TagFinal) != ""
+
+	return idx1 < idx2 || (idx1 == idx2 && !isFinal1 && isFinal2)
+}
+func (s byIdx) Swap(i, j int) { s.names[i], s.names[j] = s.names[j], s.names[i] }
@@ -0,0 +1,104 @@
+package plan
+
+import (
+	"errors"
+	"testing"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSort(t *testing.T) {
+	schema := am.Schema{
+		"0": {
+			Tags: []string{
+				"idx:0",
+			},
+		},
+		"1": {
+			Remove: S{"2", "3"},
+			Tags: []string{
+				"idx:1",
+			},
+		},
+		"2": {
+			Remove: S{"1", "3"},
+			Tags: []string{
+				"idx:1",
+			},
+		},
+		"3": {
+			Remove: S{"1", "2"},
+			Tags: []string{
+				"idx:1",
+				"final",
+			},
+		},
+		"4": {
+			Tags: []string{
+				"idx:2",
+			},
+		},
+	}
+	names := Sort(schema)
+	assert.Equal(t, S{"0", "1", "2", "3", "4"}, names)
+}
+
+func TestCheck(t *testing.T) {
+	schema := am.Schema{
+		"A": {Require: S{"B", "Unknown"}, Remove: S{"B", "A"}},
+		"B": {Remove: S{"A"}},
+		"C": {Require: S{"D"}},
+		"D": {Require: S{"C"}},
+	}
+	issues := Check(schema, nil, true)
+
+	kinds := map[IssueKind]int{}
+	for _, i := range issues {
+		kinds[i.Kind]++
+	}
+	assert.Equal(t, 1, kinds[IssueDangling])
+	assert.Equal(t, 1, kinds[IssueSelf])
+	assert.Equal(t, 2, kinds[IssueConflict])
+	assert.Equal(t, 1, kinds[IssueCycle])
+
+	// repaired
+	assert.Equal(t, S{"B"}, schema["A"].Require)
+	assert.Empty(t, schema["A"].Remove)
+	assert.Empty(t, schema["B"].Remove)
+	// cycles stay
+	assert.Equal(t, S{"D"}, schema["C"].Require)
+}
+
+func TestProcess(t *testing.T) {
+	base := am.Schema{"Base": {}}
+	p := &Planner{Prefix: "Step", Goal: "Done", Repair: true}
+
+	// ok
+	pl, err := p.Process(base, S{"Base"}, am.Schema{
+		"Done":   {Auto: true, Require: S{"Second"}},
+		"First":  {Tags: []string{"idx:1"}, Remove: S{"First"}},
+		"Second": {Tags: []string{"idx:2"}, Require: S{"First"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, S{"StepDone", "StepFirst", "StepSecond"}, pl.Steps)
+	assert.Equal(t, S{"Base", "StepDone", "StepFirst", "StepSecond"}, pl.Names)
+	assert.Len(t, pl.Issues, 1)
+
+	mem := am.New(t.Context(), base, nil)
+	assert.NoError(t, pl.Apply(mem))
+	assert.True(t, mem.Has1("StepSecond"))
+
+	// cycle
+	pl, err = p.Process(base, S{"Base"}, am.Schema{
+		"Done":   {Auto: true, Require: S{"First"}},
+		"First":  {Require: S{"Second"}},
+		"Second": {Require: S{"First"}},
+	})
+	assert.True(t, errors.Is(err, ErrPlan))
+	assert.Equal(t, []string{"cycle: Second require First"}, pl.Feedback("Step"))
+
+	// missing goal
+	_, err = p.Process(base, S{"Base"}, am.Schema{"First": {}})
+	assert.True(t, errors.Is(err, ErrPlan))
+}
@@ -0,0 +1,99 @@
+package secai
+
+import (
+	"context"
+	"time"
+
+	"github.com/pancsta/secai/retention"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// RETENTION
+
+// ///// ///// /////
+
+// RetentionPolicies returns [retention] policies of [cfg], per data class.
+func RetentionPolicies(cfg shared.ConfigAgentRetention) map[retention.Class]retention.Policy {
+	policy := func(c shared.ConfigRetention) retention.Policy {
+		return retention.Policy{MaxAge: c.MaxAge, MaxCount: c.MaxCount}
+	}
+
+	return map[retention.Class]retention.Policy{
+		retention.ClassPrompts:     policy(cfg.Prompts),
+		retention.ClassTranscripts: policy(cfg.Transcripts),
+		retention.ClassHistory:     policy(cfg.History),
+		retention.ClassVals:        policy(cfg.Vals),
+		retention.ClassColly:       policy(cfg.Colly),
+	}
+}
+
+// RetentionEnforce purges the agent's data violating [shared.ConfigAgentRetention], see [retention.Enforce].
+func (a *AgentBase) RetentionEnforce(ctx context.Context, dryRun bool) (*retention.Report, error) {
+	if err := a.retentionFlush(ctx, dryRun); err != nil {
+		return nil, err
+	}
+
+	return retention.Enforce(ctx, a.retentionStore(), RetentionPolicies(a.cfg.Agent.Retention), dryRun)
+}
+
+// Wipe purges the agent's data selected by class and session, see [retention.Wipe].
+func (a *AgentBase) Wipe(ctx context.Context, opts retention.Opts) (*retention.Report, error) {
+	if err := a.retentionFlush(ctx, opts.DryRun); err != nil {
+		return nil, err
+	}
+
+	return retention.Wipe(ctx, a.retentionStore(), opts)
+}
+
+// private
+
+func (a *AgentBase) retentionStore() retention.Store {
+	ret := retention.Store{
+		Dir:  a.cfg.Agent.Dir,
+		Base: a.DbConn,
+	}
+	if a.Mach().Is1(ss.HistoryDBReady) {
+		ret.History = a.dbHist
+	}
+
+	return ret
+}
+
+// retentionFlush executes queued writes, so they don't outlive a purge.
+func (a *AgentBase) retentionFlush(ctx context.Context, dryRun bool) error {
+	if dryRun || a.DbConn == nil {
+		return nil
+	}
+
+	return a.dbFlush(ctx)
+}
+
+// retentionLoop enforces the retention on an interval, until [ctx] expires.
+func (a *AgentBase) retentionLoop(ctx context.Context) {
+	interval := a.cfg.Agent.Retention.Interval
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		report, err := a.RetentionEnforce(ctx, false)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			a.LogErr("retention", err)
+		} else if report.Total() > 0 {
+			a.Log("retention", "report", report.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return // expired
+		case <-t.C:
+		}
+	}
+}
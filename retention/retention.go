@@ -0,0 +1,358 @@
+// Package retention purges old data of an agent's dir (prompts, transcripts, history transitions, val files and the
+// colly cache), either according to retention policies or as a wipe selected by data class and session. Every run can
+// be a dry-run, which only reports what would be deleted.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pancsta/secai/db/sqlc"
+)
+
+// Class is a class of data with its own retention.
+type Class string
+
+const (
+	// ClassPrompts are prompts sent to LLMs, with responses (base DB).
+	ClassPrompts Class = "prompts"
+	// ClassTranscripts are messages of the chat transcript (base DB).
+	ClassTranscripts Class = "transcripts"
+	// ClassHistory are transitions of the machine's history (SQLite backend only).
+	ClassHistory Class = "history"
+	// ClassVals are debug value files in the "vals" dir.
+	ClassVals Class = "vals"
+	// ClassColly is the scraper's cache in the "colly" dir.
+	ClassColly Class = "colly"
+)
+
+// Classes are all the data classes, in the order of execution.
+var Classes = []Class{ClassPrompts, ClassTranscripts, ClassHistory, ClassVals, ClassColly}
+
+// ErrClass means an unknown data class.
+var ErrClass = errors.New("unknown data class")
+
+// ParseClasses parses a comma-separated list of classes. Empty means all.
+func ParseClasses(list string) ([]Class, error) {
+	if strings.TrimSpace(list) == "" {
+		return Classes, nil
+	}
+
+	var ret []Class
+	for _, name := range strings.Split(list, ",") {
+		c := Class(strings.TrimSpace(name))
+		if !slices.Contains(Classes, c) {
+			return nil, fmt.Errorf("%w: %s", ErrClass, c)
+		}
+		ret = append(ret, c)
+	}
+
+	return ret, nil
+}
+
+// Policy limits the age and the count of records of a single class. Records violating either limit are purged, zero
+// values disable a limit.
+type Policy struct {
+	// max age of a record
+	MaxAge time.Duration `kdl:",duration"`
+	// max number of records (rows or files), newest are kept
+	MaxCount int
+}
+
+// IsZero returns true when the policy keeps everything.
+func (p Policy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxCount <= 0
+}
+
+// Store points to the data of a single agent.
+type Store struct {
+	// Dir is the agent's dir, for files.
+	Dir string
+	// Base is the base DB, with prompts and the transcript.
+	Base *sql.DB
+	// History is the DB of the SQLite history backend, optional.
+	History *sql.DB
+}
+
+// Opts select what to purge.
+type Opts struct {
+	// Classes to purge, defaults to [Classes].
+	Classes []Class
+	// SessionID limits purging to a single session. Classes without sessions get skipped.
+	SessionID string
+	// DryRun only counts what would be deleted.
+	DryRun bool
+}
+
+// Result is a summary of a single class.
+type Result struct {
+	Class Class
+	// Count is the number of deleted (or matching, in a dry-run) rows or files.
+	Count int64
+	// Skipped is the reason why the class wasn't processed.
+	Skipped string
+}
+
+// Report is a summary of a purge.
+type Report struct {
+	DryRun  bool
+	Results []Result
+}
+
+// Total returns the total count of deleted (or matching) records.
+func (r *Report) Total() int64 {
+	var ret int64
+	for _, res := range r.Results {
+		ret += res.Count
+	}
+
+	return ret
+}
+
+func (r *Report) String() string {
+	verb := "deleted"
+	if r.DryRun {
+		verb = "to delete"
+	}
+
+	var b strings.Builder
+	for _, res := range r.Results {
+		if res.Skipped != "" {
+			_, _ = fmt.Fprintf(&b, "%s: skipped, %s\n", res.Class, res.Skipped)
+			continue
+		}
+		_, _ = fmt.Fprintf(&b, "%s: %d %s\n", res.Class, res.Count, verb)
+	}
+
+	return b.String()
+}
+
+// filter matches records older than Before, or beyond the newest Keep (-1 disables).
+type filter struct {
+	SessionID string
+	Before    time.Time
+	Keep      int64
+	DryRun    bool
+}
+
+func newFilter(p Policy, now time.Time) filter {
+	f := filter{Keep: -1}
+	if p.MaxAge > 0 {
+		f.Before = now.Add(-p.MaxAge)
+	}
+	if p.MaxCount > 0 {
+		f.Keep = int64(p.MaxCount)
+	}
+
+	return f
+}
+
+// Enforce purges records of each class violating its policy in [policies]. Classes without a policy are kept.
+func Enforce(ctx context.Context, s Store, policies map[Class]Policy, dryRun bool) (*Report, error) {
+	now := time.Now()
+	ret := &Report{DryRun: dryRun}
+	for _, c := range Classes {
+		p := policies[c]
+		if p.IsZero() {
+			continue
+		}
+		f := newFilter(p, now)
+		f.DryRun = dryRun
+
+		res, err := s.purge(ctx, c, f)
+		ret.Results = append(ret.Results, res)
+		if err != nil {
+			return ret, fmt.Errorf("%s: %w", c, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// Wipe deletes all the records of the selected classes, optionally of a single session.
+func Wipe(ctx context.Context, s Store, opts Opts) (*Report, error) {
+	classes := opts.Classes
+	if len(classes) == 0 {
+		classes = Classes
+	}
+	f := filter{
+		SessionID: opts.SessionID,
+		Before:    time.Now(),
+		Keep:      -1,
+		DryRun:    opts.DryRun,
+	}
+
+	ret := &Report{DryRun: opts.DryRun}
+	for _, c := range Classes {
+		if !slices.Contains(classes, c) {
+			continue
+		}
+		res, err := s.purge(ctx, c, f)
+		ret.Results = append(ret.Results, res)
+		if err != nil {
+			return ret, fmt.Errorf("%s: %w", c, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// private
+
+func (s Store) purge(ctx context.Context, c Class, f filter) (Result, error) {
+	ret := Result{Class: c}
+	var err error
+
+	switch c {
+	case ClassPrompts, ClassTranscripts:
+		if s.Base == nil {
+			ret.Skipped = "no base DB"
+			return ret, nil
+		}
+		ret.Count, err = purgeBase(ctx, sqlc.New(s.Base), c, f)
+
+	case ClassHistory:
+		switch {
+		case f.SessionID != "":
+			ret.Skipped = "not per session"
+		case s.History == nil:
+			ret.Skipped = "no history DB"
+		default:
+			ret.Count, err = purgeHistory(ctx, s.History, f)
+		}
+
+	case ClassVals, ClassColly:
+		if f.SessionID != "" {
+			ret.Skipped = "not per session"
+			return ret, nil
+		}
+		ret.Count, err = purgeFiles(ctx, filepath.Join(s.Dir, string(c)), f)
+
+	default:
+		err = fmt.Errorf("%w: %s", ErrClass, c)
+	}
+
+	return ret, err
+}
+
+func purgeBase(ctx context.Context, q *sqlc.Queries, c Class, f filter) (int64, error) {
+	var sessID any
+	if f.SessionID != "" {
+		sessID = f.SessionID
+	}
+	// timestamps are stored in the local time zone
+	before := f.Before.Local()
+
+	switch {
+	case c == ClassPrompts && f.DryRun:
+		return q.CountPromptsPurge(ctx, sqlc.CountPromptsPurgeParams{SessionID: sessID, Before: before, Keep: f.Keep})
+	case c == ClassPrompts:
+		return q.DeletePromptsPurge(ctx, sqlc.DeletePromptsPurgeParams{SessionID: sessID, Before: before, Keep: f.Keep})
+	case f.DryRun:
+		return q.CountMessagesPurge(ctx, sqlc.CountMessagesPurgeParams{SessionID: sessID, Before: before, Keep: f.Keep})
+	default:
+		return q.DeleteMessagesPurge(ctx, sqlc.DeleteMessagesPurgeParams{SessionID: sessID, Before: before, Keep: f.Keep})
+	}
+}
+
+// tables of the SQLite history backend, with human times in UTC
+const (
+	sqlHistMatch = `
+		FROM times t
+		WHERE t.h_time < ?1
+		   OR t.id NOT IN (SELECT t2.id FROM times t2 WHERE t2.machine_id = t.machine_id ORDER BY t2.id DESC LIMIT ?2)`
+	sqlHistCount       = `SELECT COUNT(*) ` + sqlHistMatch
+	sqlHistDeleteTicks = `
+		DELETE FROM ticks
+		WHERE (time_id, machine_id) IN (SELECT t.id, t.machine_id ` + sqlHistMatch + `)`
+	sqlHistDelete = `
+		DELETE FROM times
+		WHERE (id, machine_id) IN (SELECT t.id, t.machine_id ` + sqlHistMatch + `)`
+)
+
+func purgeHistory(ctx context.Context, conn *sql.DB, f filter) (int64, error) {
+	before := f.Before.UTC()
+	if f.DryRun {
+		var ret int64
+		err := conn.QueryRowContext(ctx, sqlHistCount, before, f.Keep).Scan(&ret)
+		return ret, err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, sqlHistDeleteTicks, before, f.Keep); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, sqlHistDelete, before, f.Keep)
+	if err != nil {
+		return 0, err
+	}
+	ret, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, tx.Commit()
+}
+
+func purgeFiles(ctx context.Context, dir string, f filter) (int64, error) {
+	type file struct {
+		path string
+		mod  time.Time
+	}
+
+	// newest first
+	var files []file
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, file{path: path, mod: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	slices.SortStableFunc(files, func(a, b file) int {
+		return b.mod.Compare(a.mod)
+	})
+
+	var ret int64
+	for i, fi := range files {
+		if (f.Keep < 0 || int64(i) < f.Keep) && !fi.mod.Before(f.Before) {
+			continue
+		}
+		ret++
+		if f.DryRun {
+			continue
+		}
+		if err := os.Remove(fi.path); err != nil {
+			return ret - 1, err
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,112 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/db"
+	"github.com/pancsta/secai/db/sqlc"
+)
+
+func TestEnforceWipe(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+
+	// base DB with 2 old and 3 new messages, in 2 sessions
+	conn, _, err := db.Open(ctx, filepath.Join(dir, db.BaseFile), db.BaseMigrations)
+	require.NoError(t, err)
+	defer conn.Close()
+	q := sqlc.New(conn)
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour, time.Minute, time.Second} {
+		sess := "s1"
+		if i >= 3 {
+			sess = "s2"
+		}
+		_, err := q.AddMessage(ctx, sqlc.AddMessageParams{
+			SessionID: sess, Agent: "a", Sender: "user", Text: "hi", CreatedAt: now.Add(-age),
+		})
+		require.NoError(t, err)
+	}
+
+	// history DB
+	hist, err := db.Connect(filepath.Join(dir, "machine.sqlite"))
+	require.NoError(t, err)
+	defer hist.Close()
+	_, err = hist.ExecContext(ctx, `
+		CREATE TABLE times (id integer, machine_id integer, h_time datetime, PRIMARY KEY (id, machine_id));
+		CREATE TABLE ticks (time_id integer, machine_id integer, state_id integer);`)
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		_, err = hist.ExecContext(ctx, `INSERT INTO times VALUES (?, 1, ?)`, i, now.Add(-time.Duration(5-i)*time.Hour).UTC())
+		require.NoError(t, err)
+		_, err = hist.ExecContext(ctx, `INSERT INTO ticks VALUES (?, 1, 1)`, i)
+		require.NoError(t, err)
+	}
+
+	// 3 val files
+	vals := filepath.Join(dir, "vals")
+	require.NoError(t, os.MkdirAll(vals, 0755))
+	for i, name := range []string{"a.json", "b.json", "c.json"} {
+		file := filepath.Join(vals, name)
+		require.NoError(t, os.WriteFile(file, []byte("{}"), 0644))
+		mod := now.Add(-time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(file, mod, mod))
+	}
+
+	s := Store{Dir: dir, Base: conn, History: hist}
+	policies := map[Class]Policy{
+		ClassTranscripts: {MaxAge: 24 * time.Hour},
+		ClassHistory:     {MaxCount: 3},
+		ClassVals:        {MaxCount: 1},
+	}
+
+	// dry-run
+	report, err := Enforce(ctx, s, policies, true)
+	require.NoError(t, err)
+	assert.Equal(t, []Result{
+		{Class: ClassTranscripts, Count: 2},
+		{Class: ClassHistory, Count: 1},
+		{Class: ClassVals, Count: 2},
+	}, report.Results)
+	assert.Contains(t, report.String(), "transcripts: 2 to delete")
+	msgs, err := q.ListMessagesSince(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 5)
+
+	// enforce
+	report, err = Enforce(ctx, s, policies, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), report.Total())
+	msgs, err = q.ListMessagesSince(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 3)
+	var ticks int
+	require.NoError(t, hist.QueryRowContext(ctx, `SELECT COUNT(*) FROM ticks`).Scan(&ticks))
+	assert.Equal(t, 3, ticks)
+	files, err := os.ReadDir(vals)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "a.json", files[0].Name())
+
+	// wipe a single session
+	report, err = Wipe(ctx, s, Opts{Classes: []Class{ClassTranscripts, ClassVals}, SessionID: "s2"})
+	require.NoError(t, err)
+	assert.Equal(t, []Result{
+		{Class: ClassTranscripts, Count: 2},
+		{Class: ClassVals, Skipped: "not per session"},
+	}, report.Results)
+	msgs, err = q.ListMessagesSince(ctx, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "s1", msgs[0].SessionID)
+
+	_, err = ParseClasses("prompts,foo")
+	assert.ErrorIs(t, err, ErrClass)
+}
@@ -0,0 +1,271 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/db/sqlc"
+	"github.com/pancsta/secai/i18n"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// REWIND
+
+// ///// ///// /////
+
+// ErrRewind means there's no point in history to rewind to.
+var ErrRewind = errors.New("nothing to rewind")
+
+// RewindFind resolves a point in this session's history. [to] is the machine time sum of a recorded transition to
+// rewind to, [before] is a state to rewind before its latest activation. Both empty mean before the latest activation of
+// any [shared.AgentAPI.RewindStates].
+func (a *AgentBase) RewindFind(ctx context.Context, to uint64, before string) (*shared.RewindPoint, error) {
+	hist, err := a.Hist()
+	if err != nil {
+		return nil, err
+	}
+	if before != "" && !hist.IsTracked1(before) {
+		return nil, fmt.Errorf("%w: %s not tracked", am.ErrStateMissing, before)
+	}
+	if err := hist.Sync(); err != nil {
+		return nil, err
+	}
+
+	// newest first
+	recs, err := hist.FindLatest(ctx, false, 0, amhist.Query{
+		Start: amhist.ConditionTime{HTime: a.startedAt},
+		End:   amhist.ConditionTime{HTime: time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tracked := hist.Config().TrackedStates
+	var states am.S
+	switch {
+	case to > 0:
+	case before != "":
+		states = am.S{before}
+	case a.agentImpl != nil:
+		states = a.agentImpl.RewindStates()
+	}
+
+	for _, r := range recs {
+		t := r.Time
+		if t == nil || len(t.MTimeTracked) != len(tracked) {
+			continue
+		}
+
+		// after the transition
+		if to > 0 {
+			if t.MTimeSum > to {
+				continue
+			}
+			return &shared.RewindPoint{
+				MTimeSum: t.MTimeSum,
+				// the next transition
+				HTime:  t.HTime.Add(time.Nanosecond).Local(),
+				Active: activeTracked(tracked, t.MTimeTracked),
+			}, nil
+		}
+
+		// before the activation
+		if len(t.MTimeTrackedDiff) != len(tracked) {
+			continue
+		}
+		activated := slices.ContainsFunc(states, func(s string) bool {
+			idx := slices.Index(tracked, s)
+			return idx >= 0 && am.IsActiveTick(t.MTimeTracked[idx]) && t.MTimeTrackedDiff[idx] > 0
+		})
+		if !activated {
+			continue
+		}
+		prev := make(am.Time, len(tracked))
+		for i, tick := range t.MTimeTracked {
+			prev[i] = tick - t.MTimeTrackedDiff[i]
+		}
+
+		return &shared.RewindPoint{
+			MTimeSum: t.MTimeSum - t.MTimeDiffSum,
+			HTime:    t.HTime.Local(),
+			Active:   activeTracked(tracked, prev),
+		}, nil
+	}
+
+	return nil, ErrRewind
+}
+
+func (a *AgentBase) RewindEnter(e *am.Event) bool {
+	return a.agentImpl != nil
+}
+
+// RewindState reverts the agent to the point passed via [shared.A.RewindTo] or [shared.A.RewindBefore]. Rewindable
+// states activated since get removed and the ones deactivated since get re-added, the memory machine (if tracked via
+// [AgentBase.RewindTrackMem]) gets reverted, while the chat transcript is truncated and [ss.Rewound] added.
+func (a *AgentBase) RewindState(e *am.Event) {
+	mach := a.Mach()
+	ctx := mach.NewStateCtx(ss.Rewind)
+	args := shared.ParseArgs(e.Args)
+	sessID := a.sessionID
+
+	mach.Fork(ctx, e, func() {
+		defer mach.EvRemove1(e, ss.Rewind, nil)
+
+		point, err := a.RewindFind(ctx, args.RewindTo, args.RewindBefore)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if errors.Is(err, ErrRewind) {
+			a.Log("rewind", "err", err)
+			return
+		}
+		if err != nil {
+			AddErrDB(e, mach, err)
+			return
+		}
+
+		// revert states
+		point.Removed = slices.DeleteFunc(mach.ActiveStates(a.agentImpl.RewindStates()), func(s string) bool {
+			return slices.Contains(point.Active, s)
+		})
+		mach.EvRemove(e, point.Removed, nil)
+		var readd am.S
+		for _, s := range a.agentImpl.RewindStates() {
+			if slices.Contains(point.Active, s) && !mach.Is1(s) {
+				readd = append(readd, s)
+			}
+		}
+		if len(readd) > 0 {
+			mach.EvAdd(e, readd, nil)
+		}
+		a.rewindMem(point.HTime)
+
+		// truncate the transcript
+		mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{
+			DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+				return sqlc.New(a.DBTX(tx)).DeleteMessagesSince(ctx, sqlc.DeleteMessagesSinceParams{
+					SessionID: sessID,
+					CreatedAt: point.HTime,
+				})
+			},
+		}))
+
+		mach.EvAdd(e, am.S{ss.Rewound, ss.CheckStories}, Pass(&A{Rewind: point}))
+		a.Output(a.T(i18n.KeyRewound, strings.Join(point.Removed, ", ")), shared.FromSystem)
+	})
+}
+
+// RewindTrackMem records the active states of the memory machine, so [ss.Rewind] can revert it. Call it again after
+// replacing the memory machine, which forgets the previous one.
+func (a *AgentBase) RewindTrackMem(mem *am.Machine) error {
+	j := &memJournal{mach: mem}
+	j.record(mem.ActiveStates(nil))
+	if err := mem.BindTracer(j); err != nil {
+		return err
+	}
+	a.memJournal = j
+
+	return nil
+}
+
+// rewindMem reverts the memory machine to its active states at [at].
+func (a *AgentBase) rewindMem(at time.Time) {
+	j := a.memJournal
+	if j == nil || j.mach.IsDisposed() {
+		return
+	}
+	active, ok := j.at(at)
+	if !ok {
+		return
+	}
+
+	mem := j.mach
+	names := mem.StateNames()
+	remove := slices.DeleteFunc(mem.ActiveStates(nil), func(s string) bool {
+		return s == am.StateException || slices.Contains(active, s)
+	})
+	add := slices.DeleteFunc(slices.Clone(active), func(s string) bool {
+		return s == am.StateException || !slices.Contains(names, s) || mem.Is1(s)
+	})
+	if len(remove) > 0 {
+		mem.Remove(remove, nil)
+	}
+	if len(add) > 0 {
+		mem.Add(add, nil)
+	}
+}
+
+// memJournalLen is the max number of entries in [memJournal].
+const memJournalLen = 1000
+
+type memJournalEntry struct {
+	HTime  time.Time
+	Active am.S
+}
+
+// memJournal is a tracer recording the active states of the memory machine after each accepted transition. Memory
+// states are dynamic, so it keeps names instead of machine times.
+type memJournal struct {
+	*am.TracerNoOp
+
+	mach    *am.Machine
+	mx      sync.Mutex
+	entries []memJournalEntry
+}
+
+func (j *memJournal) TransitionEnd(tx *am.Transition) {
+	if !tx.IsAccepted.Load() || tx.Mutation.IsCheck {
+		return
+	}
+	names := j.mach.StateNames()
+	if len(names) < len(tx.TimeAfter) {
+		return
+	}
+	j.record(activeTracked(names, tx.TimeAfter))
+}
+
+func (j *memJournal) record(active am.S) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	j.entries = append(j.entries, memJournalEntry{HTime: time.Now(), Active: active})
+	if len(j.entries) > memJournalLen {
+		j.entries = slices.Delete(j.entries, 0, len(j.entries)-memJournalLen)
+	}
+}
+
+// at returns the active states at [t].
+func (j *memJournal) at(t time.Time) (am.S, bool) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if !j.entries[i].HTime.After(t) {
+			return j.entries[i].Active, true
+		}
+	}
+
+	return nil, false
+}
+
+// activeTracked returns the active states of a tracked machine time.
+func activeTracked(tracked am.S, t am.Time) am.S {
+	var ret am.S
+	for i, tick := range t {
+		if am.IsActiveTick(tick) {
+			ret = append(ret, tracked[i])
+		}
+	}
+
+	return ret
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"os"
 
+	"github.com/pancsta/secai/agent_llm"
 	"github.com/pancsta/secai/db"
 )
 
@@ -11,7 +13,7 @@ var schemaFile = "db/schema.sql"
 func main() {
 
 	// init DB
-	_, schema, err := db.Open("file::memory:")
+	_, schema, err := db.Open(context.Background(), "file::memory:", db.BaseMigrations, agent_llm.Migrations)
 	if err != nil {
 		panic(err)
 	}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"log"
@@ -17,6 +18,8 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"dario.cat/mergo"
@@ -45,6 +48,7 @@ import (
 
 	"github.com/pancsta/secai/db"
 	"github.com/pancsta/secai/db/sqlc"
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
 	"github.com/pancsta/secai/states"
 )
@@ -65,7 +69,10 @@ var ParseArgs = shared.ParseArgs
 
 var (
 	ErrHistNil = errors.New("history is nil")
-	ErrNoAI    = errors.New("no AI provider configured")
+	// ErrHistBackend means the history backend isn't supported by this build.
+	ErrHistBackend = errors.New("history backend not supported")
+	ErrDBNil       = errors.New("DB is nil")
+	ErrNoAI        = errors.New("no AI provider configured")
 )
 
 // DOCUMENT
@@ -117,8 +124,9 @@ func (d *Document) AddToPrompts(prompts ...PromptApi) {
 // ///// ///// /////
 
 type PromptMsg struct {
-	From    instrc.Role
-	Content string
+	From      instrc.Role
+	Content   string
+	CreatedAt time.Time
 }
 
 type PromptApi interface {
@@ -128,6 +136,7 @@ type PromptApi interface {
 	GenSysPrompt() string
 	Conversation() (*instrc.Conversation, string)
 	HistClean()
+	HistRewind(since time.Time)
 }
 
 type PromptSchemaless = Prompt[any, any]
@@ -167,9 +176,16 @@ func NewPrompt[P any, R any](agent shared.AgentBaseAPI, state, condition, steps,
 }
 
 func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
+	res, _, err := p.ExecRef(e, params)
+	return res, err
+}
+
+// ExecRef is [Prompt.Exec] which also returns a reference to the persisted prompt, to be passed to
+// [AgentBase.OutputPrompt].
+func (p *Prompt[P, R]) ExecRef(e *am.Event, params P) (*R, *shared.PromptRef, error) {
 	// TODO choose AI per prompt
 	if p.State == "" {
-		return nil, fmt.Errorf("prompt state not set")
+		return nil, nil, fmt.Errorf("prompt state not set")
 	}
 
 	// prep the machine
@@ -179,7 +195,7 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 	outDir := cfg.Agent.Dir
 	err := os.MkdirAll(filepath.Join(outDir, "prompts"), 0755)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output dir: %w", err)
+		return nil, nil, fmt.Errorf("failed to create output dir: %w", err)
 	}
 
 	// metrics
@@ -204,14 +220,14 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 		provider = "gemini"
 		model = gemini.Cfg.Model
 	} else {
-		return nil, fmt.Errorf("%w: %s", ErrNoAI, p.State)
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoAI, p.State)
 	}
 
 	// gen an LLM prompt
 	sessID := mach.Id() + "-" + p.State
 	prompt, err := json.MarshalIndent(params, "", "	")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal params: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal params: %w", err)
 	}
 	// contentLog, _ := json.Marshal(params)
 	contentStr := string(prompt)
@@ -229,13 +245,13 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 		// save sys msg to output dir under "statename.sys.md"
 		filename := filepath.Join(outDir, "prompts", p.State+".sys.md")
 		if err := os.WriteFile(filename, []byte(sys), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write prompt file: %w", err)
+			return nil, nil, fmt.Errorf("failed to write prompt file: %w", err)
 		}
 
 		// save the prompt to output dir under "statename.prompt.json"
 		filename = filepath.Join(outDir, "prompts", p.State+".prompt.json")
 		if err := os.WriteFile(filename, prompt, 0644); err != nil {
-			return nil, fmt.Errorf("failed to write prompt file: %w", err)
+			return nil, nil, fmt.Errorf("failed to write prompt file: %w", err)
 		}
 	}
 
@@ -254,7 +270,7 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 		if errAI == nil {
 			resultJ, err = json.MarshalIndent(result, "", "	")
 			if err != nil {
-				return nil, fmt.Errorf("failed to marshal result: %w", err)
+				return nil, nil, fmt.Errorf("failed to marshal result: %w", err)
 			}
 		}
 	} else if gemini != nil {
@@ -266,15 +282,16 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 		if errAI == nil {
 			resultJ, err = json.MarshalIndent(result, "", "	")
 			if err != nil {
-				return nil, fmt.Errorf("failed to marshal result: %w", err)
+				return nil, nil, fmt.Errorf("failed to marshal result: %w", err)
 			}
 		}
 	}
 
 	// persist in SQL
+	ref := &shared.PromptRef{}
 	args := &A{
-		DBQuery: func(ctx context.Context) error {
-			q := p.A.QueriesBase()
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			q := sqlc.New(p.A.DBTX(tx))
 
 			dbId, err := q.AddPrompt(ctx, sqlc.AddPromptParams{
 				SessionID:   sessID,
@@ -293,6 +310,7 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 				return err
 			}
 			p.A.Log(p.State, "query", "SELECT * FROM prompts WHERE id="+strconv.Itoa(int(dbId)))
+			ref.SetID(dbId)
 
 			err = q.AddPromptResponse(ctx, sqlc.AddPromptResponseParams{
 				Response: sql.NullString{String: string(resultJ), Valid: true},
@@ -315,32 +333,35 @@ func (p *Prompt[P, R]) Exec(e *am.Event, params P) (*R, error) {
 		}
 		p.A.LogErr("ai_req", errAI, data...)
 		// TODO handle context cancelled
-		return nil, fmt.Errorf("ai_%s_%s: %w", provider, model, errAI)
+		return nil, nil, fmt.Errorf("ai_%s_%s: %w", provider, model, errAI)
 	}
 
 	p.A.Logger().Info(p.State, "result", result)
 
 	// persist in mem and fs
 	if p.HistoryMsgLen > 0 {
+		now := time.Now()
 		p.Msgs = append(p.Msgs, &PromptMsg{
-			From:    instrc.RoleUser,
-			Content: contentStr,
+			From:      instrc.RoleUser,
+			Content:   contentStr,
+			CreatedAt: now,
 		}, &PromptMsg{
-			From:    instrc.RoleAssistant,
-			Content: string(resultJ),
+			From:      instrc.RoleAssistant,
+			Content:   string(resultJ),
+			CreatedAt: now,
 		})
 	}
 	if outDir != "" {
 		filename := filepath.Join(outDir, "prompts", p.State+".resp.json")
 		if err := os.WriteFile(filename, resultJ, 0644); err != nil {
-			return nil, fmt.Errorf("failed to write prompt file: %w", err)
+			return nil, nil, fmt.Errorf("failed to write prompt file: %w", err)
 		}
 	}
 
 	// confirm config OK TODO handle better
 	p.A.Mach().EvAdd1(e, ss.ConfigValid, nil)
 
-	return &result, nil
+	return &result, ref, nil
 }
 
 // AddTool registers a SECAI TOOL which then exports it's documents into the system prompt. This is different from an AI tool.
@@ -391,9 +412,14 @@ func (p *Prompt[P, R]) GenSysPrompt() string {
 		steps = "# INTERNAL ASSISTANT STEPS\n\n" + p.Steps + "\n"
 	}
 
+	res := p.Result
+	if locale := p.A.Locale(); i18n.Base(locale) != i18n.Default {
+		res += fmt.Sprintf("\nWrite all human-readable texts in %s. Keep IDs, keys and state names unchanged.",
+			i18n.Language(locale))
+	}
 	result := ""
-	if p.Result != "" {
-		result = "# OUTPUT INSTRUCTIONS\n\n" + p.Result + "\n"
+	if res != "" {
+		result = "# OUTPUT INSTRUCTIONS\n\n" + strings.TrimLeft(res, "\n") + "\n"
 	}
 
 	// template
@@ -425,6 +451,13 @@ func (p *Prompt[P, R]) HistClean() {
 	p.Msgs = nil
 }
 
+// HistRewind drops the history messages created since [since].
+func (p *Prompt[P, R]) HistRewind(since time.Time) {
+	p.Msgs = slices.DeleteFunc(p.Msgs, func(m *PromptMsg) bool {
+		return !m.CreatedAt.Before(since)
+	})
+}
+
 // ///// ///// /////
 
 // ///// AGENT
@@ -441,19 +474,24 @@ type AgentBase struct {
 	// TODO atomic?
 	OfferList []string
 	DbConn    *sql.DB
-
-	agentImpl     shared.AgentAPI
-	logger        *slog.Logger
-	cfg           *shared.Config
-	mach          *am.Machine
-	histMem       *amhist.Memory
-	histSQLite    *amhistg.Memory
+	// DBMigrations are applied to the base DB after [db.BaseMigrations], eg tables of embedded agents.
+	DBMigrations []*db.Migrations
+
+	agentImpl  shared.AgentAPI
+	logger     *slog.Logger
+	cfg        *shared.Config
+	mach       *am.Machine
+	histMem    *amhist.Memory
+	histSQLite *amhistg.Memory
+	// histBBolt is [amhistbb.Memory] on desktop builds
+	histBBolt     amhist.MemoryApi
 	openAI        []*shared.OpenAIClient
 	gemini        []*shared.GeminiClient
 	openAIHistory []openai.Message
 	maxRetries    int
 	dbQueries     *sqlc.Queries
-	dbPending     []func(ctx context.Context) error
+	dbQueue       dbQueue
+	dbStats       *shared.DBStats
 	states        am.S
 	machSchema    am.Schema
 	ctx           context.Context
@@ -464,21 +502,52 @@ type AgentBase struct {
 	dbg        *debugger.Debugger
 	dbHist     *sql.DB
 	dumper     *dump.Dumper
+	// storiesCancel disposes story triggers' subscriptions
+	storiesCancel  context.CancelFunc
+	storiesMx      sync.Mutex
+	storiesPending atomic.Bool
+	// storiesCause is the last trigger state which scheduled CheckStories
+	storiesCause atomic.Value
+	// storiesHist are the last results of history triggers, per story
+	storiesHist atomic.Pointer[map[string]bool]
+	sessionID   string
+	startedAt   time.Time
+	// locale overrides the configured locale for this session
+	locale atomic.Pointer[string]
+	// mcp is the MCP server, see [AgentBase.MCPServer]
+	mcp mcpServer
+	// memJournal are the past active states of the memory machine, see [AgentBase.RewindTrackMem]
+	memJournal *memJournal
 }
 
 var _ shared.AgentBaseAPI = &AgentBase{}
 var _ shared.AgentInit = &AgentBase{}
 
+// dbStatsVars exposes [shared.DBStats] of all the agents on /debug/vars, see [shared.ConfigDebug.ProfilerAddr].
+var dbStatsVars = expvar.NewMap("secai_db")
+
 func NewAgent(ctx context.Context, states am.S, machSchema am.Schema) *AgentBase {
 	a := &AgentBase{
 		DisposedHandlers: &ssam.DisposedHandlers{},
 		states:           states,
 		machSchema:       machSchema,
 		ctx:              ctx,
+		sessionID:        amhelp.RandId(8),
+		dbStats:          &shared.DBStats{},
 		store: &shared.AgentStore{
 			M: make(map[string]any),
 		},
 	}
+	a.dbQueue.flushCh = make(chan struct{}, 1)
+	// dont lose queued writes
+	a.DisposedHandlers.DisposedHandlers = append(a.DisposedHandlers.DisposedHandlers,
+		func(id string, ctx context.Context) {
+			// BaseDBReady doesn't end on disposal
+			if a.mach.Is1(ss.BaseDBReady) {
+				a.dbCloseLater(a.DbConn)
+			}
+			a.dbClose()
+		})
 
 	return a
 }
@@ -573,9 +642,18 @@ func (a *AgentBase) AgentImpl() shared.AgentAPI {
 
 // Output is a sugar for adding a [schema.AgentBaseStatesDef.Msg] mutation.
 func (a *AgentBase) Output(txt string, from shared.From) am.Result {
+	return a.OutputPrompt(txt, from, nil)
+}
+
+// OutputPrompt outputs text produced by the prompt of [ref], see [Prompt.ExecRef]. The transcript links the message
+// to that prompt.
+func (a *AgentBase) OutputPrompt(txt string, from shared.From, ref *shared.PromptRef) am.Result {
 	// TODO check last msg and avoid dups
+	msg := shared.NewPromptMsg(txt, from, ref)
+	msg.SessionID = a.sessionID
+
 	return a.Mach().Add1(ss.UIMsg, PassRpc(&A{
-		Msg: shared.NewMsg(txt, from),
+		Msg: msg,
 	}))
 }
 
@@ -631,14 +709,59 @@ func (a *AgentBase) Logger() *slog.Logger {
 	return a.logger
 }
 
+func (a *AgentBase) SessionID() string {
+	return a.sessionID
+}
+
+func (a *AgentBase) Locale() string {
+	if l := a.locale.Load(); l != nil {
+		return *l
+	}
+	if a.cfg != nil && a.cfg.Agent.Locale != "" {
+		return i18n.Normalize(a.cfg.Agent.Locale)
+	}
+
+	return i18n.Default
+}
+
+// T returns a UI string under [key], translated to the session's locale.
+func (a *AgentBase) T(key string, args ...any) string {
+	return i18n.T(a.Locale(), key, args...)
+}
+
 func (a *AgentBase) QueriesBase() *sqlc.Queries {
 	if a.dbQueries == nil {
-		a.dbQueries = sqlc.New(a.DbConn)
+		a.dbQueries = sqlc.New(a.DBTX(a.DbConn))
 	}
 
 	return a.dbQueries
 }
 
+// DBTX wraps [conn] (a DB or a transaction) with query logging and timing, according to [shared.ConfigAgentDB].
+// Usable with all the sqlc Queries.
+func (a *AgentBase) DBTX(conn shared.DBTX) shared.DBTX {
+	ret := &shared.LogDB{
+		DB:     conn,
+		Logger: a.logger,
+		Stats:  a.dbStats,
+	}
+	if a.cfg != nil {
+		cfg := a.cfg.Agent.DB
+		ret.All = cfg.Log
+		ret.Slow = cfg.SlowQuery
+		if cfg.LogMach {
+			ret.Mach = a.mach
+		}
+	}
+
+	return ret
+}
+
+// DBStats returns query stats of all the DBTX-wrapped connections.
+func (a *AgentBase) DBStats() *shared.DBStats {
+	return a.dbStats
+}
+
 func (a *AgentBase) BuildOffer() string {
 	ret := ""
 	for i, o := range a.OfferList {
@@ -657,6 +780,11 @@ func (a *AgentBase) Hist() (amhist.MemoryApi, error) {
 			return nil, ErrHistNil
 		}
 		return a.histSQLite, nil
+	case amhist.BackendBbolt:
+		if a.histBBolt == nil {
+			return nil, ErrHistNil
+		}
+		return a.histBBolt, nil
 	default:
 		if a.histMem == nil {
 			return nil, ErrHistNil
@@ -677,10 +805,6 @@ func (a *AgentBase) HistSQLite() *amhistg.Memory {
 	return a.histSQLite
 }
 
-// func (a *AgentBase) HistBBolt() *amhistbb.Memory {
-// 	return a.histBBolt
-// }
-
 func (a *AgentBase) Store() *shared.AgentStore {
 	return a.store
 }
@@ -705,6 +829,7 @@ func (a *AgentBase) StoryActivate(e *am.Event, story string) am.Result {
 	return mach.EvAdd(e, S{ss.StoryChanged, ss.CheckStories}, Pass(&A{
 		StatesList:   S{story},
 		ActivateList: []bool{true},
+		Trigger:      "manual",
 	}))
 }
 
@@ -716,6 +841,7 @@ func (a *AgentBase) StoryDeactivate(e *am.Event, story string) am.Result {
 	return mach.EvAdd(e, S{ss.StoryChanged, ss.CheckStories}, Pass(&A{
 		StatesList:   S{story},
 		ActivateList: []bool{false},
+		Trigger:      "manual",
 	}))
 }
 
@@ -780,6 +906,12 @@ func (a *AgentBase) StartEnter(e *am.Event) bool {
 func (a *AgentBase) StartState(e *am.Event) {
 	err := os.MkdirAll(a.cfg.Agent.Dir, 0755)
 	a.Mach().EvAddErr(e, err, nil)
+	a.startedAt = time.Now()
+
+	// MCP server
+	if a.cfg.MCP.Addr != "" {
+		a.mach.EvAdd1(e, ss.MCPStarting, nil)
+	}
 
 	// debug states
 	if a.dbg != nil {
@@ -788,6 +920,9 @@ func (a *AgentBase) StartState(e *am.Event) {
 	if a.cfg.Debug.REPL {
 		a.mach.EvAdd1(e, ss.REPL, nil)
 	}
+
+	// subscribe to story triggers
+	a.StoriesBind()
 }
 
 func (a *AgentBase) ExceptionState(e *am.Event) {
@@ -844,18 +979,11 @@ func (a *AgentBase) HistoryDBStartingState(e *am.Event) {
 			}
 
 		case amhist.BackendBbolt:
-			// TODO fix WASM
-			// cfgBB := amhistbb.Config{BaseConfig: histConfig}
-			// db, err := amhistbb.NewDb(file)
-			// if err != nil {
-			// 	mach.AddErr(err, nil)
-			// 	return
-			// }
-			// a.histBBolt, err = amhistbb.NewMemory(a.ctx, db, mach, cfgBB, onErr)
-			// if err != nil {
-			// 	mach.AddErr(err, nil)
-			// 	return
-			// }
+			a.histBBolt, err = a.histBBoltNew(file, histConfig, onErr)
+			if err != nil {
+				mach.AddErr(err, nil)
+				return
+			}
 
 		default:
 			a.histMem, err = amhist.NewMemory(a.ctx, nil, mach, histConfig, onErr)
@@ -887,8 +1015,9 @@ func (a *AgentBase) BaseDBStartingState(e *am.Event) {
 		}
 
 		// init DB
-		dbFile := filepath.Join(a.cfg.Agent.Dir, "secai.sqlite")
-		conn, _, err := db.Open(dbFile)
+		dbFile := filepath.Join(a.cfg.Agent.Dir, db.BaseFile)
+		migrations := slices.Concat([]*db.Migrations{db.BaseMigrations}, a.DBMigrations)
+		conn, _, err := db.Open(ctx, dbFile, migrations...)
 		if ctx.Err() != nil {
 			return // expired
 		}
@@ -897,6 +1026,7 @@ func (a *AgentBase) BaseDBStartingState(e *am.Event) {
 			return
 		}
 		a.DbConn = conn
+		dbStatsVars.Set(a.Mach().Id(), a.dbStats)
 
 		// truncate
 		// TODO DEBUG
@@ -905,25 +1035,12 @@ func (a *AgentBase) BaseDBStartingState(e *am.Event) {
 		// 	return
 		// }
 
-		// exec late queries
-		for _, fn := range a.dbPending {
-			if ctx.Err() != nil {
-				return // expired
-			}
-			if err := fn(ctx); err != nil {
-				AddErrDB(e, a.mach, err)
-				return
-			}
-		}
-
 		if ctx.Err() != nil {
 			return // expired
 		}
 		a.Mach().Add1(ss.BaseDBReady, nil)
 	}()
 
-	// TODO migrations
-
 	// start
 	// tx, err := a.db.BeginTx(ctx, nil)
 	// if err != nil {
@@ -940,40 +1057,50 @@ func (a *AgentBase) BaseDBStartingState(e *am.Event) {
 	// }
 }
 
+func (a *AgentBase) BaseDBReadyState(e *am.Event) {
+	ctx := a.Mach().NewStateCtx(ss.BaseDBReady)
+
+	// flush writes queued before the DB was ready
+	if a.dbQueueLen() > 0 {
+		a.dbFlushSignal()
+	}
+	a.Mach().Go(ctx, func() {
+		a.dbFlushLoop(ctx)
+	})
+	a.Mach().Go(ctx, func() {
+		a.retentionLoop(ctx)
+	})
+}
+
 func (a *AgentBase) BaseDBReadyEnd(e *am.Event) {
-	err := a.DbConn.Close()
-	if err != nil {
-		a.Mach().AddErr(err, nil)
+	// flush and close outside of the handler
+	if a.dbCloseLater(a.DbConn) {
+		a.Mach().EvAdd1(e, ss.BaseDBClosing, nil)
 	}
 }
 
+func (a *AgentBase) BaseDBClosingState(e *am.Event) {
+	mach := a.Mach()
+	// the final flush shouldn't be interrupted
+	go func() {
+		a.dbClose()
+		mach.EvRemove1(e, ss.BaseDBClosing, nil)
+	}()
+}
+
 func (a *AgentBase) BaseDBSavingEnter(e *am.Event) bool {
 	return shared.ParseArgs(e.Args).DBQuery != nil
 }
 
+// BaseDBSavingState queues the query, which will be executed in a batch by [AgentBase.dbFlushLoop]. Queries queued
+// before BaseDBReady are flushed once the DB is ready.
 func (a *AgentBase) BaseDBSavingState(e *am.Event) {
+	a.dbEnqueue(shared.ParseArgs(e.Args).DBQuery)
+
 	// postpone if not BaseDBReady
-	fn := shared.ParseArgs(e.Args).DBQuery
 	if a.Mach().Not1(ss.BaseDBReady) {
-		a.dbPending = append(a.dbPending, fn)
-		a.Mach().Remove1(ss.BaseDBSaving, nil)
-
-		return
+		a.Mach().EvRemove1(e, ss.BaseDBSaving, nil)
 	}
-
-	// save
-	ctx := a.Mach().NewStateCtx(ss.BaseDBReady)
-	tick := a.Mach().Tick(ss.BaseDBSaving)
-	a.Mach().Go(ctx, func() {
-		if err := fn(ctx); err != nil {
-			AddErrDB(e, a.mach, err)
-		}
-
-		// the last one deactivates
-		if tick == a.Mach().Tick(ss.BaseDBSaving) {
-			a.Mach().Remove1(ss.BaseDBSaving, nil)
-		}
-	})
 }
 
 func (a *AgentBase) RequestingAIState(e *am.Event) {
@@ -1022,23 +1149,36 @@ func (a *AgentBase) InterruptedState(e *am.Event) {
 	// remove the current prompt only (allow for offline prompts)
 	a.Mach().Remove1(ss.Prompt, nil)
 	if args.IntByTimeout {
-		a.Output("Interrupted by a timeout", shared.FromSystem)
+		a.Output(a.T(i18n.KeyInterruptedTimeout), shared.FromSystem)
 	} else {
-		a.Output("Interrupted by the user", shared.FromSystem)
+		a.Output(a.T(i18n.KeyInterruptedUser), shared.FromSystem)
 	}
 }
 
 func (a *AgentBase) ResumeState(e *am.Event) {
-	a.Output("Resumed by the user", shared.FromSystem)
+	a.Output(a.T(i18n.KeyResumed), shared.FromSystem)
 }
 
 func (a *AgentBase) ConfigUpdateEnter(e *am.Event) bool {
-	return ParseArgs(e.Args).ConfigAI != nil
+	args := ParseArgs(e.Args)
+	return args.ConfigAI != nil || args.Locale != ""
 }
 
 func (a *AgentBase) ConfigUpdateState(e *am.Event) {
 	a.Mach().EvRemove1(e, ss.ConfigUpdate, nil)
-	cfg := ParseArgs(e.Args).ConfigAI
+	args := ParseArgs(e.Args)
+
+	// per-session locale
+	if args.Locale != "" {
+		locale := i18n.Normalize(args.Locale)
+		a.locale.Store(&locale)
+		a.Log("locale changed", "locale", locale)
+	}
+
+	cfg := args.ConfigAI
+	if cfg == nil {
+		return
+	}
 	// TODO support >1 backend
 	if cfg.OpenAI != nil {
 		a.cfg.AI.OpenAI = slices.Concat(a.cfg.AI.OpenAI, cfg.OpenAI)
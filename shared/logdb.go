@@ -0,0 +1,245 @@
+//go:build !wasm
+
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+)
+
+// ///// ///// /////
+
+// ///// DB LOGGING
+
+// ///// ///// /////
+
+// DBTX is the common interface of all the sqlc Queries (base, agent_llm, and agents), implemented by [sql.DB],
+// [sql.Tx], and [LogDB].
+type DBTX interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// LogDB wraps a [sql.DB] or [sql.Tx], logs statements with redacted args, durations, and affected rows, and collects
+// [DBStats]. Usage:
+//
+//	queries := sqlc.New(&LogDB{DB: conn, Logger: logger})
+type LogDB struct {
+	DB     DBTX
+	Logger *slog.Logger
+	// Mach is an optional machine to also log into.
+	Mach *am.Machine
+	// Stats is an optional stats collector.
+	Stats *DBStats
+	// All logs every statement, otherwise only the slow ones.
+	All bool
+	// Slow is the threshold of slow statements, which are logged as warnings. 0 disables.
+	Slow time.Duration
+}
+
+var _ DBTX = &LogDB{}
+
+// WithTx returns a copy of [l] wrapping [tx].
+func (l *LogDB) WithTx(tx *sql.Tx) *LogDB {
+	ret := *l
+	ret.DB = tx
+
+	return &ret
+}
+
+func (l *LogDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := l.DB.ExecContext(ctx, query, args...)
+	rows := int64(-1)
+	if err == nil {
+		rows, _ = res.RowsAffected()
+	}
+	l.log(query, args, time.Since(start), rows, err)
+
+	return res, err
+}
+
+func (l *LogDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := l.DB.PrepareContext(ctx, query)
+	l.log(query, nil, time.Since(start), -1, err)
+
+	return stmt, err
+}
+
+// QueryContext logs the time to the first row, as rows are read by the caller.
+func (l *LogDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := l.DB.QueryContext(ctx, query, args...)
+	l.log(query, args, time.Since(start), -1, err)
+
+	return rows, err
+}
+
+// QueryRowContext doesn't report errors, as those are returned by [sql.Row.Scan].
+func (l *LogDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := l.DB.QueryRowContext(ctx, query, args...)
+	l.log(query, args, time.Since(start), -1, row.Err())
+
+	return row
+}
+
+func (l *LogDB) log(query string, args []any, dur time.Duration, rows int64, err error) {
+	slow := l.Slow > 0 && dur >= l.Slow
+	if l.Stats != nil {
+		l.Stats.add(dur, slow, err)
+	}
+	if !l.All && !slow && err == nil {
+		return
+	}
+
+	name, query := SQLName(query)
+	attrs := []any{"name", name, "dur", dur}
+	if rows >= 0 {
+		attrs = append(attrs, "rows", rows)
+	}
+	if len(args) > 0 {
+		attrs = append(attrs, "args", RedactArgs(args))
+	}
+	attrs = append(attrs, "query", query)
+
+	msg := "sql"
+	switch {
+	case err != nil:
+		msg = "sql error"
+		attrs = append([]any{"err", err}, attrs...)
+		if l.Logger != nil {
+			l.Logger.Error(msg, attrs...)
+		}
+	case slow:
+		msg = "sql slow"
+		if l.Logger != nil {
+			l.Logger.Warn(msg, attrs...)
+		}
+	default:
+		if l.Logger != nil {
+			l.Logger.Info(msg, attrs...)
+		}
+	}
+	if l.Mach != nil {
+		l.Mach.Log("%s %s (%s): %s", msg, name, dur, query)
+	}
+}
+
+// SQLName extracts the name of a sqlc query ("-- name: GetFoo :one") and returns it with the compacted statement.
+func SQLName(query string) (name, stmt string) {
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		line, after, _ := strings.Cut(rest, "\n")
+		name, _, _ = strings.Cut(line, " ")
+		query = after
+	}
+
+	return name, strings.Join(strings.Fields(query), " ")
+}
+
+// RedactArgs hides the content of strings and bytes, keeping only their length. Other values are kept.
+func RedactArgs(args []any) []any {
+	ret := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil, bool, time.Time, time.Duration:
+			ret[i] = v
+		case string:
+			ret[i] = fmt.Sprintf("<string len=%d>", len(v))
+		case []byte:
+			ret[i] = fmt.Sprintf("<bytes len=%d>", len(v))
+		case sql.NullString:
+			if v.Valid {
+				ret[i] = fmt.Sprintf("<string len=%d>", len(v.String))
+			} else {
+				ret[i] = nil
+			}
+		default:
+			switch reflect.ValueOf(arg).Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+				reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+				ret[i] = v
+			default:
+				ret[i] = fmt.Sprintf("<%T>", v)
+			}
+		}
+	}
+
+	return ret
+}
+
+// DBStats collects query latency of a [LogDB]. Implements [expvar.Var].
+type DBStats struct {
+	queries atomic.Int64
+	errors  atomic.Int64
+	slow    atomic.Int64
+	// total latency in ns
+	total atomic.Int64
+	// max latency in ns
+	max atomic.Int64
+}
+
+func (s *DBStats) add(dur time.Duration, slow bool, err error) {
+	s.queries.Add(1)
+	s.total.Add(int64(dur))
+	if slow {
+		s.slow.Add(1)
+	}
+	if err != nil {
+		s.errors.Add(1)
+	}
+	for {
+		m := s.max.Load()
+		if int64(dur) <= m || s.max.CompareAndSwap(m, int64(dur)) {
+			break
+		}
+	}
+}
+
+// Queries returns the number of executed statements.
+func (s *DBStats) Queries() int64 {
+	return s.queries.Load()
+}
+
+// Errors returns the number of failed statements.
+func (s *DBStats) Errors() int64 {
+	return s.errors.Load()
+}
+
+// Slow returns the number of slow statements.
+func (s *DBStats) Slow() int64 {
+	return s.slow.Load()
+}
+
+// AvgLatency returns the average latency of all the statements.
+func (s *DBStats) AvgLatency() time.Duration {
+	q := s.queries.Load()
+	if q == 0 {
+		return 0
+	}
+
+	return time.Duration(s.total.Load() / q)
+}
+
+// MaxLatency returns the highest latency of a single statement.
+func (s *DBStats) MaxLatency() time.Duration {
+	return time.Duration(s.max.Load())
+}
+
+// String returns the stats as JSON.
+func (s *DBStats) String() string {
+	return fmt.Sprintf(`{"queries":%d,"errors":%d,"slow":%d,"avg_ms":%.3f,"max_ms":%.3f}`,
+		s.Queries(), s.Errors(), s.Slow(), float64(s.AvgLatency())/float64(time.Millisecond),
+		float64(s.MaxLatency())/float64(time.Millisecond))
+}
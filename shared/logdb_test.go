@@ -0,0 +1,76 @@
+//go:build !wasm
+
+package shared
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+)
+
+func TestLogDB(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sql.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	buf := &bytes.Buffer{}
+	stats := &DBStats{}
+	l := &LogDB{DB: conn, Logger: slog.New(slog.NewTextHandler(buf, nil)), Stats: stats, All: true}
+
+	if _, err := l.ExecContext(ctx, "CREATE TABLE foo (v text)"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.ExecContext(ctx, "-- name: AddFoo :exec\nINSERT INTO foo (v)\n  VALUES (?)", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ExecContext(ctx, "SELECT * FROM nope"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("args not redacted: %s", out)
+	}
+	if !strings.Contains(out, "name=AddFoo") || !strings.Contains(out, "rows=1") {
+		t.Errorf("missing name or rows: %s", out)
+	}
+	if !strings.Contains(out, `"INSERT INTO foo (v) VALUES (?)"`) {
+		t.Errorf("query not compacted: %s", out)
+	}
+	if stats.Queries() != 3 || stats.Errors() != 1 {
+		t.Errorf("stats: %s", stats)
+	}
+
+	// only slow and failed statements
+	buf.Reset()
+	l.All = false
+	l.Slow = time.Hour
+	if _, err := l.ExecContext(ctx, "DELETE FROM foo"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	got := RedactArgs([]any{"abc", []byte("de"), 3, true, nil, sql.NullString{}})
+	want := []any{"<string len=3>", "<bytes len=2>", 3, true, nil, nil}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
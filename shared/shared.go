@@ -1,6 +1,8 @@
 package shared
 
 import (
+	"cmp"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
@@ -13,6 +15,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -22,12 +25,16 @@ import (
 	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
 	am "github.com/pancsta/asyncmachine-go/pkg/machine"
 	"github.com/pancsta/asyncmachine-go/pkg/telemetry/dbg"
+
+	"github.com/pancsta/secai/i18n"
 )
 
 const (
 	// EnvConfig config location
 	EnvConfig   = "SECAI_CONFIG"
 	EnvNoDotEnv = "SECAI_NO_DOTENV"
+	// EnvDebugStory is a comma-separated list of stories to debug, see [ConfigDebug.Story].
+	EnvDebugStory = "SECAI_DEBUG_STORY"
 )
 
 // From enum
@@ -40,7 +47,7 @@ var (
 	FromUser      = From{"user"}
 	FromNarrator  = From{"narrator"}
 
-	FromEnum = enum.New(FromAssistant, FromSystem, FromUser)
+	FromEnum = enum.New(FromAssistant, FromSystem, FromUser, FromNarrator)
 )
 
 type OfferRef struct {
@@ -49,10 +56,40 @@ type OfferRef struct {
 	Text  string
 }
 
+// RewindPoint is a resolved point in the agent's history, see [AgentBaseAPI.RewindFind].
+type RewindPoint struct {
+	// MTimeSum is the machine time sum at this point.
+	MTimeSum uint64
+	// HTime is the human time of this point, later messages and prompts get dropped.
+	HTime time.Time
+	// Active are the tracked states active at this point.
+	Active am.S
+	// Removed are the states deactivated by the rewind.
+	Removed am.S
+}
+
+// Msgs drops [msgs] created since this point.
+func (p *RewindPoint) Msgs(msgs []*Msg) []*Msg {
+	if p == nil {
+		return msgs
+	}
+
+	return slices.DeleteFunc(msgs, func(m *Msg) bool {
+		return !m.CreatedAt.Before(p.HTime)
+	})
+}
+
 type Msg struct {
 	From      From
 	Text      string
 	CreatedAt time.Time
+	// SessionID is the agent's session which produced the message.
+	SessionID string
+	// PromptID is the ID of the persisted prompt which produced an assistant message, if any.
+	PromptID int64
+
+	// prompt which produced this message, resolved once persisted
+	prompt *PromptRef
 }
 
 func NewMsg(text string, from From) *Msg {
@@ -63,6 +100,38 @@ func NewMsg(text string, from From) *Msg {
 	}
 }
 
+// NewPromptMsg returns a message produced by the prompt of [ref].
+func NewPromptMsg(text string, from From, ref *PromptRef) *Msg {
+	msg := NewMsg(text, from)
+	msg.prompt = ref
+
+	return msg
+}
+
+// Prompt returns a reference to the prompt which produced this message, or nil.
+func (m *Msg) Prompt() *PromptRef {
+	return m.prompt
+}
+
+// PromptRef references a single execution of a prompt, and resolves to its DB ID once the prompt has been persisted.
+type PromptRef struct {
+	id atomic.Int64
+}
+
+// ID returns the DB ID of the prompt, or 0 if not persisted (yet).
+func (r *PromptRef) ID() int64 {
+	if r == nil {
+		return 0
+	}
+
+	return r.id.Load()
+}
+
+// SetID sets the DB ID of the prompt.
+func (r *PromptRef) SetID(id int64) {
+	r.id.Store(id)
+}
+
 func (m *Msg) String() string {
 	return m.Text
 }
@@ -102,9 +171,14 @@ type ARPC struct {
 	Stories      []StoryInfo  `log:"stories"`
 	StatesList   []string     `log:"states_list"`
 	ActivateList []bool       `log:"activate_list"`
+	Trigger      string       `log:"trigger"`
+	Locale       string       `log:"locale"`
 	Result       am.Result
 	ConfigAI     *ConfigAI
 	ClockDiff    [][]int
+	RewindTo     uint64
+	RewindBefore string
+	Rewind       *RewindPoint
 }
 
 // ParseArgs extracts A from [am.Event.Args][APrefix].
@@ -304,7 +378,6 @@ func isWSL() bool {
 // ///// STORY
 
 // ///// ///// /////
-// TODO add pro-active state triggers based on historical data
 
 // StoryInfo is a static model for [Story].
 type StoryInfo struct {
@@ -314,7 +387,8 @@ type StoryInfo struct {
 	Tick uint64
 	// Epoch is the sum of all previous memories, before a replacement.
 	Epoch uint64
-	// TODO htime for last activation
+	// The story was last activated at this human time.
+	ActivatedAt time.Time
 
 	// Title of this story.
 	Title string
@@ -343,6 +417,8 @@ type Story struct {
 	// this story).
 	CanActivate func(instance *Story) bool
 	Actions     []Action
+	// History is a persisted timeline of all the stories, available for CanActivate.
+	History StoryHistory
 }
 
 // New returns a copy of the story with the actions bound. Used to create new instances.
@@ -367,6 +443,44 @@ func (s *Story) Check() bool {
 	return s.CanActivate(s)
 }
 
+// StoryEvent is a persisted activation or deactivation of a story.
+type StoryEvent struct {
+	SessionID string
+	State     string
+	// Active is true for activations.
+	Active bool
+	// Cause is the trigger state, or "manual".
+	Cause string
+	// ActiveMs is the duration of the story, for deactivations.
+	ActiveMs int64
+	// ActiveTicks is the duration of the story in the agent's ticks, for deactivations.
+	ActiveTicks int64
+	CreatedAt   time.Time
+	MachTimeSum uint64
+}
+
+// StoryStats summarizes the past runs of a story.
+type StoryStats struct {
+	State string
+	// Runs is the number of finished runs.
+	Runs    int
+	AvgMs   int64
+	MaxMs   int64
+	TotalMs int64
+	// Preceding counts the stories activated right before this one, per session.
+	Preceding map[string]int
+	// Last is the most recent event.
+	Last *StoryEvent
+}
+
+// StoryHistory is a queryable timeline of story activations.
+type StoryHistory interface {
+	// StoryEvents returns the latest events of [state], or all the stories when empty. Newest first.
+	StoryEvents(ctx context.Context, state string, limit int) ([]StoryEvent, error)
+	// StoryStats returns stats of past runs of [state].
+	StoryStats(ctx context.Context, state string) (*StoryStats, error)
+}
+
 // StoryActor is a binding between a Story and an actor (state machine).
 type StoryActor struct {
 	Mach *am.Machine
@@ -377,6 +491,42 @@ type StoryActor struct {
 
 	// When these conditions are met, the story will activate itself.
 	Trigger amhelp.Cond
+	// HistTriggers are pro-active triggers, evaluated periodically over the actor's history. All of them have to pass,
+	// along with [StoryActor.Trigger]. Requires the actor's machine to be the agent's tracked one, and the states
+	// to be tracked (see AgentAPI.HistoryStates).
+	HistTriggers []HistTrigger
+}
+
+// HistTrigger is a pro-active story trigger based on the historical data of a single state. All the non-zero
+// conditions have to pass, eg:
+//   - "Foo active for more than 5 min": {State: "Foo", ActiveFor: 5 * time.Minute}
+//   - "Foo activated 3 times in the last hour": {State: "Foo", Activations: 3, Window: time.Hour}
+//   - "no user input for 10 min": {State: "Prompt", IdleFor: 10 * time.Minute}
+type HistTrigger struct {
+	State string `yaml:"state"`
+	// ActiveFor requires State to be currently active, without re-activations, for at least this long.
+	ActiveFor time.Duration `kdl:",duration" yaml:"activeFor"`
+	// IdleFor requires State to not be activated for at least this long (or since the start).
+	IdleFor time.Duration `kdl:",duration" yaml:"idleFor"`
+	// Activations requires State to be activated at least this many times within Window.
+	Activations int `yaml:"activations"`
+	// Window is the time window for Activations.
+	Window time.Duration `kdl:",duration" yaml:"window"`
+}
+
+func (t HistTrigger) String() string {
+	var ret []string
+	if t.ActiveFor > 0 {
+		ret = append(ret, fmt.Sprintf("active>%s", t.ActiveFor))
+	}
+	if t.IdleFor > 0 {
+		ret = append(ret, fmt.Sprintf("idle>%s", t.IdleFor))
+	}
+	if t.Activations > 0 {
+		ret = append(ret, fmt.Sprintf("activations>=%d/%s", t.Activations, t.Window))
+	}
+
+	return t.State + " " + strings.Join(ret, " ")
 }
 
 type Action struct {
@@ -483,6 +633,7 @@ type Config struct {
 	Agent ConfigAgent
 	Web   ConfigWeb
 	TUI   ConfigTUI
+	MCP   ConfigMCP
 	Tools ConfigTools
 	Debug ConfigDebug
 }
@@ -520,8 +671,26 @@ type ConfigAgent struct {
 	Intro     string
 	IntroDash string
 	Footer    string
-	Log       ConfigAgentLog
-	History   ConfigAgentHistory
+	// default locale of the agent, eg "en" or "pl-PL" (can be overridden per session)
+	Locale string
+	// translated intros, per locale
+	Translations []ConfigAgentTranslation `kdl:"Translation,multiple"`
+	Log          ConfigAgentLog
+	History      ConfigAgentHistory
+	Stories      ConfigAgentStories
+	Orienting    ConfigAgentOrienting
+	DB           ConfigAgentDB
+	Transcript   ConfigAgentTranscript
+	Facts        ConfigAgentFacts
+	Retention    ConfigAgentRetention
+}
+
+// ConfigAgentTranslation overrides agent texts for a locale.
+type ConfigAgentTranslation struct {
+	Locale    string
+	Intro     string `kdl:",omitempty"`
+	IntroDash string `kdl:",omitempty"`
+	Footer    string `kdl:",omitempty"`
 }
 
 type ConfigAgentLog struct {
@@ -537,7 +706,95 @@ type ConfigAgentLog struct {
 	MachPrint bool
 }
 
+type ConfigAgentStories struct {
+	// declarative stories file (KDL or YAML), defaults to stories.kdl or stories.yaml in the agent's dir
+	File string
+	// delay between a trigger's state change and checking the stories
+	Debounce time.Duration `kdl:",duration"`
+	// how often to evaluate history triggers (if any), 0 disables
+	HistInterval time.Duration `kdl:",duration"`
+}
+
+// ConfigAgentOrienting defines confidence bands of orienting moves: accepted (>= Accept), confirmed by the user
+// (>= Confirm) and rejected (below Confirm).
+type ConfigAgentOrienting struct {
+	// certainty above which a move is accepted without asking
+	Accept float64
+	// certainty above which a move is offered to the user for confirmation
+	Confirm float64
+	// max number of moves offered for confirmation
+	Candidates int
+	// score above which a local match skips the LLM, also for menu refs (0 disables)
+	Local float64
+	// how long to cache LLM decisions, also for menu refs (0 disables)
+	CacheTTL time.Duration `kdl:",duration"`
+}
+
+// ConfigAgentDB defines the write queue and query logging of the base DB. Queued queries are executed in batches,
+// each in a single transaction.
+type ConfigAgentDB struct {
+	// max number of queued queries before flushing
+	BatchSize int
+	// how often to flush the queue
+	FlushInterval time.Duration `kdl:",duration"`
+	// how many times to retry a batch when the DB is busy
+	Retries int
+	// log all SQL statements into the agent's log
+	Log bool
+	// also log SQL statements into the machine log
+	LogMach bool
+	// log statements slower than this as warnings, even without Log (0 disables)
+	SlowQuery time.Duration `kdl:",duration"`
+}
+
+// ConfigAgentFacts defines the long-term memory of facts about the user, extracted from the user's prompts and
+// recalled into LLM prompts.
+type ConfigAgentFacts struct {
+	// extract new facts from the user's prompts
+	Extract bool
+	// certainty below which extracted facts are dropped
+	MinCertainty float64
+	// max number of facts recalled into prompts
+	Recall int
+}
+
+// ConfigAgentRetention defines how long to keep the agent's data, per data class. Enforced periodically in the
+// background, zero values keep everything.
+type ConfigAgentRetention struct {
+	// how often to enforce the retention (0 disables)
+	Interval time.Duration `kdl:",duration"`
+	// prompts sent to LLMs
+	Prompts ConfigRetention
+	// messages of the chat transcript
+	Transcripts ConfigRetention
+	// transitions of the machine history (SQLite backend)
+	History ConfigRetention
+	// debug value files
+	Vals ConfigRetention
+	// scraper's cache
+	Colly ConfigRetention
+}
+
+// ConfigRetention limits the age and the count of records of a single data class.
+type ConfigRetention struct {
+	// max age of a record (0 disables)
+	MaxAge time.Duration `kdl:",duration"`
+	// max number of records, newest are kept (0 disables)
+	MaxCount int
+}
+
+// ConfigAgentTranscript defines the persisted chat transcript.
+type ConfigAgentTranscript struct {
+	// number of messages from previous sessions to restore on start (0 disables)
+	Restore int
+	// export format: md, json, html
+	Format string
+	// annotate exported assistant messages with IDs of prompts which produced them
+	Prompts bool
+}
+
 type ConfigAgentHistory struct {
+	// memory, sqlite, bbolt (desktop only)
 	Backend string
 	// TODO BackendParsed enum
 	Max int
@@ -555,6 +812,20 @@ type ConfigWeb struct {
 	DBPort int
 	// Start a log web UI on http://localhost:{LogPort}
 	LogPort int
+	// Serve an OpenAI-compatible chat completions API on /v1/chat/completions of Addr.
+	ChatAPI bool
+	// how long the chat API waits for replies
+	ChatTimeout time.Duration `kdl:",duration"`
+	// how long an idle chat API session keeps the agent
+	ChatSessionTTL time.Duration `kdl:",duration"`
+}
+
+// ConfigMCP configures the MCP server, exposing the agent to MCP clients.
+type ConfigMCP struct {
+	// HTTP address of the MCP server, with the streamable transport on /mcp and SSE on /sse. Empty disables.
+	Addr string
+	// how long the prompt tool waits for replies
+	ReplyTimeout time.Duration `kdl:",duration"`
 }
 
 type ConfigTUI struct {
@@ -574,9 +845,37 @@ type ConfigTUI struct {
 
 type ConfigTools struct {
 	SearXNG ConfigSearXNG
+	History ConfigToolsHistory
+	// external MCP servers, with each tool exposed as a secai tool
+	MCP []ConfigToolsMCP `kdl:"MCP,multiple"`
 	// TODO rest
 }
 
+// ConfigToolsMCP configures a connection to an external MCP server, either a stdio subprocess (Command) or HTTP (URL).
+type ConfigToolsMCP struct {
+	// Name of the server, used in tool IDs.
+	Name string
+	// Command starting a stdio server.
+	Command string
+	Args    []string
+	// Env are additional KEY=VALUE env vars of Command.
+	Env []string
+	// URL of an HTTP server (disables Command).
+	URL string
+	// Transport of URL: http (streamable) or sse.
+	Transport string
+	// Timeout of a single tool call.
+	Timeout time.Duration `kdl:",duration"`
+}
+
+// ConfigToolsHistory configures the timeline of the machine history, exposed to LLMs.
+type ConfigToolsHistory struct {
+	// default time window of the timeline
+	Window time.Duration `kdl:",duration"`
+	// max number of history records to read
+	Limit int
+}
+
 type ConfigSearXNG struct {
 	// Port to start a local instance on
 	Port string
@@ -618,16 +917,52 @@ type ConfigDebug struct {
 func ConfigDefault() Config {
 	return Config{
 		Agent: ConfigAgent{
-			Dir: "./tmp",
+			Dir:    "./tmp",
+			Locale: i18n.Default,
 			History: ConfigAgentHistory{
 				Backend: "memory",
 				Max:     1_000_000,
 			},
+			Stories: ConfigAgentStories{
+				Debounce:     50 * time.Millisecond,
+				HistInterval: 10 * time.Second,
+			},
+			Orienting: ConfigAgentOrienting{
+				Accept:     0.8,
+				Confirm:    0.5,
+				Candidates: 3,
+				Local:      0.85,
+				CacheTTL:   24 * time.Hour,
+			},
+			DB: ConfigAgentDB{
+				BatchSize:     50,
+				FlushInterval: 500 * time.Millisecond,
+				Retries:       5,
+				SlowQuery:     200 * time.Millisecond,
+			},
+			Transcript: ConfigAgentTranscript{
+				Restore: 20,
+				Format:  "md",
+			},
+			Facts: ConfigAgentFacts{
+				Extract:      true,
+				MinCertainty: 0.7,
+				Recall:       20,
+			},
+			Retention: ConfigAgentRetention{
+				Interval: time.Hour,
+				Prompts:  ConfigRetention{MaxAge: 30 * 24 * time.Hour},
+				History:  ConfigRetention{MaxAge: 30 * 24 * time.Hour},
+				Vals:     ConfigRetention{MaxAge: 7 * 24 * time.Hour},
+				Colly:    ConfigRetention{MaxAge: 7 * 24 * time.Hour},
+			},
 		},
 		Web: ConfigWeb{
-			Addr:    "localhost:12854",
-			LogPort: 12858,
-			DBPort:  -1,
+			Addr:           "localhost:12854",
+			LogPort:        12858,
+			DBPort:         -1,
+			ChatTimeout:    time.Minute,
+			ChatSessionTTL: 30 * time.Minute,
 		},
 		TUI: ConfigTUI{
 			PortSSH:    7855,
@@ -635,10 +970,17 @@ func ConfigDefault() Config {
 			Host:       "localhost",
 			ClockRange: 10,
 		},
+		MCP: ConfigMCP{
+			ReplyTimeout: time.Minute,
+		},
 		Tools: ConfigTools{
 			SearXNG: ConfigSearXNG{
 				Port: "7452",
 			},
+			History: ConfigToolsHistory{
+				Window: time.Hour,
+				Limit:  1000,
+			},
 		},
 	}
 }
@@ -685,31 +1027,6 @@ func ConfigDbgAddrs(cfg ConfigDebug) (dbgAddr, httpAddr, sshAddr string, err err
 // TODO ConfigToEnv(cfg any) (string, error) {
 // }
 
-// TODO dump SQL queries
-// // LogDB wraps a standard sql.DB or sql.Tx
-// type LogDB struct {
-//	DB *sql.DB
-// }
-//
-// func (l *LogDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-//	log.Printf("[DUMP] Exec: %s | Args: %v", query, args)
-//	return l.DB.ExecContext(ctx, query, args...)
-// }
-//
-// func (l *LogDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-//	log.Printf("[DUMP] Query: %s | Args: %v", query, args)
-//	return l.DB.QueryContext(ctx, query, args...)
-// }
-//
-// func (l *LogDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-//	log.Printf("[DUMP] QueryRow: %s | Args: %v", query, args)
-//	return l.DB.QueryRowContext(ctx, query, args...)
-// }
-//
-// // Usage:
-// // realDB, _ := sql.Open(...)
-// // queries := db.New(&LogDB{DB: realDB})
-
 // TODO config method
 func ConfigWebDBAddrs(cfg ConfigWeb) (base, agent, mach string) {
 	if cfg.DBPort == -1 {
@@ -811,6 +1128,27 @@ func (c *ConfigWeb) AgentURL() string {
 	return "http://" + c.Addr + "/agent"
 }
 
+// Translated returns the agent's texts for [locale], with fallbacks to less specific locales and the default texts.
+func (c *ConfigAgent) Translated(locale string) ConfigAgentTranslation {
+	ret := ConfigAgentTranslation{Locale: locale}
+	fallbacks := i18n.Fallbacks(locale, c.Locale)
+	for i := len(fallbacks) - 1; i >= 0; i-- {
+		for _, t := range c.Translations {
+			if i18n.Normalize(t.Locale) != fallbacks[i] {
+				continue
+			}
+			ret.Intro = cmp.Or(t.Intro, ret.Intro)
+			ret.IntroDash = cmp.Or(t.IntroDash, ret.IntroDash)
+			ret.Footer = cmp.Or(t.Footer, ret.Footer)
+		}
+	}
+	ret.Intro = cmp.Or(ret.Intro, c.Intro)
+	ret.IntroDash = cmp.Or(ret.IntroDash, c.IntroDash)
+	ret.Footer = cmp.Or(ret.Footer, c.Footer)
+
+	return ret
+}
+
 func (cfg *Config) DotEnv() string {
 	var sb strings.Builder
 
@@ -834,6 +1172,7 @@ func (cfg *Config) DotEnv() string {
 	writeEnv("INTRO", cfg.Agent.Intro)
 	writeEnv("INTRO_DASH", cfg.Agent.IntroDash)
 	writeEnv("FOOTER", cfg.Agent.Footer)
+	writeEnv("LOCALE", cfg.Agent.Locale)
 
 	writeEnv("LOG_FILE", cfg.Agent.Log.File)
 	writeEnv("LOG_PROMPTS", cfg.Agent.Log.Prompts)
@@ -844,6 +1183,43 @@ func (cfg *Config) DotEnv() string {
 	writeEnv("HISTORY_BACKEND", cfg.Agent.History.Backend)
 	writeEnv("HISTORY_MAX", cfg.Agent.History.Max)
 
+	writeEnv("STORIES_FILE", cfg.Agent.Stories.File)
+	writeEnv("STORIES_DEBOUNCE", cfg.Agent.Stories.Debounce)
+	writeEnv("STORIES_HIST_INTERVAL", cfg.Agent.Stories.HistInterval)
+
+	writeEnv("ORIENTING_ACCEPT", cfg.Agent.Orienting.Accept)
+	writeEnv("ORIENTING_CONFIRM", cfg.Agent.Orienting.Confirm)
+	writeEnv("ORIENTING_CANDIDATES", cfg.Agent.Orienting.Candidates)
+	writeEnv("ORIENTING_LOCAL", cfg.Agent.Orienting.Local)
+	writeEnv("ORIENTING_CACHE_TTL", cfg.Agent.Orienting.CacheTTL)
+
+	writeEnv("DB_BATCH_SIZE", cfg.Agent.DB.BatchSize)
+	writeEnv("DB_FLUSH_INTERVAL", cfg.Agent.DB.FlushInterval)
+	writeEnv("DB_RETRIES", cfg.Agent.DB.Retries)
+	writeEnv("DB_LOG", cfg.Agent.DB.Log)
+	writeEnv("DB_LOG_MACH", cfg.Agent.DB.LogMach)
+	writeEnv("DB_SLOW_QUERY", cfg.Agent.DB.SlowQuery)
+
+	writeEnv("TRANSCRIPT_RESTORE", cfg.Agent.Transcript.Restore)
+	writeEnv("TRANSCRIPT_FORMAT", cfg.Agent.Transcript.Format)
+	writeEnv("TRANSCRIPT_PROMPTS", cfg.Agent.Transcript.Prompts)
+
+	writeEnv("FACTS_EXTRACT", cfg.Agent.Facts.Extract)
+	writeEnv("FACTS_MIN_CERTAINTY", cfg.Agent.Facts.MinCertainty)
+	writeEnv("FACTS_RECALL", cfg.Agent.Facts.Recall)
+
+	writeEnv("RETENTION_INTERVAL", cfg.Agent.Retention.Interval)
+	writeEnv("RETENTION_PROMPTS_MAX_AGE", cfg.Agent.Retention.Prompts.MaxAge)
+	writeEnv("RETENTION_PROMPTS_MAX_COUNT", cfg.Agent.Retention.Prompts.MaxCount)
+	writeEnv("RETENTION_TRANSCRIPTS_MAX_AGE", cfg.Agent.Retention.Transcripts.MaxAge)
+	writeEnv("RETENTION_TRANSCRIPTS_MAX_COUNT", cfg.Agent.Retention.Transcripts.MaxCount)
+	writeEnv("RETENTION_HISTORY_MAX_AGE", cfg.Agent.Retention.History.MaxAge)
+	writeEnv("RETENTION_HISTORY_MAX_COUNT", cfg.Agent.Retention.History.MaxCount)
+	writeEnv("RETENTION_VALS_MAX_AGE", cfg.Agent.Retention.Vals.MaxAge)
+	writeEnv("RETENTION_VALS_MAX_COUNT", cfg.Agent.Retention.Vals.MaxCount)
+	writeEnv("RETENTION_COLLY_MAX_AGE", cfg.Agent.Retention.Colly.MaxAge)
+	writeEnv("RETENTION_COLLY_MAX_COUNT", cfg.Agent.Retention.Colly.MaxCount)
+
 	sb.WriteString("\n# ==========================================\n")
 	sb.WriteString("# WEB CONFIGURATION\n")
 	sb.WriteString("# ==========================================\n")
@@ -854,6 +1230,9 @@ func (cfg *Config) DotEnv() string {
 	writeEnv("WEB_AGENTUI_REPL_ADDR", cfg.Web.REPLAddrAgentUI())
 	writeEnv("WEB_DB_PORT", cfg.Web.DBPort)
 	writeEnv("WEB_LOG_PORT", cfg.Web.LogPort)
+	writeEnv("WEB_CHAT_API", cfg.Web.ChatAPI)
+	writeEnv("WEB_CHAT_TIMEOUT", cfg.Web.ChatTimeout)
+	writeEnv("WEB_CHAT_SESSION_TTL", cfg.Web.ChatSessionTTL)
 
 	sb.WriteString("\n# ==========================================\n")
 	sb.WriteString("# TUI CONFIGURATION\n")
@@ -864,11 +1243,19 @@ func (cfg *Config) DotEnv() string {
 	writeEnv("TUI_PORT_WEB", cfg.TUI.PortWeb)
 	writeEnv("TUI_CLOCK_RANGE", cfg.TUI.ClockRange)
 
+	sb.WriteString("\n# ==========================================\n")
+	sb.WriteString("# MCP CONFIGURATION\n")
+	sb.WriteString("# ==========================================\n")
+	writeEnv("MCP_ADDR", cfg.MCP.Addr)
+	writeEnv("MCP_REPLY_TIMEOUT", cfg.MCP.ReplyTimeout)
+
 	sb.WriteString("\n# ==========================================\n")
 	sb.WriteString("# TOOLS CONFIGURATION\n")
 	sb.WriteString("# ==========================================\n")
 	writeEnv("TOOLS_SEARXNG_PORT", cfg.Tools.SearXNG.Port)
 	writeEnv("TOOLS_SEARXNG_URL", cfg.Tools.SearXNG.URL)
+	writeEnv("TOOLS_HISTORY_WINDOW", cfg.Tools.History.Window)
+	writeEnv("TOOLS_HISTORY_LIMIT", cfg.Tools.History.Limit)
 
 	sb.WriteString("\n# ==========================================\n")
 	sb.WriteString("# DEBUG CONFIGURATION\n")
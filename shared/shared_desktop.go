@@ -5,6 +5,7 @@ package shared
 import (
 	"context"
 	"database/sql"
+	"io"
 	"io/fs"
 	"log/slog"
 	"strings"
@@ -46,15 +47,26 @@ type A struct {
 	StatesList []string     `log:"states_list"`
 	// ActivateList is a list of booleans for StatesList, indicating an active state at the given index.
 	ActivateList []bool `log:"activate_list"`
-	ConfigAI     *ConfigAI
-	ClockDiff    [][]int
+	// Trigger is the cause of a change, eg a trigger state or "manual".
+	Trigger string `log:"trigger"`
+	// Locale overrides the agent's locale for the current session.
+	Locale    string `log:"locale"`
+	ConfigAI  *ConfigAI
+	ClockDiff [][]int
+	// RewindTo is the machine time sum of a transition to rewind to.
+	RewindTo uint64 `log:"rewind_to"`
+	// RewindBefore is a state to rewind before its latest activation.
+	RewindBefore string `log:"rewind_before"`
+	// Rewind is the point the agent has been rewound to.
+	Rewind *RewindPoint
 
 	// non-RPC fields
 
 	// Result is a buffered channel to be closed by the receiver
 	ResultCh chan<- am.Result
-	// DBQuery is a function that executes a query on the database.
-	DBQuery func(ctx context.Context) error
+	// DBQuery is a function that executes queries on the base DB, within a batch transaction (eg via
+	// sqlc.New(agent.DBTX(tx)), which also logs them).
+	DBQuery func(ctx context.Context, tx *sql.Tx) error
 	// RetStr returns dereferenced user prompts based on the list of offer.
 	RetOfferRef chan<- *OfferRef
 	SSHServer   *ssh.Server
@@ -82,6 +94,8 @@ type AgentBaseAPI interface {
 	AgentImpl() AgentAPI
 	// Output outputs text to the user.
 	Output(txt string, from From) am.Result
+	// OutputPrompt outputs text produced by the prompt of [ref].
+	OutputPrompt(txt string, from From, ref *PromptRef) am.Result
 
 	Mach() *am.Machine
 	DBG() *debugger.Debugger
@@ -99,6 +113,27 @@ type AgentBaseAPI interface {
 	Store() *AgentStore
 
 	QueriesBase() *sqlc.Queries
+	// DBTX wraps a DB or a transaction with query logging and timing.
+	DBTX(conn DBTX) DBTX
+	DBStats() *DBStats
+	StoryHistory
+	// SessionID is a random ID of this agent's run.
+	SessionID() string
+	// Locale is the session's locale, defaults to the configured one.
+	Locale() string
+	// Transcript returns persisted messages created since [since], oldest first. Zero [since] means the displayed
+	// messages.
+	Transcript(ctx context.Context, since time.Time) ([]*Msg, error)
+	// RestoreMsgs returns the latest messages of previous sessions, oldest first.
+	RestoreMsgs(ctx context.Context) ([]*Msg, error)
+	// RewindFind resolves a point in history, see [A.RewindTo] and [A.RewindBefore].
+	RewindFind(ctx context.Context, to uint64, before string) (*RewindPoint, error)
+	// SaveSnapshot persists a snapshot of this session, used to resume it after a restart.
+	SaveSnapshot(e *am.Event, snap *Snapshot)
+	// PrevSnapshot returns the latest snapshot of a previous session, or nil.
+	PrevSnapshot(ctx context.Context) (*Snapshot, error)
+	// ExportBundle writes the agent's dir as a session bundle. [cfg] is the full config, defaults to ConfigBase.
+	ExportBundle(ctx context.Context, w io.Writer, cfg any) error
 
 	DBBase() *sql.DB
 	DBHistory() *sql.DB
@@ -128,6 +163,8 @@ type AgentAPI interface {
 	OrientingMoves() map[string]string
 	// HistoryStates returns a list of states to track in the history.
 	HistoryStates() am.S
+	// RewindStates returns a list of tracked states which can be deactivated by a rewind.
+	RewindStates() am.S
 }
 
 type OpenAIClient struct {
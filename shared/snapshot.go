@@ -0,0 +1,123 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+)
+
+// Snapshot is a persisted state of an agent's session, used to resume it after a restart.
+type Snapshot struct {
+	SessionID string
+	CreatedAt time.Time
+	// Machs are snapshots of the agent's machines, eg the agent and its memory.
+	Machs []*MachSnapshot
+	// Values are agent-specific values, eg the chosen recipe.
+	Values map[string]json.RawMessage
+}
+
+// Mach returns the snapshot of the machine [id], or nil.
+func (s *Snapshot) Mach(id string) *MachSnapshot {
+	for _, m := range s.Machs {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// SetValue marshals [val] under [key].
+func (s *Snapshot) SetValue(key string, val any) error {
+	raw, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if s.Values == nil {
+		s.Values = map[string]json.RawMessage{}
+	}
+	s.Values[key] = raw
+
+	return nil
+}
+
+// Value unmarshals the value under [key] into [val]. Returns false when missing.
+func (s *Snapshot) Value(key string, val any) (bool, error) {
+	raw, ok := s.Values[key]
+	if !ok || string(raw) == "null" {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(raw, val)
+}
+
+// MachSnapshot is a persisted state of a single machine.
+type MachSnapshot struct {
+	ID string
+	// Schema is the full schema, including dynamically merged states.
+	Schema am.Schema
+	// States are the ordered state names.
+	States am.S
+	Active am.S
+	Clock  am.Clock
+}
+
+// Is1 returns true when [state] was active.
+func (s *MachSnapshot) Is1(state string) bool {
+	return s != nil && am.IsActiveTick(s.Clock[state])
+}
+
+// SnapshotMach captures the active states, clocks and the schema of [mach].
+func SnapshotMach(mach *am.Machine) *MachSnapshot {
+	return &MachSnapshot{
+		ID:     mach.Id(),
+		Schema: mach.Schema(),
+		States: mach.StateNames(),
+		Active: mach.ActiveStates(nil),
+		Clock:  mach.Clock(nil),
+	}
+}
+
+// RestoreMach merges the snapshot's schema into [mach] and imports its active states and clocks. Handlers aren't
+// executed, so it's meant for handler-less machines (eg the memory), which haven't been used yet.
+func RestoreMach(mach *am.Machine, snap *MachSnapshot) error {
+	if snap == nil {
+		return nil
+	}
+
+	// merge dynamic states
+	schema := mach.Schema()
+	names := mach.StateNames()
+	for _, name := range snap.States {
+		if _, ok := schema[name]; ok {
+			continue
+		}
+		state, ok := snap.Schema[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", am.ErrStateMissing, name)
+		}
+		schema[name] = state
+		names = append(names, name)
+	}
+	if len(names) > len(mach.StateNames()) {
+		if err := mach.SetSchema(schema, names); err != nil {
+			return err
+		}
+	}
+
+	// import the time in the current order, unknown states stay inactive
+	names = mach.StateNames()
+	t := make(am.Time, len(names))
+	for i, name := range names {
+		t[i] = snap.Clock[name]
+	}
+
+	return mach.Import(&am.Serialized{
+		ID:          mach.Id(),
+		StateNames:  names,
+		Time:        t,
+		MachineTick: mach.MachineTick(),
+	})
+}
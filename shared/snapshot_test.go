@@ -0,0 +1,70 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	schema := am.Schema{"A": {}, "B": {}}
+
+	// source machine with a dynamic state
+	src := am.New(ctx, schema, &am.Opts{Id: "mem"})
+	if err := src.VerifyStates(am.S{"A", "B", am.StateException}); err != nil {
+		t.Fatal(err)
+	}
+	s2 := src.Schema()
+	s2["StepFoo"] = am.State{Require: am.S{"A"}}
+	if err := src.SetSchema(s2, am.S{"A", "B", am.StateException, "StepFoo"}); err != nil {
+		t.Fatal(err)
+	}
+	src.Add1("A", nil)
+	src.Add1("StepFoo", nil)
+	src.Add1("B", nil)
+	src.Remove1("B", nil)
+
+	// encode
+	snap := &Snapshot{Machs: []*MachSnapshot{SnapshotMach(src)}}
+	if err := snap.SetValue("recipe", map[string]string{"Name": "soup"}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap = &Snapshot{}
+	if err := json.Unmarshal(raw, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore into a fresh machine
+	dst := am.New(ctx, schema, &am.Opts{Id: "mem"})
+	if err := dst.VerifyStates(am.S{"A", "B", am.StateException}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreMach(dst, snap.Mach("mem")); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.Has1("StepFoo") || !dst.Is(am.S{"A", "StepFoo"}) || dst.Is1("B") {
+		t.Fatalf("unexpected states: %s", dst.ActiveStates(nil))
+	}
+	if dst.Tick("B") != 2 {
+		t.Fatalf("unexpected clock: %d", dst.Tick("B"))
+	}
+	if !snap.Mach("mem").Is1("StepFoo") {
+		t.Fatal("StepFoo not active in the snapshot")
+	}
+
+	var recipe map[string]string
+	ok, err := snap.Value("recipe", &recipe)
+	if err != nil || !ok || recipe["Name"] != "soup" {
+		t.Fatalf("unexpected value: %v %v", recipe, err)
+	}
+	if ok, _ := snap.Value("missing", &recipe); ok {
+		t.Fatal("missing value found")
+	}
+}
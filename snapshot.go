@@ -0,0 +1,83 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/db/sqlc"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// SNAPSHOTS
+
+// ///// ///// /////
+
+// SaveSnapshot persists [snap] as the snapshot of this session, replacing the previous one. The agent's machine is
+// always included.
+func (a *AgentBase) SaveSnapshot(e *am.Event, snap *shared.Snapshot) {
+	mach := a.Mach()
+	snap.SessionID = a.sessionID
+	snap.CreatedAt = time.Now()
+	if snap.Mach(mach.Id()) == nil {
+		snap.Machs = append([]*shared.MachSnapshot{shared.SnapshotMach(mach)}, snap.Machs...)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		mach.EvAddErr(e, err, nil)
+		return
+	}
+
+	mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			return sqlc.New(a.DBTX(tx)).SaveSnapshot(ctx, sqlc.SaveSnapshotParams{
+				SessionID: snap.SessionID,
+				Agent:     mach.Id(),
+				Data:      string(data),
+				CreatedAt: snap.CreatedAt,
+			})
+		},
+	}))
+}
+
+// PrevSnapshot returns the latest snapshot of a previous session, or nil.
+func (a *AgentBase) PrevSnapshot(ctx context.Context) (*shared.Snapshot, error) {
+	if a.DbConn == nil {
+		return nil, ErrDBNil
+	}
+
+	row, err := a.QueriesBase().GetSnapshotPrev(ctx, sqlc.GetSnapshotPrevParams{
+		Agent:     a.Mach().Id(),
+		SessionID: a.sessionID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret := &shared.Snapshot{}
+	if err := json.Unmarshal([]byte(row.Data), ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// DeleteSnapshots removes all the snapshots of this agent, including the current session.
+func (a *AgentBase) DeleteSnapshots(ctx context.Context) error {
+	if a.DbConn == nil {
+		return ErrDBNil
+	}
+	if err := a.dbFlush(ctx); err != nil {
+		return err
+	}
+
+	return a.QueriesBase().DeleteSnapshots(ctx, a.Mach().Id())
+}
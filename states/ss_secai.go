@@ -49,7 +49,9 @@ type AgentBaseStatesDef struct {
 	BaseDBStarting string
 	BaseDBReady    string
 	// BaseDBSaving is lazy query execution.
-	BaseDBSaving      string
+	BaseDBSaving string
+	// BaseDBClosing flushes the queued queries and closes the base DB, after BaseDBReady.
+	BaseDBClosing     string
 	DBStarting        string
 	DBReady           string
 	HistoryDBStarting string
@@ -65,6 +67,10 @@ type AgentBaseStatesDef struct {
 	Interrupted string
 	// Resume is the signal from the user to resume after an Interrupted.
 	Resume string
+	// Rewind reverts the agent to a previous point in its history, eg to undo a wrong turn.
+	Rewind string
+	// Rewound is when the agent has been reverted to a previous point, passed as an arg.
+	Rewound string
 
 	// STORIES
 
@@ -83,7 +89,7 @@ type AgentBaseStatesDef struct {
 	UIButtonSend string
 	// UI button "Interrupt" has been pressed
 	UIButtonInter string
-	// TODO
+	// UISaveOutput exports the transcript into the agent's dir.
 	UISaveOutput  string
 	UICleanOutput string
 	// UIMsg will output the passed text into the UI.
@@ -111,6 +117,12 @@ type AgentBaseStatesDef struct {
 	RemoteDashReady string
 	RemoteUIReady   string
 
+	// MCP
+
+	MCPStarting string
+	// MCP server listening (HTTP)
+	MCPReady string
+
 	// DEBUG
 
 	// embedded am-dbg running
@@ -220,7 +232,8 @@ var AgentSchema = SchemaMerge(
 		ssA.BaseDBReady: {
 			Remove: S{ssA.BaseDBStarting},
 		},
-		ssA.BaseDBSaving: {Multi: true},
+		ssA.BaseDBSaving:  {Multi: true},
+		ssA.BaseDBClosing: {},
 		ssA.DBStarting: {
 			Require: S{ssA.Start},
 			Remove:  S{ssA.DBReady},
@@ -250,6 +263,13 @@ var AgentSchema = SchemaMerge(
 		ssA.Resume: {
 			Remove: S{ssA.Interrupted},
 		},
+		ssA.Rewind: {
+			Require: S{ssA.Start, ssA.HistoryDBReady},
+		},
+		ssA.Rewound: {
+			Multi:   true,
+			Require: S{ssA.Start},
+		},
 		ssA.UIMsg: {
 			Multi:   true,
 			Require: S{ssA.Start},
@@ -272,7 +292,10 @@ var AgentSchema = SchemaMerge(
 		ssA.UIReady:       {Require: S{ssA.UIMode}},
 		ssA.UIButtonSend:  {Require: S{ssA.UIMode}},
 		ssA.UIButtonInter: {Require: S{ssA.UIMode}},
-		ssA.UISaveOutput:  {Require: S{ssA.UIMode}},
+		ssA.UISaveOutput: {
+			Multi:   true,
+			Require: S{ssA.UIMode},
+		},
 		ssA.UICleanOutput: {
 			Multi:   true,
 			Require: S{ssA.UIMode},
@@ -327,6 +350,17 @@ var AgentSchema = SchemaMerge(
 			Multi:   true,
 			Require: S{ssA.WebHTTPReady},
 		},
+
+		// MCP
+
+		ssA.MCPStarting: {
+			Require: S{ssA.Start},
+			Remove:  S{ssA.MCPReady},
+		},
+		ssA.MCPReady: {
+			Require: S{ssA.Start},
+			Remove:  S{ssA.MCPStarting},
+		},
 	})
 
 // EXPORTS AND GROUPS
@@ -0,0 +1,839 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/sblinch/kdl-go"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pancsta/secai/db/sqlc"
+	"github.com/pancsta/secai/shared"
+)
+
+// ///// ///// /////
+
+// ///// STORIES
+
+// ///// ///// /////
+
+// StoriesBind subscribes to the triggers of all the stories via When methods of the actors' machines, and schedules
+// a check. Call it again after replacing an actor's machine or changing its schema (eg the memory). Requires Start.
+func (a *AgentBase) StoriesBind() {
+	mach := a.Mach()
+	a.storiesMx.Lock()
+	defer a.storiesMx.Unlock()
+	if a.storiesCancel != nil {
+		a.storiesCancel()
+	}
+	ctx, cancel := context.WithCancel(mach.NewStateCtx(ss.Start))
+	a.storiesCancel = cancel
+	if ctx.Err() != nil {
+		return // expired
+	}
+
+	// subscribe to each tracked state only once per machine
+	watched := map[string]struct{}{}
+	hasHist := false
+	for _, info := range a.agentImpl.Stories() {
+		s := a.agentImpl.Story(info.State)
+		if s == nil {
+			continue
+		}
+		s.History = a
+
+		for _, actor := range []*shared.StoryActor{&s.Agent, &s.Memory} {
+			if actor.Mach != nil && len(actor.HistTriggers) > 0 {
+				hasHist = true
+			}
+			if actor.Mach == nil || actor.Trigger.IsEmpty() {
+				continue
+			}
+
+			for _, state := range condStates(actor.Trigger) {
+				key := actor.Mach.Id() + "/" + state
+				if _, ok := watched[key]; ok {
+					continue
+				}
+				// dynamic states may appear later
+				if !actor.Mach.Has1(state) {
+					if a.storyDebug(s.State) {
+						a.Log("trigger state missing", "story", s.State, "state", state)
+					}
+					continue
+				}
+
+				watched[key] = struct{}{}
+				go a.storiesWatch(ctx, actor.Mach, state)
+			}
+		}
+	}
+
+	// time-based triggers need polling
+	if hasHist {
+		go a.storiesHistPoll(ctx)
+	}
+
+	a.StoriesCheck()
+}
+
+// StoriesCheck schedules a debounced [schema.AgentBaseStatesDef.CheckStories].
+func (a *AgentBase) StoriesCheck() {
+	if !a.storiesPending.CompareAndSwap(false, true) {
+		return
+	}
+
+	time.AfterFunc(a.cfg.Agent.Stories.Debounce, func() {
+		a.storiesPending.Store(false)
+		// query the history outside of handlers
+		a.storiesHistCheck()
+		a.Mach().Add1(ss.CheckStories, nil)
+	})
+}
+
+func (a *AgentBase) storiesWatch(ctx context.Context, mach *am.Machine, state string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return // expired
+		case <-mach.WhenTicks(state, 1, ctx):
+			if ctx.Err() != nil || mach.IsDisposed() {
+				return // expired
+			}
+			a.storiesCause.Store(state)
+			a.StoriesCheck()
+		}
+	}
+}
+
+func (a *AgentBase) storiesHistPoll(ctx context.Context) {
+	interval := a.cfg.Agent.Stories.HistInterval
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return // expired
+		case <-t.C:
+			a.storiesCause.Store("history")
+			a.StoriesCheck()
+		}
+	}
+}
+
+// storiesHistCheck evaluates [shared.HistTrigger] of all the stories and stores the results for
+// [AgentBase.CheckStoriesState].
+func (a *AgentBase) storiesHistCheck() {
+	ctx := a.Mach().NewStateCtx(ss.Start)
+	if ctx.Err() != nil {
+		return // expired
+	}
+	hist, errHist := a.Hist()
+	if errHist == nil {
+		errHist = hist.Sync()
+	}
+
+	ret := map[string]bool{}
+	for _, info := range a.agentImpl.Stories() {
+		s := a.agentImpl.Story(info.State)
+		if s == nil || len(s.Agent.HistTriggers)+len(s.Memory.HistTriggers) == 0 {
+			continue
+		}
+		isDebug := a.storyDebug(s.State)
+
+		pass := errHist == nil
+		for _, actor := range []*shared.StoryActor{&s.Agent, &s.Memory} {
+			for _, t := range actor.HistTriggers {
+				if !pass {
+					break
+				}
+				var err error
+				pass, err = a.histTriggerCheck(ctx, hist, actor.Mach, t)
+				if err != nil {
+					a.Log("history trigger failed", "story", s.State, "err", err)
+				}
+				if isDebug {
+					a.Log("history", "trigger", t.String(), "check", pass)
+				}
+			}
+		}
+		ret[s.State] = pass
+	}
+
+	a.storiesHist.Store(&ret)
+}
+
+// histTriggerCheck evaluates a single [shared.HistTrigger] for [mach].
+func (a *AgentBase) histTriggerCheck(
+	ctx context.Context, hist amhist.MemoryApi, mach *am.Machine, t shared.HistTrigger,
+) (bool, error) {
+	if mach == nil || hist.Machine().Id() != mach.Id() {
+		return false, fmt.Errorf("%w: no history for %s", ErrHistNil, t.State)
+	}
+	if !hist.IsTracked1(t.State) {
+		return false, fmt.Errorf("%w: %s not tracked", am.ErrStateMissing, t.State)
+	}
+	now := time.Now()
+	uptime := now.Sub(a.startedAt)
+
+	if t.ActiveFor > 0 {
+		if mach.Not1(t.State) || uptime < t.ActiveFor {
+			return false, nil
+		}
+		count, err := histActivations(ctx, hist, t.State, now.Add(-t.ActiveFor))
+		if err != nil || count > 0 {
+			return false, err
+		}
+	}
+
+	if t.IdleFor > 0 {
+		if uptime < t.IdleFor {
+			return false, nil
+		}
+		count, err := histActivations(ctx, hist, t.State, now.Add(-t.IdleFor))
+		if err != nil || count > 0 {
+			return false, err
+		}
+	}
+
+	if t.Activations > 0 {
+		count, err := histActivations(ctx, hist, t.State, now.Add(-t.Window))
+		if err != nil || count < t.Activations {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// histActivations counts the activations of [state] since [since].
+func histActivations(ctx context.Context, hist amhist.MemoryApi, state string, since time.Time) (int, error) {
+	recs, err := hist.FindLatest(ctx, false, 0, amhist.Query{
+		Start: amhist.ConditionTime{HTime: since},
+		End:   amhist.ConditionTime{HTime: time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	idx := hist.Index1(state)
+	count := 0
+	for _, r := range recs {
+		t := r.Time
+		if t == nil || idx < 0 || idx >= len(t.MTimeTracked) || idx >= len(t.MTimeTrackedDiff) {
+			continue
+		}
+		if am.IsActiveTick(t.MTimeTracked[idx]) && t.MTimeTrackedDiff[idx] > 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// storyDebug returns true for stories listed in [shared.ConfigDebug.Story] or [shared.EnvDebugStory], with or without
+// the "Story" prefix.
+func (a *AgentBase) storyDebug(state string) bool {
+	short, _ := strings.CutPrefix(state, "Story")
+	list := slices.Concat(a.cfg.Debug.Story, strings.Split(os.Getenv(shared.EnvDebugStory), ","))
+
+	return slices.Contains(list, state) || slices.Contains(list, short)
+}
+
+// condStates returns all the states referenced by [cond].
+func condStates(cond amhelp.Cond) am.S {
+	ret := slices.Concat(cond.Is, cond.Not, cond.Any1)
+	for _, group := range cond.Any {
+		ret = append(ret, group...)
+	}
+	for state := range cond.Clock {
+		ret = append(ret, state)
+	}
+
+	return slices.Compact(slices.Sorted(slices.Values(ret)))
+}
+
+//
+
+// HANDLERS
+
+//
+
+func (a *AgentBase) CheckStoriesState(e *am.Event) {
+	mach := a.Mach()
+	cause, _ := a.storiesCause.Swap("").(string)
+	if cause == "" {
+		cause = ss.CheckStories
+	}
+	var histRes map[string]bool
+	if res := a.storiesHist.Load(); res != nil {
+		histRes = *res
+	}
+
+	var stateList S
+	var activateList []bool
+	for _, info := range a.agentImpl.Stories() {
+		s := a.agentImpl.Story(info.State)
+		if s == nil {
+			continue
+		}
+		isDebug := a.storyDebug(s.State)
+		if isDebug {
+			a.Log("checking", "story", s.State)
+		}
+
+		// validate
+		if !mach.Has1(s.State) {
+			mach.EvAddErr(e, fmt.Errorf("%w: %s", am.ErrStateMissing, s.State), nil)
+			continue
+		}
+
+		s.Tick = mach.Tick(s.State)
+		// this story should be active
+		activate := false
+		// this story has automatic triggers
+		hasTriggers := false
+
+		// dont activate without passing triggers
+
+		// check the agent machine
+		if !s.Agent.Trigger.IsEmpty() {
+			activate = s.Agent.Trigger.Check(s.Agent.Mach)
+			if isDebug {
+				a.Log("agent", "check", activate)
+			}
+			hasTriggers = true
+		}
+
+		// check the memory machine
+		if !s.Memory.Trigger.IsEmpty() {
+			check := s.Memory.Trigger.Check(s.Memory.Mach)
+			activate = (activate || !hasTriggers) && check
+			if isDebug {
+				a.Log("memory", "check", check)
+			}
+			hasTriggers = true
+		}
+
+		// check the history (evaluated by [AgentBase.StoriesCheck])
+		if len(s.Agent.HistTriggers)+len(s.Memory.HistTriggers) > 0 {
+			check := histRes[s.State]
+			activate = (activate || !hasTriggers) && check
+			if isDebug {
+				a.Log("history", "check", check)
+			}
+			hasTriggers = true
+		}
+
+		// manual story
+		if !hasTriggers {
+			if isDebug {
+				a.Log("no triggers", "story", s.State)
+			}
+			continue
+		}
+
+		// confirm the activation
+		if activate && mach.Not1(s.State) && !s.Check() {
+			if isDebug {
+				a.Log("can't activate", "story", s.State)
+			}
+			continue
+		}
+
+		// add to the list after a passed "impossibility check"
+		if mach.Is1(s.State) && !activate && !amhelp.CantRemove1(mach, s.State, nil) ||
+			mach.Not1(s.State) && activate && !amhelp.CantAdd1(mach, s.State, nil) {
+
+			if isDebug {
+				a.Log("story changed", "story", s.State)
+			}
+			stateList = append(stateList, s.State)
+			activateList = append(activateList, activate)
+		}
+	}
+
+	// apply the changes if any
+	if len(stateList) > 0 {
+		mach.EvAdd1(e, ss.StoryChanged, Pass(&A{
+			StatesList:   stateList,
+			ActivateList: activateList,
+			Trigger:      cause,
+		}))
+	}
+}
+
+func (a *AgentBase) StoryChangedState(e *am.Event) {
+	mach := a.Mach()
+	args := ParseArgs(e.Args)
+	activates := args.ActivateList
+
+	for i, name := range args.StatesList {
+		activate := activates[i]
+		s := a.agentImpl.Story(name)
+		if s == nil {
+			a.Log("story not found", "state", name)
+			continue
+		}
+
+		// deactivate
+		if mach.Is1(s.State) && !activate {
+			res := mach.EvRemove1(e, s.State, nil)
+
+			// TODO handle Queued?
+			if res != am.Canceled {
+				s.Agent.TimeDeactivated = mach.Time(nil)
+				if s.Memory.Mach != nil {
+					s.Memory.TimeDeactivated = s.Memory.Mach.Time(nil)
+				}
+				s.DeactivatedAt = time.Now()
+				s.LastActiveTicks = s.Agent.TimeDeactivated.Sum(nil) - s.Agent.TimeActivated.Sum(nil)
+				a.storySave(e, s, false, args.Trigger)
+			}
+
+			// activate
+		} else if mach.Not1(s.State) && activate {
+			res := mach.EvAdd1(e, s.State, nil)
+
+			// TODO handle Queued?
+			if res != am.Canceled {
+				s.Agent.TimeActivated = mach.Time(nil)
+				if s.Memory.Mach != nil {
+					s.Memory.TimeActivated = s.Memory.Mach.Time(nil)
+				}
+				s.ActivatedAt = time.Now()
+				a.storySave(e, s, true, args.Trigger)
+			} else {
+				a.Log("failed to activate", "state", name)
+			}
+		}
+	}
+}
+
+// ///// ///// /////
+
+// ///// HISTORY
+
+// ///// ///// /////
+
+// storySave persists an activation or deactivation of [s] via [schema.AgentBaseStatesDef.BaseDBSaving].
+func (a *AgentBase) storySave(e *am.Event, s *shared.Story, active bool, cause string) {
+	mach := a.Mach()
+	if cause == "" {
+		cause = "manual"
+	}
+	ev := sqlc.AddStoryEventParams{
+		SessionID:   a.sessionID,
+		Agent:       mach.Id(),
+		State:       s.State,
+		Cause:       cause,
+		CreatedAt:   time.Now(),
+		MachTimeSum: int64(mach.Time(nil).Sum(nil)),
+		MachTime:    fmt.Sprintf("%v", mach.Time(nil)),
+	}
+	if active {
+		ev.Active = 1
+	} else {
+		// stories active since the start or a restore have no activation time, keep the duration unknown (0)
+		if !s.ActivatedAt.IsZero() {
+			ev.ActiveMs = s.DeactivatedAt.Sub(s.ActivatedAt).Milliseconds()
+		}
+		ev.ActiveTicks = int64(s.LastActiveTicks)
+	}
+	if s.Memory.Mach != nil {
+		ev.MemTimeSum = int64(s.Memory.Mach.Time(nil).Sum(nil))
+	}
+
+	mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := sqlc.New(a.DBTX(tx)).AddStoryEvent(ctx, ev)
+			return err
+		},
+	}))
+}
+
+// StoryEvents returns the latest persisted events of [state], or of all the stories when empty. Newest first.
+func (a *AgentBase) StoryEvents(ctx context.Context, state string, limit int) ([]shared.StoryEvent, error) {
+	if a.DbConn == nil {
+		return nil, ErrDBNil
+	}
+	q := a.QueriesBase()
+
+	var rows []sqlc.StoryEvent
+	var err error
+	if state == "" {
+		rows, err = q.ListStoryEvents(ctx, int64(limit))
+	} else {
+		rows, err = q.ListStoryEventsByState(ctx, sqlc.ListStoryEventsByStateParams{
+			State: state,
+			Limit: int64(limit),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]shared.StoryEvent, len(rows))
+	for i, r := range rows {
+		ret[i] = shared.StoryEvent{
+			SessionID:   r.SessionID,
+			State:       r.State,
+			Active:      r.Active != 0,
+			Cause:       r.Cause,
+			ActiveMs:    r.ActiveMs,
+			ActiveTicks: r.ActiveTicks,
+			CreatedAt:   r.CreatedAt,
+			MachTimeSum: uint64(r.MachTimeSum),
+		}
+	}
+
+	return ret, nil
+}
+
+// StoryStats returns the stats of past runs of [state], eg the average duration and preceding stories.
+func (a *AgentBase) StoryStats(ctx context.Context, state string) (*shared.StoryStats, error) {
+	if a.DbConn == nil {
+		return nil, ErrDBNil
+	}
+	q := a.QueriesBase()
+
+	row, err := q.GetStoryStats(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	ret := &shared.StoryStats{
+		State:     state,
+		Runs:      int(row.Runs),
+		AvgMs:     row.AvgMs,
+		MaxMs:     row.MaxMs,
+		TotalMs:   row.TotalMs,
+		Preceding: map[string]int{},
+	}
+
+	prev, err := q.ListStoryPreceding(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range prev {
+		ret.Preceding[p.State] = int(p.Count)
+	}
+
+	last, err := a.StoryEvents(ctx, state, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(last) > 0 {
+		ret.Last = &last[0]
+	}
+
+	return ret, nil
+}
+
+// ///// ///// /////
+
+// ///// DEFINITIONS
+
+// ///// ///// /////
+
+// StoriesDef is a declarative definition of stories, loaded from [shared.ConfigAgentStories.File] or
+// "stories.kdl" / "stories.yaml" in the agent's dir.
+type StoriesDef struct {
+	Stories []StoryDef `kdl:"Story,multiple" yaml:"stories"`
+}
+
+// StoryDef is a declarative version of [shared.Story].
+type StoryDef struct {
+	// State is the name of the bound state, which has to exist in the agent's schema.
+	State string `yaml:"state"`
+	Title string `yaml:"title"`
+	Desc  string `yaml:"desc"`
+	// Agent triggers on the agent's machine.
+	Agent *CondDef `yaml:"agent"`
+	// Memory triggers on the memory machine.
+	Memory *CondDef `yaml:"memory"`
+	// Hist are pro-active triggers on the agent's history.
+	Hist    []shared.HistTrigger `kdl:"Hist,multiple" yaml:"hist"`
+	Actions []ActionDef          `kdl:"Action,multiple" yaml:"actions"`
+}
+
+// ActionDef is a declarative version of [shared.Action].
+type ActionDef struct {
+	Label    string `yaml:"label"`
+	LabelEnd string `yaml:"labelEnd"`
+	Desc     string `yaml:"desc"`
+	// StateAdd is added on click (stories are activated via StoryChanged).
+	StateAdd string `yaml:"stateAdd"`
+	// StateRemove is removed on click (stories are deactivated via StoryChanged).
+	StateRemove  string    `yaml:"stateRemove"`
+	VisibleAgent *CondDef  `yaml:"visibleAgent"`
+	VisibleMem   *CondDef  `yaml:"visibleMem"`
+	DisabledWhen *CondDef  `yaml:"disabledWhen"`
+	Progress     *Progress `yaml:"progress"`
+}
+
+// CondDef is a declarative version of [amhelp.Cond].
+type CondDef struct {
+	// all of these have to be active
+	Is []string `yaml:"is"`
+	// any of these has to be active
+	Any []string `yaml:"any"`
+	// none of these can be active
+	Not []string `yaml:"not"`
+}
+
+func (c *CondDef) Cond() amhelp.Cond {
+	if c == nil {
+		return amhelp.Cond{}
+	}
+
+	// empty lists break [amhelp.Cond.IsEmpty]
+	nilEmpty := func(states S) S {
+		if len(states) == 0 {
+			return nil
+		}
+		return states
+	}
+
+	return amhelp.Cond{Is: nilEmpty(c.Is), Any1: nilEmpty(c.Any), Not: nilEmpty(c.Not)}
+}
+
+func (c *CondDef) states() S {
+	if c == nil {
+		return nil
+	}
+
+	return slices.Concat(c.Is, c.Any, c.Not)
+}
+
+// Progress is the amount of active states from a state group (or a list) of the agent's machine, or the memory.
+type Progress struct {
+	// Group is a name of a state group, eg "BootGen".
+	Group string `yaml:"group"`
+	// States is a list of states, used instead of Group.
+	States []string `yaml:"states"`
+	// Mem counts states of the memory machine.
+	Mem bool `yaml:"mem"`
+	// Max overrides the length of the group.
+	Max int `yaml:"max"`
+}
+
+// StoriesLoad loads declarative stories (if any), validates them against the agent's and memory's schemas, and merges
+// them into [stories]. Existing stories get their non-empty fields overridden and new actions appended. Returns names
+// of new stories.
+func (a *AgentBase) StoriesLoad(stories map[string]*shared.Story) (S, error) {
+	def, err := a.storiesRead()
+	if def == nil || err != nil {
+		return nil, err
+	}
+
+	// validate
+	mach := a.Mach()
+	mem := a.agentImpl.MachMem()
+	var errs []error
+	for _, s := range def.Stories {
+		errs = append(errs, a.storyDefValidate(mach, mem, &s))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// merge
+	var added S
+	for _, d := range def.Stories {
+		s, ok := stories[d.State]
+		if !ok {
+			s = &shared.Story{StoryInfo: shared.StoryInfo{State: d.State}}
+			stories[d.State] = s
+			added = append(added, d.State)
+		}
+		if d.Title != "" {
+			s.Title = d.Title
+		}
+		if d.Desc != "" {
+			s.Desc = d.Desc
+		}
+		if d.Agent != nil {
+			s.Agent.Trigger = d.Agent.Cond()
+		}
+		if d.Memory != nil {
+			s.Memory.Trigger = d.Memory.Cond()
+		}
+		if len(d.Hist) > 0 {
+			s.Agent.HistTriggers = d.Hist
+		}
+		for _, act := range d.Actions {
+			s.Actions = append(s.Actions, a.storyActionNew(act))
+		}
+		s.Agent.Mach = mach
+		s.Memory.Mach = mem
+	}
+	a.Log("stories loaded", "amount", len(def.Stories), "new", added)
+
+	return added, nil
+}
+
+func (a *AgentBase) storiesRead() (*StoriesDef, error) {
+	files := []string{a.cfg.Agent.Stories.File}
+	if files[0] == "" {
+		dir := a.cfg.Agent.Dir
+		files = []string{
+			filepath.Join(dir, "stories.kdl"), filepath.Join(dir, "stories.yaml"), filepath.Join(dir, "stories.yml"),
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		def := &StoriesDef{}
+		if filepath.Ext(file) == ".kdl" {
+			err = kdl.Unmarshal(data, def)
+		} else {
+			err = yaml.Unmarshal(data, def)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stories file %s: %w", file, err)
+		}
+
+		return def, nil
+	}
+
+	return nil, nil
+}
+
+func (a *AgentBase) storyDefValidate(mach, mem *am.Machine, s *StoryDef) error {
+	var errs []error
+	check := func(m *am.Machine, states S) {
+		for _, name := range states {
+			if name != "" && !m.Has1(name) {
+				errs = append(errs, fmt.Errorf("%w: %s in %s (story %s)", am.ErrStateMissing, name, m.Id(), s.State))
+			}
+		}
+	}
+
+	check(mach, S{s.State})
+	check(mach, s.Agent.states())
+	for _, t := range s.Hist {
+		check(mach, S{t.State})
+	}
+	// memory states can be dynamic, so an empty memory (eg before planning) only logs them
+	checkMem := func(states S) {
+		if mem != nil && !slices.Equal(mem.StateNames(), S{am.StateException}) {
+			check(mem, states)
+			return
+		}
+		for _, name := range states {
+			a.Log("memory state unchecked", "story", s.State, "state", name)
+		}
+	}
+	checkMem(s.Memory.states())
+
+	for _, act := range s.Actions {
+		check(mach, S{act.StateAdd, act.StateRemove})
+		check(mach, slices.Concat(act.VisibleAgent.states(), act.DisabledWhen.states()))
+		checkMem(act.VisibleMem.states())
+		if p := act.Progress; p != nil && p.Mem {
+			checkMem(p.States)
+		} else if p != nil {
+			check(mach, p.States)
+			if groups, _ := mach.Groups(); p.Group != "" && groups[p.Group] == nil {
+				errs = append(errs, fmt.Errorf("group %s missing (story %s)", p.Group, s.State))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// storyActionNew creates an action from a definition.
+func (a *AgentBase) storyActionNew(def ActionDef) shared.Action {
+	mach := a.Mach()
+	act := shared.Action{
+		ID:           amhelp.RandId(8),
+		Label:        def.Label,
+		LabelEnd:     def.LabelEnd,
+		Desc:         def.Desc,
+		StateAdd:     def.StateAdd,
+		StateRemove:  def.StateRemove,
+		VisibleAgent: def.VisibleAgent.Cond(),
+		VisibleMem:   def.VisibleMem.Cond(),
+	}
+
+	if def.DisabledWhen != nil {
+		cond := def.DisabledWhen.Cond()
+		act.IsDisabled = func() bool {
+			return cond.Check(mach)
+		}
+	}
+
+	// click
+	if def.StateAdd != "" || def.StateRemove != "" {
+		act.Action = func() {
+			if name := def.StateRemove; name != "" {
+				if a.agentImpl.Story(name) != nil {
+					a.StoryDeactivate(nil, name)
+				} else {
+					mach.Remove1(name, nil)
+				}
+			}
+			if name := def.StateAdd; name != "" {
+				if a.agentImpl.Story(name) != nil {
+					a.StoryActivate(nil, name)
+				} else {
+					mach.Add1(name, nil)
+				}
+			}
+		}
+	}
+
+	// progress
+	if p := def.Progress; p != nil {
+		// read the machine and the group lazily, as the memory and its schema can change
+		source := func() (*am.Machine, S) {
+			m := mach
+			if p.Mem {
+				m = a.agentImpl.MachMem()
+			}
+			if m == nil || p.Group == "" {
+				return m, p.States
+			}
+			groups, _ := m.Groups()
+
+			return m, am.IndexToStates(m.StateNames(), groups[p.Group])
+		}
+		act.Value = func() int {
+			m, states := source()
+			if m == nil || len(states) == 0 {
+				return 0
+			}
+			return len(m.ActiveStates(states))
+		}
+		act.ValueEnd = func() int {
+			if p.Max > 0 {
+				return p.Max
+			}
+			_, states := source()
+			return len(states)
+		}
+	}
+
+	return act
+}
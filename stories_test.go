@@ -0,0 +1,156 @@
+package secai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/states"
+)
+
+// storiesAgent is [histAgent] with a memory machine.
+type storiesAgent struct {
+	*histAgent
+
+	mem *am.Machine
+}
+
+func (a *storiesAgent) MachMem() *am.Machine { return a.mem }
+
+const storiesKDL = `
+Story {
+  State "Mock"
+  Title "Mocked"
+  Action {
+    Label "Stop"
+    StateRemove "Mock"
+  }
+}
+Story {
+  State "REPL"
+  Agent { Is "Ready"; }
+  Memory { Not "Foo"; }
+  Hist {
+    State "Prompt"
+    IdleFor "10m"
+  }
+  Action {
+    Label "Progress"
+    Progress { States "Foo" "Bar"; Mem true; }
+  }
+}
+`
+
+const storiesYAML = `
+stories:
+  - state: Mock
+    title: Mocked
+    actions:
+      - label: Stop
+        stateRemove: Mock
+  - state: REPL
+    agent:
+      is: [Ready]
+    memory:
+      not: [Foo]
+    hist:
+      - state: Prompt
+        idleFor: 10m
+    actions:
+      - label: Progress
+        progress:
+          states: [Foo, Bar]
+          mem: true
+`
+
+func TestStoriesLoad(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+		def  string
+		// err means an unknown state
+		err bool
+	}{
+		{name: "kdl", file: "stories.kdl", def: storiesKDL},
+		{name: "yaml", file: "stories.yaml", def: storiesYAML},
+		{name: "unknown agent", file: "stories.kdl", def: `Story { State "Mock"; Agent { Is "Foo"; }; }`, err: true},
+		{name: "unknown story", file: "stories.kdl", def: `Story { State "Foo"; }`, err: true},
+		{name: "unknown memory", file: "stories.kdl", def: `Story { State "Mock"; Memory { Is "Baz"; }; }`, err: true},
+		{name: "unknown hist", file: "stories.kdl", def: `Story { State "Mock"; Hist { State "Foo"; }; }`, err: true},
+		{
+			name: "unknown action", file: "stories.yaml", err: true,
+			def: "stories:\n  - state: Mock\n    actions:\n      - label: Foo\n        stateAdd: Foo\n",
+		},
+		{
+			name: "unknown action memory", file: "stories.yaml", err: true,
+			def: "stories:\n  - state: Mock\n    actions:\n      - label: Foo\n        visibleMem:\n          is: [Baz]\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cfg := shared.ConfigDefault()
+			cfg.Agent.ID = "stories"
+			cfg.Agent.Dir = t.TempDir()
+			cfg.AI = shared.ConfigAI{}
+			require.NoError(t, os.WriteFile(filepath.Join(cfg.Agent.Dir, tc.file), []byte(tc.def), 0644))
+
+			mem, err := am.NewCommon(ctx, "memory", am.Schema{"Foo": {}, "Bar": {}},
+				am.S{"Foo", "Bar", am.StateException}, nil, nil, nil)
+			require.NoError(t, err)
+			defer mem.Dispose()
+			a := &storiesAgent{
+				histAgent: &histAgent{AgentBase: NewAgent(ctx, ss.Names(), states.AgentSchema)},
+				mem:       mem,
+			}
+			require.NoError(t, a.Init(a, &cfg, nil, states.AgentBaseGroups, states.AgentBaseStates, nil))
+			defer a.Mach().Dispose()
+
+			// a Go-defined story
+			stories := map[string]*shared.Story{
+				ss.Mock: {
+					StoryInfo: shared.StoryInfo{State: ss.Mock, Title: "Mock", Desc: "From Go"},
+					Actions:   []shared.Action{{Label: "Start"}},
+				},
+			}
+			added, err := a.StoriesLoad(stories)
+			if tc.err {
+				assert.ErrorIs(t, err, am.ErrStateMissing)
+				assert.Nil(t, added)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, am.S{ss.REPL}, added)
+
+			// merged
+			mock := stories[ss.Mock]
+			assert.Equal(t, "Mocked", mock.Title)
+			assert.Equal(t, "From Go", mock.Desc)
+			require.Len(t, mock.Actions, 2)
+			assert.Equal(t, "Start", mock.Actions[0].Label)
+			assert.Equal(t, "Stop", mock.Actions[1].Label)
+			assert.NotNil(t, mock.Actions[1].Action)
+
+			// new
+			repl := stories[ss.REPL]
+			require.NotNil(t, repl)
+			assert.Equal(t, am.S{ss.Ready}, repl.Agent.Trigger.Is)
+			assert.Equal(t, am.S{"Foo"}, repl.Memory.Trigger.Not)
+			assert.Same(t, mem, repl.Memory.Mach)
+			require.Len(t, repl.Agent.HistTriggers, 1)
+			assert.Equal(t, 10*time.Minute, repl.Agent.HistTriggers[0].IdleFor)
+			require.Len(t, repl.Actions, 1)
+			mem.Add1("Foo", nil)
+			assert.Equal(t, 1, repl.Actions[0].Value())
+			assert.Equal(t, 2, repl.Actions[0].ValueEnd())
+		})
+	}
+}
@@ -0,0 +1,341 @@
+// Package history is a tool exposing the agent's machine history to LLMs, as a timeline of activated and deactivated
+// states, story changes and durations.
+package history
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/pancsta/secai/shared"
+
+	"github.com/pancsta/secai"
+	"github.com/pancsta/secai/states"
+)
+
+var ss = states.ToolStates
+var id = "history"
+var title = "Timeline of Events"
+
+// ErrParams means invalid query params.
+var ErrParams = errors.New("invalid params")
+
+type Tool struct {
+	*secai.Tool
+	*am.ExceptionHandler
+
+	agent shared.AgentBaseAPI
+	cfg   shared.ConfigToolsHistory
+
+	mx     sync.Mutex
+	params *Params
+}
+
+func New(agent shared.AgentBaseAPI) (*Tool, error) {
+	var err error
+	t := &Tool{
+		agent: agent,
+		cfg:   agent.ConfigBase().Tools.History,
+	}
+	t.Tool, err = secai.NewTool(agent, id, title, ss.Names(), states.ToolSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind handlers
+	err = t.Mach().BindHandlers(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Document renders the timeline of the last [Tool.Query], or of the default window.
+func (t *Tool) Document() *secai.Document {
+	doc := t.Doc.Clone()
+	doc.Clear()
+
+	t.mx.Lock()
+	params := t.params
+	t.mx.Unlock()
+	if params == nil {
+		params = &Params{Since: t.cfg.Window.String()}
+	}
+
+	// TODO config
+	ctx, cancel := context.WithTimeout(t.Mach().Context(), 5*time.Second)
+	defer cancel()
+	res, err := t.query(ctx, params)
+	if err != nil || len(res.Events) == 0 {
+		return &doc
+	}
+	for _, line := range res.Lines() {
+		doc.AddPart(line)
+	}
+
+	return &doc
+}
+
+// Query is a blocking method that builds a timeline of the agent's history. The params are kept for the following
+// [Tool.Document] calls.
+func (t *Tool) Query(ctx context.Context, params *Params) (*Result, error) {
+	mach := t.Mach()
+	mach.Add1(ss.Working, nil)
+	defer mach.Add1(ss.Idle, nil)
+
+	res, err := t.query(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	t.mx.Lock()
+	t.params = params
+	t.mx.Unlock()
+
+	return res, nil
+}
+
+// private
+
+func (t *Tool) query(ctx context.Context, params *Params) (*Result, error) {
+	hist, err := t.agent.Hist()
+	if err != nil {
+		return nil, err
+	}
+	if err := hist.Sync(); err != nil {
+		return nil, err
+	}
+	rows, err := hist.FindLatest(ctx, false, t.cfg.Limit, amhist.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	var stories am.S
+	if impl := t.agent.AgentImpl(); impl != nil {
+		for _, s := range impl.Stories() {
+			stories = append(stories, s.State)
+		}
+	}
+
+	return Timeline(rows, hist.Config().TrackedStates, stories, *params, time.Now())
+}
+
+// ///// ///// /////
+
+// ///// HANDLERS
+
+// ///// ///// /////
+
+func (t *Tool) StartState(e *am.Event) {
+	t.Mach().Add1(ss.Ready, nil)
+}
+
+// ///// ///// /////
+
+// ///// API
+
+// ///// ///// /////
+
+type Params struct {
+	Since string `description:"Start of the time window, as a duration back from now (eg '15m', '2h'). Empty means the whole history."`
+	Until string `description:"End of the time window, as a duration back from now (eg '5m'). Empty means now."`
+	// TODO enum
+	States []string `description:"Names of states to include. Empty means all the tracked states."`
+	Before string   `description:"Name of a state. Only events before its last activation are included, eg 'what did we do before X'."`
+}
+
+type Event struct {
+	Time  time.Time `description:"Human time of the event."`
+	State string    `description:"Name of the state."`
+	// Active is true for activations, false for deactivations.
+	Active bool `description:"True when activated, false when deactivated."`
+	Story  bool `description:"True when the state is a story."`
+	// Duration is set for deactivations with a known activation.
+	Duration time.Duration `description:"How long the state was active, for deactivations."`
+}
+
+// Span summarizes the activity of a single state in the time window.
+type Span struct {
+	State   string        `description:"Name of the state."`
+	Story   bool          `description:"True when the state is a story."`
+	Count   int           `description:"Number of activations."`
+	Total   time.Duration `description:"Total duration of all the activations."`
+	Ongoing bool          `description:"True when the state is still active."`
+}
+
+type Result struct {
+	From   time.Time
+	To     time.Time
+	Events []Event `description:"Chronological list of events."`
+	Spans  []Span  `description:"Durations per state, longest first."`
+}
+
+// Lines renders the timeline as a concise list.
+func (r *Result) Lines() []string {
+	var ret []string
+	for _, e := range r.Events {
+		kind := "state"
+		if e.Story {
+			kind = "story"
+		}
+		line := fmt.Sprintf("- %s %s %s ", e.Time.Local().Format(time.TimeOnly), kind, e.State)
+		if e.Active {
+			line += "started"
+		} else {
+			line += "ended"
+			if e.Duration > 0 {
+				line += " after " + e.Duration.Round(time.Second).String()
+			}
+		}
+		ret = append(ret, line)
+	}
+
+	if len(r.Spans) > 0 {
+		ret = append(ret, "", "Durations:")
+	}
+	for _, s := range r.Spans {
+		line := fmt.Sprintf("- %s: %dx, %s total", s.State, s.Count, s.Total.Round(time.Second))
+		if s.Ongoing {
+			line += ", still active"
+		}
+		ret = append(ret, line)
+	}
+
+	return ret
+}
+
+// Timeline turns history [rows] into a timeline of changes of [tracked] states, within the window of [params].
+// [stories] marks states being stories.
+func Timeline(
+	rows []*amhist.MemoryRecord, tracked, stories am.S, params Params, now time.Time,
+) (*Result, error) {
+	ret := &Result{To: now}
+
+	// window
+	if params.Since != "" {
+		d, err := time.ParseDuration(params.Since)
+		if err != nil {
+			return nil, fmt.Errorf("%w: since: %w", ErrParams, err)
+		}
+		ret.From = now.Add(-d)
+	}
+	if params.Until != "" {
+		d, err := time.ParseDuration(params.Until)
+		if err != nil {
+			return nil, fmt.Errorf("%w: until: %w", ErrParams, err)
+		}
+		ret.To = now.Add(-d)
+	}
+
+	// states
+	include := tracked
+	if len(params.States) > 0 {
+		include = params.States
+	}
+	for _, name := range slices.Concat(include, am.S{params.Before}) {
+		if name != "" && !slices.Contains(tracked, name) {
+			return nil, fmt.Errorf("%w: state %s not tracked", ErrParams, name)
+		}
+	}
+
+	// oldest first
+	rows = slices.DeleteFunc(slices.Clone(rows), func(r *amhist.MemoryRecord) bool {
+		return r == nil || r.Time == nil
+	})
+	slices.SortStableFunc(rows, func(a, b *amhist.MemoryRecord) int {
+		return a.Time.HTime.Compare(b.Time.HTime)
+	})
+
+	// end the window at the last activation of Before
+	if params.Before != "" {
+		idx := slices.Index(tracked, params.Before)
+		var last time.Time
+		prev := false
+		for _, r := range rows {
+			active := isActive(r, idx)
+			if active && !prev && !r.Time.HTime.After(ret.To) {
+				last = r.Time.HTime
+			}
+			prev = active
+		}
+		if last.IsZero() {
+			return ret, nil
+		}
+		ret.To = last.Add(-time.Nanosecond)
+	}
+
+	// walk the changes
+	since := make([]time.Time, len(tracked))
+	prev := make([]bool, len(tracked))
+	spans := map[string]*Span{}
+	for _, r := range rows {
+		t := r.Time.HTime
+		if t.After(ret.To) {
+			break
+		}
+		for idx, name := range tracked {
+			active := isActive(r, idx)
+			if active == prev[idx] {
+				continue
+			}
+			prev[idx] = active
+			e := Event{Time: t, State: name, Active: active, Story: slices.Contains(stories, name)}
+			if active {
+				since[idx] = t
+			} else if !since[idx].IsZero() {
+				e.Duration = t.Sub(since[idx])
+			}
+
+			if t.Before(ret.From) || !slices.Contains(include, name) {
+				continue
+			}
+			ret.Events = append(ret.Events, e)
+			span := spans[name]
+			if span == nil {
+				span = &Span{State: name, Story: e.Story}
+				spans[name] = span
+			}
+			if active {
+				span.Count++
+			} else {
+				span.Total += e.Duration
+				// activated before the window
+				if since[idx].Before(ret.From) {
+					span.Count++
+				}
+			}
+		}
+	}
+
+	// still active at the end of the window
+	for idx, name := range tracked {
+		span := spans[name]
+		if !prev[idx] || span == nil || since[idx].Before(ret.From) {
+			continue
+		}
+		span.Total += ret.To.Sub(since[idx])
+		span.Ongoing = true
+	}
+
+	for _, span := range spans {
+		if span.Count > 0 {
+			ret.Spans = append(ret.Spans, *span)
+		}
+	}
+	slices.SortFunc(ret.Spans, func(a, b Span) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), strings.Compare(a.State, b.State))
+	})
+
+	return ret, nil
+}
+
+func isActive(r *amhist.MemoryRecord, idx int) bool {
+	return idx < len(r.Time.MTimeTracked) && am.IsActiveTick(r.Time.MTimeTracked[idx])
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	amhist "github.com/pancsta/asyncmachine-go/pkg/history"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracked := am.S{"StepRice", "StoryJoke", "Ready"}
+	stories := am.S{"StoryJoke"}
+	rec := func(ago time.Duration, ticks ...uint64) *amhist.MemoryRecord {
+		return &amhist.MemoryRecord{Time: &amhist.TimeRecord{HTime: now.Add(-ago), MTimeTracked: ticks}}
+	}
+
+	// newest first, like FindLatest
+	rows := []*amhist.MemoryRecord{
+		rec(time.Minute, 2, 2, 1),
+		rec(5*time.Minute, 1, 1, 1),
+		rec(10*time.Minute, 1, 0, 1),
+		rec(30*time.Minute, 0, 0, 1),
+	}
+
+	// whole history
+	res, err := Timeline(rows, tracked, stories, Params{}, now)
+	require.NoError(t, err)
+	require.Len(t, res.Events, 5)
+	assert.Equal(t, Event{Time: now.Add(-30 * time.Minute), State: "Ready", Active: true}, res.Events[0])
+	assert.Equal(t, Event{Time: now.Add(-time.Minute), State: "StepRice", Duration: 9 * time.Minute}, res.Events[3])
+	assert.True(t, res.Events[4].Story)
+	assert.Equal(t, []Span{
+		{State: "Ready", Count: 1, Total: 30 * time.Minute, Ongoing: true},
+		{State: "StepRice", Count: 1, Total: 9 * time.Minute},
+		{State: "StoryJoke", Story: true, Count: 1, Total: 4 * time.Minute},
+	}, res.Spans)
+	assert.Contains(t, res.Lines(), "- StepRice: 1x, 9m0s total")
+
+	// how long did the rice cook
+	res, err = Timeline(rows, tracked, stories, Params{Since: "15m", States: []string{"StepRice"}}, now)
+	require.NoError(t, err)
+	assert.Len(t, res.Events, 2)
+	assert.Equal(t, []Span{{State: "StepRice", Count: 1, Total: 9 * time.Minute}}, res.Spans)
+
+	// what did we do before the joke
+	res, err = Timeline(rows, tracked, stories, Params{Before: "StoryJoke"}, now)
+	require.NoError(t, err)
+	require.Len(t, res.Events, 2)
+	assert.Equal(t, "StepRice", res.Events[1].State)
+	assert.True(t, res.Events[1].Active)
+
+	// errors
+	_, err = Timeline(rows, tracked, stories, Params{Since: "foo"}, now)
+	assert.ErrorIs(t, err, ErrParams)
+	_, err = Timeline(rows, tracked, stories, Params{States: []string{"Foo"}}, now)
+	assert.ErrorIs(t, err, ErrParams)
+}
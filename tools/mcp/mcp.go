@@ -0,0 +1,271 @@
+// Package mcp connects to external MCP servers and exposes each of their tools as a secai tool, with its own state
+// machine. Tools can be called by agents directly, or via LLM function calling, see [Tool.FunctionDef].
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/pancsta/secai/shared"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/pancsta/secai"
+	"github.com/pancsta/secai/states"
+)
+
+var ss = states.ToolStates
+var idPrefix = "mcp-"
+
+// connectTimeout limits the handshake and the listing of tools.
+const connectTimeout = 30 * time.Second
+
+var (
+	// ErrConfig means an invalid server config.
+	ErrConfig = errors.New("invalid MCP config")
+	// ErrCall means the tool returned an error.
+	ErrCall = errors.New("MCP tool error")
+)
+
+// Server is a connection to an external MCP server, with its tools.
+type Server struct {
+	Cfg   shared.ConfigToolsMCP
+	Tools []*Tool
+
+	c *client.Client
+}
+
+// Connect connects to the MCP server of [cfg], and creates a [Tool] for each of its tools. [ctx] bounds the whole
+// connection, not only the handshake.
+func Connect(ctx context.Context, agent shared.AgentBaseAPI, cfg shared.ConfigToolsMCP) (*Server, error) {
+	var c *client.Client
+	var err error
+	switch {
+	case cfg.Name == "":
+		return nil, fmt.Errorf("%w: missing Name", ErrConfig)
+	case cfg.URL != "" && cfg.Transport == "sse":
+		c, err = client.NewSSEMCPClient(cfg.URL)
+	case cfg.URL != "" && (cfg.Transport == "" || cfg.Transport == "http"):
+		c, err = client.NewStreamableHttpClient(cfg.URL)
+	case cfg.URL != "":
+		return nil, fmt.Errorf("%w: unknown transport %s", ErrConfig, cfg.Transport)
+	case cfg.Command != "":
+		c, err = client.NewStdioMCPClient(cfg.Command, cfg.Env, cfg.Args...)
+	default:
+		return nil, fmt.Errorf("%w: missing Command or URL", ErrConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Cfg: cfg, c: c}
+	if err := s.init(ctx, agent); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close disconnects from the server.
+func (s *Server) Close() error {
+	return s.c.Close()
+}
+
+// Tool returns a tool by its MCP name, or nil.
+func (s *Server) Tool(name string) *Tool {
+	for _, t := range s.Tools {
+		if t.Def.Name == name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// private
+
+func (s *Server) init(ctx context.Context, agent shared.AgentBaseAPI) error {
+	if err := s.c.Start(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	req := mcpgo.InitializeRequest{}
+	req.Params.ProtocolVersion = mcpgo.LATEST_PROTOCOL_VERSION
+	req.Params.ClientInfo = mcpgo.Implementation{Name: agent.ConfigBase().Agent.ID, Version: "1.0.0"}
+	if _, err := s.c.Initialize(ctx, req); err != nil {
+		return err
+	}
+
+	list, err := s.c.ListTools(ctx, mcpgo.ListToolsRequest{})
+	if err != nil {
+		return err
+	}
+	for _, def := range list.Tools {
+		t, err := newTool(agent, s, def)
+		if err != nil {
+			return err
+		}
+		s.Tools = append(s.Tools, t)
+	}
+
+	return nil
+}
+
+// ///// ///// /////
+
+// ///// TOOL
+
+// ///// ///// /////
+
+// Tool is a single tool of an MCP server.
+type Tool struct {
+	*secai.Tool
+	*am.ExceptionHandler
+
+	// Def is the MCP definition of the tool.
+	Def mcpgo.Tool
+
+	server *Server
+	mx     sync.Mutex
+	// last call's result
+	result string
+}
+
+func newTool(agent shared.AgentBaseAPI, server *Server, def mcpgo.Tool) (*Tool, error) {
+	var err error
+	t := &Tool{
+		Def:    def,
+		server: server,
+	}
+	title := "MCP Tool " + server.Cfg.Name + "/" + def.Name
+	t.Tool, err = secai.NewTool(agent, idPrefix+server.Cfg.Name+"-"+def.Name, title, ss.Names(), states.ToolSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// bind handlers
+	err = t.Mach().BindHandlers(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Document describes the tool and its params, followed by the last result.
+func (t *Tool) Document() *secai.Document {
+	doc := t.Doc.Clone()
+	doc.Clear()
+
+	if t.Def.Description != "" {
+		doc.AddPart(t.Def.Description)
+	}
+	props := t.Def.InputSchema.Properties
+	for _, name := range slices.Sorted(maps.Keys(props)) {
+		line := "- " + name
+		if prop, ok := props[name].(map[string]any); ok {
+			if typ, ok := prop["type"].(string); ok {
+				line += " (" + typ + ")"
+			}
+			if desc, ok := prop["description"].(string); ok {
+				line += ": " + desc
+			}
+		}
+		if slices.Contains(t.Def.InputSchema.Required, name) {
+			line += " [required]"
+		}
+		doc.AddPart(line)
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.result != "" {
+		doc.AddPart("Last result: " + t.result)
+	}
+
+	return &doc
+}
+
+// Call is a blocking method that calls the tool with [args] and returns the text of the result. Errors also go to
+// the tool's machine.
+func (t *Tool) Call(ctx context.Context, args map[string]any) (string, error) {
+	mach := t.Mach()
+	mach.Add1(ss.Working, nil)
+	defer mach.Add1(ss.Idle, nil)
+
+	if timeout := t.server.Cfg.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req := mcpgo.CallToolRequest{}
+	req.Params.Name = t.Def.Name
+	req.Params.Arguments = args
+	res, err := t.server.c.CallTool(ctx, req)
+	if err != nil {
+		mach.AddErr(err, nil)
+		return "", err
+	}
+
+	var parts []string
+	for _, c := range res.Content {
+		if text := mcpgo.GetTextFromContent(c); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	ret := strings.Join(parts, "\n")
+	if res.IsError {
+		err := fmt.Errorf("%w: %s: %s", ErrCall, t.Def.Name, ret)
+		mach.AddErr(err, nil)
+		return "", err
+	}
+
+	t.mx.Lock()
+	t.result = ret
+	t.mx.Unlock()
+
+	return ret, nil
+}
+
+// CallJSON calls the tool with JSON-encoded [args], eg from an LLM function call.
+func (t *Tool) CallJSON(ctx context.Context, args string) (string, error) {
+	var parsed map[string]any
+	if strings.TrimSpace(args) != "" {
+		if err := json.Unmarshal([]byte(args), &parsed); err != nil {
+			return "", err
+		}
+	}
+
+	return t.Call(ctx, parsed)
+}
+
+// FunctionDef returns a definition of the tool for LLM function calling (OpenAI-compatible APIs).
+func (t *Tool) FunctionDef() openai.FunctionDefinition {
+	return openai.FunctionDefinition{
+		Name:        t.Def.Name,
+		Description: t.Def.Description,
+		Parameters:  t.Def.InputSchema,
+	}
+}
+
+// ///// ///// /////
+
+// ///// HANDLERS
+
+// ///// ///// /////
+
+func (t *Tool) StartState(e *am.Event) {
+	t.Mach().Add1(ss.Ready, nil)
+}
@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/states"
+)
+
+// agent is a stub with a machine and a config.
+type agent struct {
+	shared.AgentBaseAPI
+
+	mach *am.Machine
+	cfg  *shared.Config
+}
+
+func (a *agent) Mach() *am.Machine          { return a.mach }
+func (a *agent) ConfigBase() *shared.Config { return a.cfg }
+
+func TestConnect(t *testing.T) {
+	ctx := context.Background()
+
+	// MCP server with 2 tools
+	srv := server.NewMCPServer("test", "1.0.0")
+	srv.AddTool(mcpgo.NewTool("echo",
+		mcpgo.WithDescription("Echo the text."),
+		mcpgo.WithString("text", mcpgo.Required(), mcpgo.Description("Text to echo.")),
+	), func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+		return mcpgo.NewToolResultText("echo: " + req.GetString("text", "")), nil
+	})
+	srv.AddTool(mcpgo.NewTool("fail"), func(ctx context.Context, req mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+		return mcpgo.NewToolResultError("boom"), nil
+	})
+	httpSrv := httptest.NewServer(server.NewStreamableHTTPServer(srv))
+	defer httpSrv.Close()
+
+	// agent
+	mach, err := am.NewCommon(ctx, "agent", states.ToolSchema, states.ToolStates.Names(), nil, nil, nil)
+	require.NoError(t, err)
+	defer mach.Dispose()
+	cfg := shared.ConfigDefault()
+	a := &agent{mach: mach, cfg: &cfg}
+
+	// connect
+	_, err = Connect(ctx, a, shared.ConfigToolsMCP{Name: "test"})
+	assert.ErrorIs(t, err, ErrConfig)
+	s, err := Connect(ctx, a, shared.ConfigToolsMCP{Name: "test", URL: httpSrv.URL + "/mcp"})
+	require.NoError(t, err)
+	defer s.Close()
+	require.Len(t, s.Tools, 2)
+	echo := s.Tool("echo")
+	require.NotNil(t, echo)
+	echo.Mach().Add1(states.ToolStates.Start, nil)
+	assert.True(t, echo.Mach().Is1(states.ToolStates.Idle))
+
+	// document
+	doc := echo.Document()
+	assert.Equal(t, []string{"Echo the text.", "- text (string): Text to echo. [required]"}, doc.Parts())
+
+	// call
+	out, err := echo.CallJSON(ctx, `{"text": "hi"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hi", out)
+	assert.Contains(t, echo.Document().Parts(), "Last result: echo: hi")
+	assert.Equal(t, "echo", echo.FunctionDef().Name)
+
+	// errors
+	fail := s.Tool("fail")
+	fail.Mach().Add1(states.ToolStates.Start, nil)
+	_, err = fail.Call(ctx, nil)
+	assert.ErrorIs(t, err, ErrCall)
+	assert.True(t, fail.Mach().Is1(am.StateException))
+}
@@ -0,0 +1,183 @@
+package secai
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/db/sqlc"
+	"github.com/pancsta/secai/i18n"
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/transcript"
+)
+
+// ///// ///// /////
+
+// ///// TRANSCRIPT
+
+// ///// ///// /////
+
+// UIMsgState persists the message and passes it to MCP prompt calls. Agents keeping messages in memory should call
+// this super handler.
+func (a *AgentBase) UIMsgState(e *am.Event) {
+	msg := shared.ParseArgs(e.Args).Msg
+	if msg == nil {
+		return
+	}
+	a.mcpBroadcast(msg)
+	mach := a.Mach()
+	agent := mach.Id()
+	sessID := a.sessionID
+
+	mach.EvAdd1(e, ss.BaseDBSaving, Pass(&A{
+		DBQuery: func(ctx context.Context, tx *sql.Tx) error {
+			q := sqlc.New(a.DBTX(tx))
+
+			// prompts are queued before the messages they produced
+			id := msg.Prompt().ID()
+			promptID := sql.NullInt64{Int64: id, Valid: id > 0}
+
+			_, err := q.AddMessage(ctx, sqlc.AddMessageParams{
+				SessionID: sessID,
+				Agent:     agent,
+				Sender:    msg.From.Value,
+				Text:      msg.Text,
+				PromptID:  promptID,
+				CreatedAt: msg.CreatedAt,
+			})
+			return err
+		},
+	}))
+}
+
+// UISaveOutputState exports the transcript of the displayed messages into the agent's dir, using the configured
+// format.
+func (a *AgentBase) UISaveOutputState(e *am.Event) {
+	mach := a.Mach()
+	ctx := mach.NewStateCtx(ss.Start)
+	cfg := a.ConfigBase().Agent
+
+	mach.Fork(ctx, e, func() {
+		format := transcript.Format(cfg.Transcript.Format)
+		out, err := a.ExportTranscript(ctx, time.Time{}, format, cfg.Transcript.Prompts)
+		if ctx.Err() != nil {
+			return // expired
+		}
+		if err != nil {
+			AddErrDB(e, mach, err)
+			return
+		}
+
+		dir := filepath.Join(cfg.Dir, "transcripts")
+		file := filepath.Join(dir, a.sessionID+"."+string(format))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			mach.EvAddErr(e, err, nil)
+			return
+		}
+		if err := os.WriteFile(file, []byte(out), 0644); err != nil {
+			mach.EvAddErr(e, err, nil)
+			return
+		}
+		a.Output(a.T(i18n.KeyTranscriptSaved, file), shared.FromSystem)
+	})
+}
+
+// RestoreMsgs returns the latest messages of previous sessions, according to [shared.ConfigAgentTranscript.Restore].
+// Oldest first.
+func (a *AgentBase) RestoreMsgs(ctx context.Context) ([]*shared.Msg, error) {
+	limit := a.ConfigBase().Agent.Transcript.Restore
+	if limit <= 0 {
+		return nil, nil
+	}
+	if a.DbConn == nil {
+		return nil, ErrDBNil
+	}
+
+	rows, err := a.QueriesBase().ListMessagesPrev(ctx, sqlc.ListMessagesPrevParams{
+		SessionID: a.sessionID,
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := MsgsFromRows(rows)
+	slices.Reverse(ret)
+
+	return ret, nil
+}
+
+// Transcript returns persisted messages created since [since], oldest first. Zero [since] means the displayed
+// messages, including the restored ones. Queued writes are flushed first.
+func (a *AgentBase) Transcript(ctx context.Context, since time.Time) ([]*shared.Msg, error) {
+	if a.DbConn == nil {
+		return nil, ErrDBNil
+	}
+	if since.IsZero() {
+		since = a.transcriptSince()
+	}
+	if err := a.dbFlush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.QueriesBase().ListMessagesSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return MsgsFromRows(rows), nil
+}
+
+// ExportTranscript renders the [AgentBase.Transcript] since [since] in [format].
+func (a *AgentBase) ExportTranscript(
+	ctx context.Context, since time.Time, format transcript.Format, prompts bool,
+) (string, error) {
+	msgs, err := a.Transcript(ctx, since)
+	if err != nil {
+		return "", err
+	}
+
+	return transcript.Render(msgs, format, transcript.Opts{
+		Title:   a.ConfigBase().Agent.Label,
+		Prompts: prompts,
+	})
+}
+
+// transcriptSince returns the creation time of the oldest displayed message, or the start of this session.
+func (a *AgentBase) transcriptSince() time.Time {
+	ret := a.startedAt
+	if a.agentImpl == nil {
+		return ret
+	}
+	for _, m := range a.agentImpl.Msgs() {
+		if m.CreatedAt.Before(ret) {
+			ret = m.CreatedAt
+		}
+	}
+
+	return ret
+}
+
+// MsgsFromRows converts persisted messages.
+func MsgsFromRows(rows []sqlc.Message) []*shared.Msg {
+	ret := make([]*shared.Msg, len(rows))
+	for i, r := range rows {
+		from := shared.FromEnum.Parse(r.Sender)
+		if from == nil {
+			from = &shared.FromSystem
+		}
+		ret[i] = &shared.Msg{
+			From:      *from,
+			Text:      r.Text,
+			CreatedAt: r.CreatedAt,
+			SessionID: r.SessionID,
+			PromptID:  r.PromptID.Int64,
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,144 @@
+// Package transcript renders chat messages as Markdown, JSON or HTML, optionally annotated with IDs of prompts which
+// produced assistant messages.
+package transcript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/pancsta/secai/shared"
+)
+
+// ErrFormat means the output format isn't supported.
+var ErrFormat = errors.New("unknown transcript format")
+
+type Format string
+
+const (
+	FormatMarkdown Format = "md"
+	FormatJSON     Format = "json"
+	FormatHTML     Format = "html"
+)
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	}
+
+	return "text/markdown; charset=utf-8"
+}
+
+type Opts struct {
+	// Title of the document.
+	Title string
+	// Prompts annotates messages with IDs of prompts which produced them.
+	Prompts bool
+}
+
+// Msg is the JSON form of [shared.Msg].
+type Msg struct {
+	From      string    `json:"from"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	SessionID string    `json:"session_id,omitempty"`
+	PromptID  int64     `json:"prompt_id,omitempty"`
+}
+
+// Render renders [msgs] in [format].
+func Render(msgs []*shared.Msg, format Format, opts Opts) (string, error) {
+	switch format {
+	case FormatMarkdown:
+		return markdown(msgs, opts), nil
+	case FormatJSON:
+		return jsonDoc(msgs, opts)
+	case FormatHTML:
+		return htmlDoc(msgs, opts), nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrFormat, format)
+}
+
+// Sender returns a human-readable author of [msg].
+func Sender(msg *shared.Msg) string {
+	switch msg.From {
+	case shared.FromUser:
+		return "You"
+	case shared.FromAssistant:
+		return "Assistant"
+	case shared.FromNarrator:
+		return "Narrator"
+	}
+
+	return "System"
+}
+
+func meta(msg *shared.Msg, opts Opts) string {
+	ret := msg.CreatedAt.Format(time.DateTime)
+	if opts.Prompts && msg.PromptID > 0 {
+		ret += fmt.Sprintf(" · prompt #%d", msg.PromptID)
+	}
+
+	return ret
+}
+
+func markdown(msgs []*shared.Msg, opts Opts) string {
+	var b strings.Builder
+	if opts.Title != "" {
+		fmt.Fprintf(&b, "# %s\n\n", opts.Title)
+	}
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "**%s** _%s_\n\n%s\n\n", Sender(msg), meta(msg, opts), strings.TrimSpace(msg.Text))
+	}
+
+	return b.String()
+}
+
+func jsonDoc(msgs []*shared.Msg, opts Opts) (string, error) {
+	list := make([]Msg, len(msgs))
+	for i, msg := range msgs {
+		list[i] = Msg{
+			From:      msg.From.Value,
+			Text:      msg.Text,
+			CreatedAt: msg.CreatedAt,
+			SessionID: msg.SessionID,
+		}
+		if opts.Prompts {
+			list[i].PromptID = msg.PromptID
+		}
+	}
+	ret, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(ret), nil
+}
+
+func htmlDoc(msgs []*shared.Msg, opts Opts) string {
+	var b strings.Builder
+	title := html.EscapeString(opts.Title)
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString("<style>body{font-family:sans-serif;max-width:50em;margin:auto}" +
+		".msg{margin:1em 0}.meta{color:#888;font-size:.8em}.text{white-space:pre-wrap}</style>\n")
+	b.WriteString("</head>\n<body>\n")
+	if title != "" {
+		fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+	}
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "<div class=\"msg %s\"><b>%s</b> <span class=\"meta\">%s</span>\n<div class=\"text\">%s</div></div>\n",
+			html.EscapeString(msg.From.Value), Sender(msg), html.EscapeString(meta(msg, opts)),
+			html.EscapeString(strings.TrimSpace(msg.Text)))
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	return b.String()
+}
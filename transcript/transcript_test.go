@@ -0,0 +1,59 @@
+package transcript
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+)
+
+func testMsgs() []*shared.Msg {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []*shared.Msg{
+		{From: shared.FromUser, Text: "<hi>", CreatedAt: at, SessionID: "s1"},
+		{From: shared.FromAssistant, Text: " hello \n", CreatedAt: at, SessionID: "s1", PromptID: 7},
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	out, err := Render(testMsgs(), FormatMarkdown, Opts{Title: "Chat", Prompts: true})
+	require.NoError(t, err)
+	assert.Equal(t, "# Chat\n\n"+
+		"**You** _2025-01-02 03:04:05_\n\n<hi>\n\n"+
+		"**Assistant** _2025-01-02 03:04:05 · prompt #7_\n\nhello\n\n", out)
+
+	out, err = Render(testMsgs(), FormatMarkdown, Opts{})
+	require.NoError(t, err)
+	assert.NotContains(t, out, "prompt #7")
+}
+
+func TestJSON(t *testing.T) {
+	out, err := Render(testMsgs(), FormatJSON, Opts{})
+	require.NoError(t, err)
+	var list []Msg
+	require.NoError(t, json.Unmarshal([]byte(out), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "assistant", list[1].From)
+	assert.Zero(t, list[1].PromptID)
+
+	out, err = Render(testMsgs(), FormatJSON, Opts{Prompts: true})
+	require.NoError(t, err)
+	assert.Contains(t, out, `"prompt_id": 7`)
+}
+
+func TestHTML(t *testing.T) {
+	out, err := Render(testMsgs(), FormatHTML, Opts{Title: "a&b"})
+	require.NoError(t, err)
+	assert.Contains(t, out, "<title>a&amp;b</title>")
+	assert.Contains(t, out, "&lt;hi&gt;")
+	assert.NotContains(t, out, "<hi>")
+}
+
+func TestFormat(t *testing.T) {
+	_, err := Render(testMsgs(), "pdf", Opts{})
+	assert.ErrorIs(t, err, ErrFormat)
+}
@@ -11,11 +11,10 @@ import (
 	"github.com/pancsta/cview"
 	"github.com/pancsta/tcell-v2"
 
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
 )
 
-var placeholder = "Enter text here..."
-
 // TODO merge into TUI
 type Chat struct {
 	msgs      []*shared.Msg
@@ -53,6 +52,16 @@ func (c *Chat) UICleanOutputState(e *am.Event) {
 	})
 }
 
+func (c *Chat) RewoundState(e *am.Event) {
+	c.msgs = ParseArgs(e.Args).Rewind.Msgs(c.msgs)
+	text := c.renderMsgs()
+
+	go c.t.app.QueueUpdateDraw(func() {
+		c.msgsView.SetText(text)
+		c.msgsView.ScrollToEnd()
+	})
+}
+
 func (c *Chat) UIButtonSendState(e *am.Event) {
 	c.t.agent.EvAdd1(e, ss.Prompt, Pass(&A{Prompt: c.prompt.GetText()}))
 	c.prompt.SetText("")
@@ -80,7 +89,7 @@ func (c *Chat) InputBlockedEnd(e *am.Event) {
 func (c *Chat) InputBlockedState(e *am.Event) {
 	// TODO
 	// c.prompt.SetDisabled(false)
-	c.prompt.SetPlaceholder(placeholder)
+	c.prompt.SetPlaceholder(c.t.T(i18n.KeyPlaceholder))
 	c.t.Redraw()
 }
 
@@ -95,7 +104,7 @@ func (c *Chat) RequestingState(e *am.Event) {
 
 func (c *Chat) RequestingEnd(e *am.Event) {
 	go c.t.app.QueueUpdateDraw(func() {
-		c.prompt.SetTitle("Prompt")
+		c.prompt.SetTitle(c.t.T(i18n.KeyPrompt))
 	})
 }
 
@@ -118,12 +127,12 @@ func (c *Chat) UIMsgState(e *am.Event) {
 }
 
 func (c *Chat) InterruptedState(e *am.Event) {
-	c.butInter.SetLabel("Resume")
+	c.butInter.SetLabel(c.t.T(i18n.KeyResume))
 	c.t.Redraw()
 }
 
 func (c *Chat) InterruptedEnd(e *am.Event) {
-	c.butInter.SetLabel("Interrupt")
+	c.butInter.SetLabel(c.t.T(i18n.KeyInterrupt))
 	c.t.Redraw()
 }
 
@@ -154,14 +163,14 @@ func (c *Chat) Init() error {
 	c.msgsView.ScrollToEnd()
 	c.msgsView.SetText(c.renderMsgs())
 	c.msgsView.ScrollToEnd()
-	c.msgsView.SetTitle("Messages")
+	c.msgsView.SetTitle(c.t.T(i18n.KeyMessages))
 	c.msgsView.SetBorder(true)
 
 	// input TODO port tview TextArea
 	c.prompt = cview.NewInputField()
 	// c.prompt.SetWrap(false)
-	c.prompt.SetPlaceholder(placeholder)
-	c.prompt.SetTitle("Prompt")
+	c.prompt.SetPlaceholder(c.t.T(i18n.KeyPlaceholder))
+	c.prompt.SetTitle(c.t.T(i18n.KeyPrompt))
 	c.prompt.SetFieldBackgroundColor(tcell.ColorDefault)
 	c.prompt.SetFieldBackgroundColorFocused(tcell.ColorDefault)
 	c.prompt.SetBorder(true)
@@ -186,7 +195,7 @@ func (c *Chat) Init() error {
 		return event
 	})
 
-	c.butSend = cview.NewButton("Send Message")
+	c.butSend = cview.NewButton(c.t.T(i18n.KeySendMessage))
 	c.butSend.SetBackgroundColor(themeButtonBg)
 	c.butSend.SetBackgroundColorFocused(themeButtonBg)
 	c.butSend.SetSelectedFunc(func() {
@@ -205,7 +214,7 @@ func (c *Chat) Init() error {
 	})
 	c.butSend.SetBorder(true)
 
-	c.butInter = cview.NewButton("Interrupt")
+	c.butInter = cview.NewButton(c.t.T(i18n.KeyInterrupt))
 	c.butInter.SetBackgroundColor(themeButtonBg)
 	c.butInter.SetBackgroundColorFocused(themeButtonBg)
 	c.butInter.SetSelectedFunc(func() {
@@ -223,7 +232,7 @@ func (c *Chat) Init() error {
 		}()
 	})
 	if c.t.agent.Is1(ss.Interrupted) {
-		c.butInter.SetLabel("Resume")
+		c.butInter.SetLabel(c.t.T(i18n.KeyResume))
 	}
 	c.butInter.SetBorder(true)
 
@@ -236,11 +245,18 @@ func (c *Chat) Init() error {
 	c.layout.AddItem(c.butSend, 3, 1, false)
 	c.layout.AddItem(c.butInter, 3, 1, false)
 
-	// catch ctrl+c
+	// catch ctrl+c, save the transcript on ctrl+s, undo on ctrl+z
 	c.t.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyCtrlC {
+		switch event.Key() {
+		case tcell.KeyCtrlC:
 			_ = c.t.Stop()
 			return nil
+		case tcell.KeyCtrlS:
+			c.t.agent.Add1(ss.UISaveOutput, nil)
+			return nil
+		case tcell.KeyCtrlZ:
+			c.t.agent.Add1(ss.Rewind, nil)
+			return nil
 		}
 
 		return event
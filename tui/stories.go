@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"cmp"
 	"fmt"
 	"sync/atomic"
 	"time"
@@ -8,6 +9,7 @@ import (
 	am "github.com/pancsta/asyncmachine-go/pkg/machine"
 	"github.com/pancsta/cview"
 
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -93,7 +95,7 @@ func (s *Stories) Init() error {
 	// header
 	s.header = cview.NewTextView()
 	label := s.cfg.Agent.Label
-	intro := s.cfg.Agent.Intro
+	intro := s.cfg.Agent.Translated(cmp.Or(s.t.Locale, s.cfg.Agent.Locale)).Intro
 	if intro != "" && label != "" {
 		s.header.SetDynamicColors(true)
 		s.header.SetTitle(label)
@@ -107,7 +109,7 @@ func (s *Stories) Init() error {
 	s.storiesList.SetChangedFunc(func() {
 		s.t.app.Draw()
 	})
-	s.storiesList.SetTitle("Stories")
+	s.storiesList.SetTitle(s.t.T(i18n.KeyStories))
 	s.storiesList.SetBorder(true)
 
 	// buttons
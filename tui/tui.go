@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"cmp"
 	"errors"
 	"log/slog"
 	"slices"
@@ -16,6 +17,7 @@ import (
 	"github.com/pancsta/tcell-v2"
 	"github.com/pancsta/tcell-v2/terminfo"
 
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
 	ssbase "github.com/pancsta/secai/states"
 	"github.com/pancsta/secai/tui/states"
@@ -38,6 +40,8 @@ type TUI struct {
 
 	MachTUI    *am.Machine
 	ClientAddr string
+	// Locale of UI strings, defaults to the configured one.
+	Locale string
 
 	chat    *Chat
 	clock   *Clock
@@ -82,6 +86,11 @@ func NewTui(agent *am.Machine, logger *slog.Logger, config *shared.Config, clien
 
 // ///// ///// /////
 
+// T returns a UI string translated to the TUI's locale.
+func (t *TUI) T(key string, args ...any) string {
+	return i18n.T(cmp.Or(t.Locale, t.cfg.Agent.Locale), key, args...)
+}
+
 func (t *TUI) Init(
 	screen tcell.Screen, name string, stories *Stories, clock *Clock, chat *Chat,
 ) error {
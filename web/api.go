@@ -0,0 +1,368 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/invopop/jsonschema"
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+
+	"github.com/pancsta/secai/shared"
+	"github.com/pancsta/secai/web/types"
+)
+
+// APIPrefix is the path prefix of the REST API, served on [shared.ConfigWeb.Addr].
+const APIPrefix = "/api/v1/"
+
+var (
+	// ErrAPINotFound means an unknown action.
+	ErrAPINotFound = errors.New("not found")
+	// ErrAPICanceled means the mutation was canceled by the agent.
+	ErrAPICanceled = errors.New("canceled by the agent")
+)
+
+// apiSubBuffer is the number of messages buffered per SSE client, before dropping.
+const apiSubBuffer = 100
+
+type apiParam struct {
+	name string
+	// in is "query" or "path"
+	in   string
+	desc string
+}
+
+type apiRoute struct {
+	method  string
+	path    string
+	summary string
+	params  []apiParam
+	req     any
+	// resp is the 200 response
+	resp any
+	// list means the response is a list of resp
+	list bool
+	// stream means the response is an SSE stream of resp
+	stream  bool
+	handler http.HandlerFunc
+}
+
+// APIHandler returns the REST API, with the OpenAPI document at "openapi.json".
+func (h *Handlers) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, r := range h.apiRoutes() {
+		mux.HandleFunc(r.method+" "+r.path, r.handler)
+	}
+
+	return mux
+}
+
+// OpenAPI returns the OpenAPI 3.1 document of the REST API, generated from the types.
+func (h *Handlers) OpenAPI() map[string]any {
+	ref := &jsonschema.Reflector{}
+	schemas := map[string]any{}
+	// schema returns a ref to a component
+	schema := func(v any, list bool) map[string]any {
+		s := ref.Reflect(v)
+		for name, def := range s.Definitions {
+			schemas[name] = def
+		}
+		ret := map[string]any{"$ref": "#/components/schemas/" + strings.TrimPrefix(s.Ref, "#/$defs/")}
+		if list {
+			ret = map[string]any{"type": "array", "items": ret}
+		}
+		return ret
+	}
+	content := func(mime string, s map[string]any) map[string]any {
+		return map[string]any{mime: map[string]any{"schema": s}}
+	}
+	errResp := map[string]any{
+		"description": "Error",
+		"content":     content("application/json", schema(&types.APIError{}, false)),
+	}
+
+	paths := map[string]any{}
+	for _, r := range h.apiRoutes() {
+		path := r.path
+		op := map[string]any{
+			"summary":   r.summary,
+			"responses": map[string]any{"default": errResp},
+		}
+		ok := map[string]any{"description": "OK"}
+		switch {
+		case r.stream:
+			ok["content"] = content("text/event-stream", schema(r.resp, false))
+		case r.resp != nil:
+			ok["content"] = content("application/json", schema(r.resp, r.list))
+		default:
+			ok["content"] = content("application/json", map[string]any{"type": "object"})
+		}
+		op["responses"].(map[string]any)["200"] = ok
+		if r.req != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  content("application/json", schema(r.req, false)),
+			}
+		}
+		var params []any
+		for _, p := range r.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.desc,
+				"required":    p.in == "path",
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path].(map[string]any)[strings.ToLower(r.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   h.A.ConfigBase().Agent.Label,
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+// private
+
+func (h *Handlers) apiRoutes() []apiRoute {
+	return []apiRoute{{
+		method:  http.MethodPost,
+		path:    APIPrefix + "prompt",
+		summary: "Send a prompt to the agent, like in the chat. Replies arrive as messages.",
+		req:     &types.APIPrompt{},
+		resp:    &types.APIResult{},
+		handler: h.apiPrompt,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "messages",
+		summary: "Displayed messages, including the restored ones.",
+		params:  []apiParam{{name: "since", in: "query", desc: "RFC 3339 time of the oldest message."}},
+		resp:    &shared.Msg{},
+		list:    true,
+		handler: h.apiMessages,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "actions",
+		summary: "Available actions (buttons).",
+		resp:    &shared.ActionInfo{},
+		list:    true,
+		handler: h.apiActions,
+	}, {
+		method:  http.MethodPost,
+		path:    APIPrefix + "actions/{id}",
+		summary: "Trigger an action.",
+		params:  []apiParam{{name: "id", in: "path", desc: "ID of the action."}},
+		resp:    &types.APIResult{},
+		handler: h.apiAction,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "states",
+		summary: "Active and all the states of the agent.",
+		resp:    &types.APIStates{},
+		handler: h.apiStates,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "stories",
+		summary: "Stories of the agent, with their activation status.",
+		resp:    &types.APIStory{},
+		list:    true,
+		handler: h.apiStories,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "events",
+		summary: `Stream of new messages, as SSE "msg" events.`,
+		resp:    &shared.Msg{},
+		stream:  true,
+		handler: h.apiEvents,
+	}, {
+		method:  http.MethodGet,
+		path:    APIPrefix + "openapi.json",
+		summary: "This document.",
+		handler: h.apiOpenAPI,
+	}}
+}
+
+func (h *Handlers) apiPrompt(w http.ResponseWriter, req *http.Request) {
+	var body types.APIPrompt
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		apiErr(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		apiErr(w, http.StatusBadRequest, errors.New("missing Text"))
+		return
+	}
+
+	res := h.A.Mach().Add1(ss.Prompt, Pass(&ABase{Prompt: body.Text}))
+	apiResult(w, res)
+}
+
+func (h *Handlers) apiMessages(w http.ResponseWriter, req *http.Request) {
+	var since time.Time
+	if v := req.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			apiErr(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	msgs, err := h.A.Transcript(req.Context(), since)
+	if err != nil {
+		apiErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	apiJSON(w, http.StatusOK, msgs)
+}
+
+func (h *Handlers) apiActions(w http.ResponseWriter, req *http.Request) {
+	apiJSON(w, http.StatusOK, h.A.AgentImpl().Actions())
+}
+
+func (h *Handlers) apiAction(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	found := slices.ContainsFunc(h.A.AgentImpl().Actions(), func(a shared.ActionInfo) bool {
+		return a.Action && a.ID == id
+	})
+	if !found {
+		apiErr(w, http.StatusNotFound, fmt.Errorf("%w: action %s", ErrAPINotFound, id))
+		return
+	}
+
+	res := h.A.Mach().Add1(ss.StoryAction, Pass(&ABase{ID: id}))
+	apiResult(w, res)
+}
+
+func (h *Handlers) apiStates(w http.ResponseWriter, req *http.Request) {
+	mach := h.A.Mach()
+	apiJSON(w, http.StatusOK, types.APIStates{
+		Active: mach.ActiveStates(nil),
+		All:    mach.StateNames(),
+	})
+}
+
+func (h *Handlers) apiStories(w http.ResponseWriter, req *http.Request) {
+	mach := h.A.Mach()
+	ret := []types.APIStory{}
+	for _, s := range h.A.AgentImpl().Stories() {
+		ret = append(ret, types.APIStory{StoryInfo: s, Active: mach.Is1(s.State)})
+	}
+	apiJSON(w, http.StatusOK, ret)
+}
+
+func (h *Handlers) apiEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiErr(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	ch := h.apiSubscribe()
+	defer h.apiUnsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := req.Context()
+	machCtx := h.A.Mach().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-machCtx.Done():
+			return
+		case msg := <-ch:
+			j, err := json.Marshal(msg)
+			if err != nil {
+				h.A.LogErr("api events", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: msg\ndata: %s\n\n", j); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handlers) apiOpenAPI(w http.ResponseWriter, req *http.Request) {
+	apiJSON(w, http.StatusOK, h.OpenAPI())
+}
+
+// apiSubscribe returns a channel of new messages, see [Handlers.UIMsgState].
+func (h *Handlers) apiSubscribe() chan *shared.Msg {
+	ch := make(chan *shared.Msg, apiSubBuffer)
+	h.apiMx.Lock()
+	defer h.apiMx.Unlock()
+	if h.apiSubs == nil {
+		h.apiSubs = map[chan *shared.Msg]struct{}{}
+	}
+	h.apiSubs[ch] = struct{}{}
+
+	return ch
+}
+
+func (h *Handlers) apiUnsubscribe(ch chan *shared.Msg) {
+	h.apiMx.Lock()
+	defer h.apiMx.Unlock()
+	delete(h.apiSubs, ch)
+}
+
+func apiResult(w http.ResponseWriter, res am.Result) {
+	if res == am.Canceled {
+		apiErr(w, http.StatusConflict, ErrAPICanceled)
+		return
+	}
+	apiJSON(w, http.StatusOK, types.APIResult{Result: res.String()})
+}
+
+func apiErr(w http.ResponseWriter, code int, err error) {
+	apiJSON(w, code, types.APIError{Error: err.Error()})
+}
+
+func apiJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ///// ///// /////
+
+// ///// HANDLERS
+
+// ///// ///// /////
+
+// UIMsgState broadcasts the message to the SSE clients of the REST API and the chat API, dropping it for slow clients.
+func (h *Handlers) UIMsgState(e *am.Event) {
+	msg := shared.ParseArgs(e.Args).Msg
+	if msg == nil {
+		return
+	}
+
+	h.apiMx.Lock()
+	defer h.apiMx.Unlock()
+	for ch := range h.apiSubs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
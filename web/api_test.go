@@ -0,0 +1,261 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pancsta/secai/shared"
+	sabase "github.com/pancsta/secai/states"
+	"github.com/pancsta/secai/web/types"
+)
+
+// agent is a stub with a machine, a transcript, a single action and a single story.
+type agent struct {
+	shared.AgentBaseAPI
+
+	mach *am.Machine
+	cfg  *shared.Config
+	msgs []*shared.Msg
+}
+
+func (a *agent) Mach() *am.Machine            { return a.mach }
+func (a *agent) ConfigBase() *shared.Config   { return a.cfg }
+func (a *agent) AgentImpl() shared.AgentAPI   { return &agentImpl{} }
+func (a *agent) LogErr(string, error, ...any) {}
+func (a *agent) SessionID() string            { return "test" }
+
+func (a *agent) Transcript(_ context.Context, since time.Time) ([]*shared.Msg, error) {
+	var ret []*shared.Msg
+	for _, m := range a.msgs {
+		if !m.CreatedAt.Before(since) {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+type agentImpl struct {
+	shared.AgentAPI
+}
+
+func (a *agentImpl) Stories() []shared.StoryInfo {
+	return []shared.StoryInfo{{State: ss.Ready, Title: "Ready"}}
+}
+
+func (a *agentImpl) Actions() []shared.ActionInfo {
+	return []shared.ActionInfo{{ID: "test-1", Action: true}}
+}
+
+// apiHandlers binds only the API handlers, without the web UI.
+type apiHandlers struct {
+	h *Handlers
+}
+
+func (a *apiHandlers) UIMsgState(e *am.Event) { a.h.UIMsgState(e) }
+
+// chatHandlers replies to prompts, like an LLM agent.
+type chatHandlers struct {
+	apiHandlers
+
+	// mute skips the assistant's reply
+	mute atomic.Bool
+}
+
+func (a *chatHandlers) PromptState(e *am.Event) {
+	mach := e.Machine()
+	mach.Add1(ss.UIMsg, shared.Pass(&shared.A{Msg: shared.NewMsg("thinking", shared.FromNarrator)}))
+	if !a.mute.Load() {
+		mach.Add1(ss.UIMsg, shared.Pass(&shared.A{Msg: shared.NewMsg("pong", shared.FromAssistant)}))
+	}
+}
+
+func TestAPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mach, err := am.NewCommon(ctx, "agent", sabase.AgentSchema, ss.Names(), nil, nil, nil)
+	require.NoError(t, err)
+	defer mach.Dispose()
+	cfg := shared.ConfigDefault()
+	a := &agent{mach: mach, cfg: &cfg, msgs: []*shared.Msg{shared.NewMsg("hi", shared.FromUser)}}
+	h := &Handlers{A: a}
+	require.NoError(t, mach.BindHandlers(&apiHandlers{h: h}))
+	srv := httptest.NewServer(h.APIHandler())
+	defer srv.Close()
+
+	call := func(method, path, body string, out any) int {
+		req, err := http.NewRequestWithContext(ctx, method, srv.URL+APIPrefix+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if out != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+		return res.StatusCode
+	}
+
+	// prompt requires Start
+	var apiErr types.APIError
+	assert.Equal(t, http.StatusConflict, call("POST", "prompt", `{"Text": "ping"}`, &apiErr))
+	assert.Equal(t, ErrAPICanceled.Error(), apiErr.Error)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "prompt", `{}`, nil))
+	mach.Add(am.S{ss.Start, ss.UIMode}, nil)
+	var res types.APIResult
+	assert.Equal(t, http.StatusOK, call("POST", "prompt", `{"Text": "ping"}`, &res))
+	assert.Equal(t, am.Executed.String(), res.Result)
+	assert.True(t, mach.Is1(ss.Prompt))
+
+	// actions
+	assert.Equal(t, http.StatusNotFound, call("POST", "actions/foo", "", nil))
+	assert.Equal(t, http.StatusOK, call("POST", "actions/test-1", "", &res))
+	var actions []shared.ActionInfo
+	assert.Equal(t, http.StatusOK, call("GET", "actions", "", &actions))
+	assert.Len(t, actions, 1)
+
+	// reads
+	var msgs []*shared.Msg
+	assert.Equal(t, http.StatusOK, call("GET", "messages", "", &msgs))
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, http.StatusOK, call("GET", "messages?since="+time.Now().Add(time.Hour).Format(time.RFC3339), "",
+		&msgs))
+	assert.Empty(t, msgs)
+	assert.Equal(t, http.StatusBadRequest, call("GET", "messages?since=foo", "", nil))
+	var states types.APIStates
+	assert.Equal(t, http.StatusOK, call("GET", "states", "", &states))
+	assert.Contains(t, states.Active, ss.Start)
+	var stories []types.APIStory
+	assert.Equal(t, http.StatusOK, call("GET", "stories", "", &stories))
+	require.Len(t, stories, 1)
+	assert.False(t, stories[0].Active)
+
+	// openapi
+	var doc map[string]any
+	assert.Equal(t, http.StatusOK, call("GET", "openapi.json", "", &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	assert.Contains(t, doc["paths"], APIPrefix+"actions/{id}")
+	assert.Contains(t, doc["components"].(map[string]any)["schemas"], "APIPrompt")
+
+	// events
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+APIPrefix+"events", nil)
+	require.NoError(t, err)
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+	mach.Add1(ss.UIMsg, shared.Pass(&shared.A{Msg: shared.NewMsg("pong", shared.FromAssistant)}))
+	scanner := bufio.NewScanner(stream.Body)
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "event: msg", scanner.Text())
+	require.True(t, scanner.Scan())
+	assert.Contains(t, scanner.Text(), `"pong"`)
+}
+
+func TestChat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mach, err := am.NewCommon(ctx, "agent", sabase.AgentSchema, ss.Names(), nil, nil, nil)
+	require.NoError(t, err)
+	defer mach.Dispose()
+	cfg := shared.ConfigDefault()
+	cfg.Agent.ID = "cook"
+	cfg.Web.ChatTimeout = time.Second
+	h := &Handlers{A: &agent{mach: mach, cfg: &cfg}}
+	handlers := &chatHandlers{apiHandlers: apiHandlers{h: h}}
+	require.NoError(t, mach.BindHandlers(handlers))
+	mach.Add1(ss.Start, nil)
+	srv := httptest.NewServer(h.ChatHandler())
+	defer srv.Close()
+
+	clientCfg := openai.DefaultConfig("")
+	clientCfg.BaseURL = srv.URL + "/v1"
+	c := openai.NewClientWithConfig(clientCfg)
+	chatReq := openai.ChatCompletionRequest{
+		User: "a",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "hello"},
+			{Role: openai.ChatMessageRoleUser, Content: "ping"},
+		},
+	}
+
+	// models
+	models, err := c.ListModels(ctx)
+	require.NoError(t, err)
+	require.Len(t, models.Models, 1)
+	assert.Equal(t, "cook", models.Models[0].ID)
+
+	// single response
+	res, err := c.CreateChatCompletion(ctx, chatReq)
+	require.NoError(t, err)
+	require.Len(t, res.Choices, 1)
+	assert.Equal(t, "thinking\n\npong", res.Choices[0].Message.Content)
+	assert.Equal(t, "cook", res.Model)
+
+	// stream
+	stream, err := c.CreateChatCompletionStream(ctx, chatReq)
+	require.NoError(t, err)
+	defer stream.Close()
+	var reply strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if len(chunk.Choices) > 0 {
+			reply.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	assert.Equal(t, "thinking\n\npong", reply.String())
+
+	// no reply
+	handlers.mute.Store(true)
+	_, err = c.CreateChatCompletion(ctx, chatReq)
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusGatewayTimeout, apiErr.HTTPStatusCode)
+	stream, err = c.CreateChatCompletionStream(ctx, chatReq)
+	require.NoError(t, err)
+	defer stream.Close()
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, ErrChatTimeout.Error(), apiErr.Message)
+			break
+		}
+		if len(chunk.Choices) > 0 {
+			assert.Empty(t, chunk.Choices[0].FinishReason)
+		}
+	}
+	handlers.mute.Store(false)
+
+	// another session
+	chatReq.User = "b"
+	_, err = c.CreateChatCompletion(ctx, chatReq)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.HTTPStatusCode)
+
+	// no prompt
+	chatReq.User = "a"
+	chatReq.Messages = chatReq.Messages[:0]
+	_, err = c.CreateChatCompletion(ctx, chatReq)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
+}
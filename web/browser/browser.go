@@ -435,6 +435,12 @@ func (d *Dashboard) DataState(e *am.Event) {
 	if dash.Splash != "" {
 		d.data.Splash = dash.Splash
 	}
+	if dash.Stories != nil {
+		d.data.Stories = dash.Stories
+	}
+	if dash.Graph != nil {
+		d.data.Graph = dash.Graph
+	}
 }
 
 // ///// ///// /////
@@ -580,6 +586,9 @@ func (a *AgentUI) DataState(e *am.Event) {
 	if data.ClockDiff != nil {
 		a.data.ClockDiff = data.ClockDiff
 	}
+	if data.Locale != "" {
+		a.data.Locale = data.Locale
+	}
 	a.Dump("DataState", data)
 }
 
@@ -623,6 +632,10 @@ func (a *AgentUI) UICleanOutputState(e *am.Event) {
 	a.data.Msgs = nil
 }
 
+func (a *AgentUI) RewoundState(e *am.Event) {
+	a.data.Msgs = ParseArgsBase(e.Args).Rewind.Msgs(a.data.Msgs)
+}
+
 // ///// ///// /////
 
 // ///// AGENT NETMACH
@@ -9,6 +9,7 @@ import (
 	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
 	. "github.com/pancsta/go-app/pkg/app"
 
+	"github.com/pancsta/secai/i18n"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -52,7 +53,7 @@ func (a *AgentUI) Render() UI {
 						H2().Class("card-title text-sm text-base-content/50 uppercase tracking-wider self-center").Text(
 							cfg.Agent.Label),
 						P().Class("text-xs text-base-content/70 overflow-y-auto").
-							Text(cfg.Agent.Intro),
+							Text(cfg.Agent.Translated(a.locale()).Intro),
 					),
 				),
 
@@ -73,13 +74,12 @@ func (a *AgentUI) renderStories() UI {
 		badge := Div().Class("text-xs")
 
 		if !story.DeactivatedAt.IsZero() {
-			badge.Text(fmt.Sprintf("%.0fm ago for t%d",
-				time.Since(story.DeactivatedAt).Minutes(), story.LastActiveTicks))
+			badge.Text(a.t(i18n.KeyAgoFor, time.Since(story.DeactivatedAt).Minutes(), story.LastActiveTicks))
 		}
 		class := "opacity-60"
 		if a.agent.Is1(story.State) {
 			class = "bg-success/10 p-2 rounded-lg border border-success/30"
-			badge = Div().Class("badge badge-success badge-sm animate-pulse").Text("Active")
+			badge = Div().Class("badge badge-success badge-sm animate-pulse").Text(a.t(i18n.KeyActive))
 		}
 
 		storiesDivs = append(storiesDivs, []UI{
@@ -105,7 +105,7 @@ func (a *AgentUI) renderStories() UI {
 		Div().Class("card bg-base-100 rounded-lg flex-1 overflow-hidden border border-base-200").Body(
 			Div().Class("card-body p-4 flex flex-col h-full").Body(
 				H2().Class("card-title text-sm text-base-content/50 uppercase tracking-wider mb-2 self-center").Text(
-					"Stories"),
+					a.t(i18n.KeyStories)),
 				Div().Class("flex-1 overflow-y-auto space-y-3 pr-2").Body(
 					storiesDivs...,
 				),
@@ -211,10 +211,18 @@ func (a *AgentUI) renderPromptForm() UI {
 			textarea.Class("textarea w-full shadow-sm grow rounded-lg").
 				OnKeyDown(a.promptCtrlEnter).
 				OnInput(a.ValueTo(&a.formPrompt)).
-				Placeholder("Type your message here...").Text(a.formPrompt),
-			btnSend.Class("btn btn-primary w-full flex-none rounded-lg").Text("Send"),
+				Placeholder(a.t(i18n.KeyPlaceholder)).Text(a.formPrompt),
+			btnSend.Class("btn btn-primary w-full flex-none rounded-lg").Text(a.t(i18n.KeySend)),
 			btnInter.Class("btn btn-error btn-outline w-full flex-none rounded-lg").OnClick(a.clickInterrupt).Text(
-				"Interrupt"),
+				a.t(i18n.KeyInterrupt)),
+			Button().Class("btn btn-outline w-full flex-none rounded-lg").OnClick(a.clickUndo).Text(
+				a.t(i18n.KeyUndo)),
+			Div().Class("flex gap-3 justify-end text-sm text-base-content/70").Body(
+				Span().Text(a.t(i18n.KeyExport)+":"),
+				A().Class("link link-info").Href("/transcript?format=md").Target("_blank").Text("MD"),
+				A().Class("link link-info").Href("/transcript?format=json").Target("_blank").Text("JSON"),
+				A().Class("link link-info").Href("/transcript?format=html").Target("_blank").Text("HTML"),
+			),
 		).
 			OnSubmit(a.promptSubmit),
 
@@ -231,13 +239,13 @@ func (a *AgentUI) renderPromptForm() UI {
 	}
 	if agent.Is1(ssA.Interrupted) {
 		btnSend.Disabled(true)
-		btnInter.Text("Resume")
+		btnInter.Text(a.t(i18n.KeyResume))
 		textarea.Disabled(true)
 	}
 	if agent.Is1(ssA.Requesting) {
 		btnSend.Body(
 			Span().Class("loading loading-spinner loading-md"),
-			Span().Text(" Sending "),
+			Span().Text(" "+a.t(i18n.KeySending)+" "),
 			Span().Class("loading loading-spinner loading-md"),
 		)
 	}
@@ -296,7 +304,7 @@ func (a *AgentUI) renderMsgs() UI {
 
 		Div().Class("card bg-base-100 rounded-lg flex-1 overflow-hidden border border-base-200").Body(
 			Div().Class("card-body p-4 flex flex-col h-full").Body(
-				H2().Class("card-title text-sm text-base-content/50 uppercase tracking-wider mb-2 self-center").Text("Messages"),
+				H2().Class("card-title text-sm text-base-content/50 uppercase tracking-wider mb-2 self-center").Text(a.t(i18n.KeyMessages)),
 				Div().ID(idMsgs).Class("flex-1 overflow-y-auto").Body(
 					rows...,
 				),
@@ -326,6 +334,20 @@ func (a *AgentUI) renderClock() UI {
 
 // UI UTILS
 
+// locale returns the session's locale, or the configured one.
+func (a *AgentUI) locale() string {
+	if a.data != nil && a.data.Locale != "" {
+		return a.data.Locale
+	}
+
+	return a.boot.Config.Agent.Locale
+}
+
+// t returns a translated UI string.
+func (a *AgentUI) t(key string, args ...any) string {
+	return i18n.T(a.locale(), key, args...)
+}
+
 func (a *AgentUI) scrollMsgs() {
 	a.app.Dispatch(func(ctx Context) {
 		Window().Call("scrollMsgs")
@@ -339,6 +361,13 @@ func (a *AgentUI) msgsScrolled() bool {
 // HANDLERS
 
 // TODO state
+// clickUndo rewinds the agent before its latest step.
+func (a *AgentUI) clickUndo(ctx Context, e Event) {
+	e.PreventDefault()
+	e.StopImmediatePropagation()
+	a.agentClient.NetMach.Add1(ssA.Rewind, nil)
+}
+
 func (a *AgentUI) clickInterrupt(ctx Context, e Event) {
 	e.PreventDefault()
 	e.StopImmediatePropagation()
@@ -10,6 +10,7 @@ import (
 	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
 	. "github.com/pancsta/go-app/pkg/app"
 
+	"github.com/pancsta/secai/graph"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -26,6 +27,9 @@ func (d *Dashboard) Render() UI {
 		d.configForm(),
 		d.splash(),
 		d.metrics(),
+		d.stories(),
+		d.storiesGraph(),
+		d.session(),
 		d.footer(),
 	)
 }
@@ -71,7 +75,7 @@ func (d *Dashboard) header() UI {
 				H2().Class("card-title text-warning").Text(fmt.Sprintf(
 					"%s Dashboard", d.boot.Config.Agent.Label)),
 				P().Body(
-					Raw(fixHTMLAnchors("<span>"+d.boot.Config.Agent.IntroDash+"</span>")),
+					Raw(fixHTMLAnchors("<span>"+d.boot.Config.Agent.Translated(d.boot.Config.Agent.Locale).IntroDash+"</span>")),
 				),
 			),
 			Div().Class("text-right pb-3 pr-3").Body(err, conn, cfg),
@@ -232,6 +236,24 @@ func (d *Dashboard) submitConfig(ctx Context, e Event) {
 	}()
 }
 
+// session links to a bundle of the agent's dir, see the "session import" command.
+func (d *Dashboard) session() UI {
+	return []UI{
+
+		// <HTML>
+
+		Div().Class("mb-5").Body(
+			H2().Class("text-xl mb-5").Body(
+				Text("Session "),
+				A().Class("link link-info text-sm").Href("/session/export").Text("Export bundle"),
+			),
+		),
+
+		// </HTML>
+
+	}[0]
+}
+
 func (d *Dashboard) metrics() UI {
 	a := d.agentClient
 	if a == nil {
@@ -274,6 +296,127 @@ func (d *Dashboard) metrics() UI {
 	}[0]
 }
 
+func (d *Dashboard) stories() UI {
+	if d.data == nil || len(d.data.Stories) == 0 {
+		return nil
+	}
+
+	var rows []UI
+	for _, s := range d.data.Stories {
+		// most common preceding story
+		prev := ""
+		for state, count := range s.Preceding {
+			if prev == "" || count > s.Preceding[prev] || count == s.Preceding[prev] && state < prev {
+				prev = state
+			}
+		}
+		last := ""
+		if s.Last != nil {
+			last = s.Last.CreatedAt.Format(time.DateTime)
+		}
+
+		rows = append(rows, Tr().Body(
+			Td().Text(s.State),
+			Td().Text(s.Runs),
+			Td().Text((time.Duration(s.AvgMs)*time.Millisecond).String()),
+			Td().Text((time.Duration(s.MaxMs)*time.Millisecond).String()),
+			Td().Text(prev),
+			Td().Text(last),
+		))
+	}
+
+	return []UI{
+
+		// <HTML>
+
+		Div().Class("mb-5").Body(
+			H2().Class("text-xl mb-5").Text("Stories"),
+			Div().Class("overflow-x-auto rounded-box bg-base-100").Body(
+				Table().Class("table table-sm").Body(
+					THead().Body(Tr().Body(
+						Th().Text("Story"),
+						Th().Text("Runs"),
+						Th().Text("Avg"),
+						Th().Text("Max"),
+						Th().Text("Preceded by"),
+						Th().Text("Last"),
+					)),
+					TBody().Body(rows...),
+				),
+			),
+		),
+
+		// </HTML>
+
+	}[0]
+}
+
+func (d *Dashboard) storiesGraph() UI {
+	a := d.agentClient
+	if a == nil || d.data == nil || d.data.Graph == nil {
+		return nil
+	}
+	g := d.data.Graph
+
+	var rows []UI
+	for _, n := range g.Nodes {
+		if n.Kind != graph.KindStory {
+			continue
+		}
+
+		// live highlight
+		badge := Div().Class("badge badge-sm badge-ghost").Text("inactive")
+		if a.NetMach.Has1(n.State) && a.NetMach.Is1(n.State) {
+			badge = Div().Class("badge badge-sm badge-success").Text("active")
+		}
+
+		var triggers, actions []string
+		for _, e := range g.Edges {
+			if e.To == n.ID && e.Kind != graph.EdgeAction && e.Kind != graph.EdgeRelation {
+				triggers = append(triggers, e.Label+" "+strings.TrimPrefix(e.From, "mem_"))
+			} else if e.From == n.ID && e.Kind == graph.EdgeAction {
+				actions = append(actions, e.Label+" → "+e.To)
+			}
+		}
+
+		rows = append(rows, Tr().Body(
+			Td().Body(badge),
+			Td().Class("tooltip").Attr("data-tip", n.State).Text(n.Label),
+			Td().Text(strings.Join(triggers, ", ")),
+			Td().Text(strings.Join(actions, ", ")),
+		))
+	}
+
+	return []UI{
+
+		// <HTML>
+
+		Div().Class("mb-5").Body(
+			H2().Class("text-xl mb-5").Body(
+				Text("Stories Graph "),
+				A().Class("link link-info text-sm").Href("/stories/graph?format=mermaid").Target("_blank").
+					Text("Mermaid"),
+				Text(" "),
+				A().Class("link link-info text-sm").Href("/stories/graph?format=dot").Target("_blank").Text("DOT"),
+			),
+			Div().Class("overflow-x-auto rounded-box bg-base-100").Body(
+				Table().Class("table table-sm").Body(
+					THead().Body(Tr().Body(
+						Th(),
+						Th().Text("Story"),
+						Th().Text("Triggers"),
+						Th().Text("Actions"),
+					)),
+					TBody().Body(rows...),
+				),
+			),
+		),
+
+		// </HTML>
+
+	}[0]
+}
+
 func (d *Dashboard) splash() HTML {
 	if d.mach.Not1(ss.Data) || d.mach.Transition() != nil {
 		return nil
@@ -300,7 +443,7 @@ func (d *Dashboard) footer() UI {
 		Footer().Class(
 			"footer sm:footer-horizontal footer-center rounded-box bg-base-100 text-base-content p-4").Body(
 			Aside().Body(
-				P().Body(Raw("<span>" + fixHTMLAnchors(d.boot.Config.Agent.Footer) + "</span>")),
+				P().Body(Raw("<span>" + fixHTMLAnchors(d.boot.Config.Agent.Translated(d.boot.Config.Agent.Locale).Footer) + "</span>")),
 			),
 		),
 
@@ -87,6 +87,7 @@ type AgentUIStatesDef struct {
 	UIMsg           string
 	UIRenderClock   string
 	UICleanOutput   string
+	Rewound         string
 
 	// inherit from PageStatesDef
 	*PageStatesDef
@@ -120,6 +121,10 @@ var AgentUISchema = SchemaMerge(
 			Multi:   true,
 			Require: S{ssA.RPCConnected},
 		},
+		ssA.Rewound: {
+			Multi:   true,
+			Require: S{ssA.RPCConnected},
+		},
 
 		// piped
 
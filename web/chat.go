@@ -0,0 +1,246 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/pancsta/secai/shared"
+)
+
+// ChatSessionHeader is the HTTP header of the chat API's session. The "user" field of the request is used as a
+// fallback.
+const ChatSessionHeader = "X-Session-Id"
+
+var (
+	// ErrChatNoPrompt means the request has no user message.
+	ErrChatNoPrompt = errors.New("no user message")
+	// ErrChatSession means the agent is kept by another session.
+	ErrChatSession = errors.New("agent busy with another session")
+	// ErrChatTimeout means the agent didn't reply within [shared.ConfigWeb.ChatTimeout].
+	ErrChatTimeout = errors.New("no reply from the agent")
+)
+
+// ChatHandler returns an OpenAI-compatible chat completions API on "/v1/chat/completions" and "/v1/models". The last
+// user message becomes a prompt, and the agent's outputs until the next assistant message are the reply, optionally
+// streamed. The agent has a single conversation, so one session (see [ChatSessionHeader]) keeps it until idle for
+// [shared.ConfigWeb.ChatSessionTTL]. Previous messages of the request are ignored, as the agent has its own memory.
+// Without an assistant message within [shared.ConfigWeb.ChatTimeout], the response is a 504 error, or a stream ending
+// with an error object.
+func (h *Handlers) ChatHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", h.chatCompletions)
+	mux.HandleFunc("GET /v1/models", h.chatModels)
+
+	return mux
+}
+
+// private
+
+func (h *Handlers) chatCompletions(w http.ResponseWriter, req *http.Request) {
+	cfg := h.A.ConfigBase()
+	var body openai.ChatCompletionRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		chatErr(w, http.StatusBadRequest, err)
+		return
+	}
+	text := chatPrompt(body.Messages)
+	if text == "" {
+		chatErr(w, http.StatusBadRequest, ErrChatNoPrompt)
+		return
+	}
+
+	// session affinity
+	session := req.Header.Get(ChatSessionHeader)
+	if session == "" {
+		session = body.User
+	}
+	if !h.chatClaim(session) {
+		chatErr(w, http.StatusConflict, ErrChatSession)
+		return
+	}
+	defer h.chatClaim(session)
+	if session != "" {
+		w.Header().Set(ChatSessionHeader, session)
+	}
+
+	// one prompt at a time
+	h.chatMx.Lock()
+	defer h.chatMx.Unlock()
+
+	ch := h.apiSubscribe()
+	defer h.apiUnsubscribe(ch)
+	if h.A.Mach().Add1(ss.Prompt, Pass(&ABase{Prompt: text})) == am.Canceled {
+		chatErr(w, http.StatusConflict, ErrAPICanceled)
+		return
+	}
+
+	id := fmt.Sprintf("chatcmpl-%s-%d", h.A.SessionID(), time.Now().UnixNano())
+	model := body.Model
+	if model == "" {
+		model = cfg.Agent.ID
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), cfg.Web.ChatTimeout)
+	defer cancel()
+
+	// stream
+	if body.Stream {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			chatErr(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		chunk := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) {
+			j, err := json.Marshal(openai.ChatCompletionStreamResponse{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Created: time.Now().Unix(),
+				Model:   model,
+				Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+			})
+			if err != nil {
+				h.A.LogErr("chat chunk", err)
+				return
+			}
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", j)
+			flusher.Flush()
+		}
+
+		chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+		replied := h.chatReplies(ctx, ch, func(part string) {
+			chunk(openai.ChatCompletionStreamChoiceDelta{Content: part}, "")
+		})
+		// the status is already sent, report the timeout in the stream
+		if replied {
+			chunk(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop)
+		} else if j, err := json.Marshal(chatTimeoutErr()); err == nil {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", j)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+
+		return
+	}
+
+	// single response
+	var reply strings.Builder
+	replied := h.chatReplies(ctx, ch, func(part string) {
+		reply.WriteString(part)
+	})
+	if !replied {
+		apiJSON(w, http.StatusGatewayTimeout, chatTimeoutErr())
+		return
+	}
+	apiJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: reply.String(),
+			},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+}
+
+func (h *Handlers) chatModels(w http.ResponseWriter, req *http.Request) {
+	cfg := h.A.ConfigBase()
+	apiJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data": []openai.Model{{
+			ID:      cfg.Agent.ID,
+			Object:  "model",
+			OwnedBy: cfg.Agent.Label,
+		}},
+	})
+}
+
+// chatReplies passes the agent's outputs to [fn], until an assistant message or [ctx] expires. Parts after the first
+// one are separated by an empty line. Returns false when no assistant message arrived.
+func (h *Handlers) chatReplies(ctx context.Context, ch chan *shared.Msg, fn func(part string)) bool {
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg := <-ch:
+			if msg.From == shared.FromUser {
+				continue
+			}
+			if !first {
+				fn("\n\n")
+			}
+			first = false
+			fn(msg.Text)
+			if msg.From == shared.FromAssistant {
+				return true
+			}
+		}
+	}
+}
+
+// chatClaim keeps the agent for [session], unless another session used it within
+// [shared.ConfigWeb.ChatSessionTTL].
+func (h *Handlers) chatClaim(session string) bool {
+	h.apiMx.Lock()
+	defer h.apiMx.Unlock()
+
+	ttl := h.A.ConfigBase().Web.ChatSessionTTL
+	if h.chatSession != session && !h.chatLast.IsZero() && time.Since(h.chatLast) < ttl {
+		return false
+	}
+	h.chatSession = session
+	h.chatLast = time.Now()
+
+	return true
+}
+
+// chatPrompt returns the text of the last user message.
+func chatPrompt(msgs []openai.ChatCompletionMessage) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if m.Content != "" {
+			return m.Content
+		}
+		var parts []string
+		for _, p := range m.MultiContent {
+			if p.Type == openai.ChatMessagePartTypeText {
+				parts = append(parts, p.Text)
+			}
+		}
+
+		return strings.Join(parts, "\n")
+	}
+
+	return ""
+}
+
+func chatTimeoutErr() openai.ErrorResponse {
+	return openai.ErrorResponse{Error: &openai.APIError{
+		Message: ErrChatTimeout.Error(),
+		Type:    "timeout_error",
+	}}
+}
+
+func chatErr(w http.ResponseWriter, code int, err error) {
+	apiJSON(w, code, openai.ErrorResponse{Error: &openai.APIError{
+		Message: err.Error(),
+		Type:    "invalid_request_error",
+	}})
+}
@@ -6,6 +6,7 @@ import (
 
 	amhelp "github.com/pancsta/asyncmachine-go/pkg/helpers"
 	am "github.com/pancsta/asyncmachine-go/pkg/machine"
+	"github.com/pancsta/secai/graph"
 	"github.com/pancsta/secai/shared"
 )
 
@@ -14,6 +15,16 @@ const RouteFoo = "/foo"
 type DataDashboard struct {
 	Metrics *DataMetrics
 	Splash  string
+	// Stories are stats of past story runs.
+	Stories []shared.StoryStats
+	// Graph of stories, their triggers and actions.
+	Graph *graph.Graph
+}
+
+// DataStories is the persisted story timeline, returned by "/stories".
+type DataStories struct {
+	Stats  []shared.StoryStats
+	Events []shared.StoryEvent
 }
 
 type DataAgent struct {
@@ -22,6 +33,8 @@ type DataAgent struct {
 	Actions   []shared.ActionInfo
 	Stories   []shared.StoryInfo
 	ClockDiff [][]int
+	// Locale is the session's locale.
+	Locale string
 }
 
 type DataMetrics struct {
@@ -39,6 +52,40 @@ type DataBoostrap struct {
 
 // ///// ///// /////
 
+// ///// REST API
+
+// ///// ///// /////
+
+// APIPrompt is the body of "POST /api/v1/prompt".
+type APIPrompt struct {
+	// Text of the prompt, like in the chat.
+	Text string `jsonschema:"required"`
+}
+
+// APIResult is the result of a mutation: "executed", "queued" or "canceled".
+type APIResult struct {
+	Result string
+}
+
+// APIError is returned with non-2xx status codes.
+type APIError struct {
+	Error string
+}
+
+// APIStates are the states of the agent's machine.
+type APIStates struct {
+	Active am.S
+	All    am.S
+}
+
+// APIStory is a story with its activation status.
+type APIStory struct {
+	shared.StoryInfo
+	Active bool
+}
+
+// ///// ///// /////
+
 // ///// ARGS (BROWSER)
 
 // ///// ///// /////
@@ -14,6 +14,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -32,8 +33,10 @@ import (
 	"github.com/pancsta/sqliter-embed"
 	"github.com/teivah/onecontext"
 
+	"github.com/pancsta/secai/graph"
 	"github.com/pancsta/secai/shared"
 	sabase "github.com/pancsta/secai/states"
+	"github.com/pancsta/secai/transcript"
 	ssb "github.com/pancsta/secai/web/browser/states"
 	"github.com/pancsta/secai/web/types"
 )
@@ -66,6 +69,15 @@ type Handlers struct {
 	nextDashNum    int
 	nextAgentUINum int
 	rpcUI          *arpc.Server
+	// apiMx guards apiSubs, chatSession and chatLast
+	apiMx sync.Mutex
+	// apiSubs are the SSE clients of the REST API
+	apiSubs map[chan *shared.Msg]struct{}
+	// chatMx serializes the prompts of the chat API
+	chatMx sync.Mutex
+	// chatSession is the chat API session keeping the agent
+	chatSession string
+	chatLast    time.Time
 }
 
 // ///// ///// /////
@@ -281,7 +293,9 @@ func (h *Handlers) RemoteDashReadyState(e *am.Event) {
 	mach.Fork(ctx, e, func() {
 		b.NetMach.EvAdd1(e, ssB.Data, PassRpc(&A{
 			DataDash: &types.DataDashboard{
-				Splash: h.A.AgentImpl().Splash(),
+				Splash:  h.A.AgentImpl().Splash(),
+				Stories: h.storyStats(ctx),
+				Graph:   graph.FromAgent(h.A.AgentImpl()),
 			},
 		}))
 	})
@@ -327,6 +341,7 @@ func (h *Handlers) RemoteUIReadyState(e *am.Event) {
 				ClockDiff: clockDiff,
 				Stories:   agent.Stories(),
 				Actions:   agent.Actions(),
+				Locale:    agent.Locale(),
 			},
 		}))
 	})
@@ -558,6 +573,14 @@ func (h *Handlers) StartHTTP(e *am.Event) error {
 	<-relay.Mach.When1(ssr.RelayStates.HttpReady, nil)
 	relay.HttpMux.Handle("/", goappHandler)
 	relay.HttpMux.HandleFunc("/bootstrap", h.handleBootstrap)
+	relay.HttpMux.HandleFunc("/stories", h.handleStories)
+	relay.HttpMux.HandleFunc("/stories/graph", h.handleStoriesGraph)
+	relay.HttpMux.HandleFunc("/transcript", h.handleTranscript)
+	relay.HttpMux.HandleFunc("/session/export", h.handleSessionExport)
+	relay.HttpMux.Handle(APIPrefix, h.APIHandler())
+	if cfg.Web.ChatAPI {
+		relay.HttpMux.Handle("/v1/", h.ChatHandler())
+	}
 
 	// TODO maybe race
 	h.relay = relay
@@ -596,6 +619,123 @@ func (h *Handlers) handleBootstrap(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// handleStories returns the persisted story timeline as JSON. Optional query params: "state" and "limit".
+func (h *Handlers) handleStories(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	state := req.URL.Query().Get("state")
+	limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	ret := types.DataStories{}
+	ret.Events, err = h.A.StoryEvents(ctx, state, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if state != "" {
+		stats, err := h.A.StoryStats(ctx, state)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ret.Stats = []shared.StoryStats{*stats}
+	} else {
+		ret.Stats = h.storyStats(ctx)
+	}
+
+	// return JSON
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ret); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleStoriesGraph returns the graph of stories as Mermaid (default), DOT or JSON, with active states marked. Query
+// param: "format".
+func (h *Handlers) handleStoriesGraph(w http.ResponseWriter, req *http.Request) {
+	g := graph.FromAgent(h.A.AgentImpl())
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = string(graph.FormatMermaid)
+	}
+
+	// return JSON
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(g); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	out, err := g.Render(graph.Format(format))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(out))
+}
+
+// handleTranscript exports the displayed messages as Markdown (default), JSON or HTML. Query params: "format" and
+// "prompts" (annotate with prompt IDs, defaults to the config).
+func (h *Handlers) handleTranscript(w http.ResponseWriter, req *http.Request) {
+	cfg := h.A.ConfigBase().Agent.Transcript
+	format := transcript.Format(req.URL.Query().Get("format"))
+	if format == "" {
+		format = transcript.Format(cfg.Format)
+	}
+	prompts := cfg.Prompts
+	if v := req.URL.Query().Get("prompts"); v != "" {
+		prompts, _ = strconv.ParseBool(v)
+	}
+
+	// displayed msgs, including the restored ones
+	msgs, err := h.A.Transcript(req.Context(), time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out, err := transcript.Render(msgs, format, transcript.Opts{
+		Title:   h.A.ConfigBase().Agent.Label,
+		Prompts: prompts,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	_, _ = w.Write([]byte(out))
+}
+
+// handleSessionExport returns a tar.gz bundle of the agent's dir, with a manifest.
+func (h *Handlers) handleSessionExport(w http.ResponseWriter, req *http.Request) {
+	name := fmt.Sprintf("%s-%s.tar.gz", h.A.ConfigBase().Agent.ID, h.A.SessionID())
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if err := h.A.ExportBundle(req.Context(), w, nil); err != nil {
+		h.A.LogErr("session export", err)
+	}
+}
+
+// storyStats returns stats for all the stories of the agent, skipping errors.
+func (h *Handlers) storyStats(ctx context.Context) []shared.StoryStats {
+	var ret []shared.StoryStats
+	for _, info := range h.A.AgentImpl().Stories() {
+		stats, err := h.A.StoryStats(ctx, info.State)
+		if err != nil {
+			h.A.LogErr("story stats", err, "state", info.State)
+			continue
+		}
+		ret = append(ret, *stats)
+	}
+
+	return ret
+}
+
 func (h *Handlers) pushMetrics(e *am.Event, browsers []*arpc.Client, store *shared.AgentStore) {
 	for _, b := range browsers {
 		b.NetMach.EvAdd1(e, ssB.Data, PassRpc(&A{
@@ -650,7 +790,7 @@ func (h *Handlers) newDashFunc(e *am.Event) amrelayt.NewClientFunc {
 func (h *Handlers) newAgentUIFunc(e *am.Event) amrelayt.NewClientFunc {
 	mach := h.A.Mach()
 	// pipes for states with arguments
-	pipes := am.S{ss.UIMsg, ss.UIRenderStories, ss.UIRenderClock, ss.UICleanOutput}
+	pipes := am.S{ss.UIMsg, ss.UIRenderStories, ss.UIRenderClock, ss.UICleanOutput, ss.Rewound}
 
 	return func(ctx context.Context, id string, conn net.Conn) (*arpc.Client, error) {
 		// init